@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// TimeTraveler is implemented by stores that keep enough history to
+// reproduce their state at an earlier moment. Other stores are rewound
+// through their audit log.
+type TimeTraveler interface {
+	// AsOf returns a read-only view of the store as it was at the given time
+	AsOf(at time.Time) (Store, error)
+}
+
+// GetAsOf returns a todo as it was at the given moment
+func (s *Service) GetAsOf(ctx context.Context, id int64, at time.Time) (*model.Todo, error) {
+	past, err := s.asOf(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	return past.Get(ctx, id)
+}
+
+// ListPageAsOf lists one page of todos as they were at the given moment
+func (s *Service) ListPageAsOf(ctx context.Context, at time.Time, opts cache.ListOptions) (*Page, error) {
+	past, err := s.asOf(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	return past.ListPage(ctx, opts)
+}
+
+// asOf returns a service reading from the store's state at the given time
+func (s *Service) asOf(ctx context.Context, at time.Time) (*Service, error) {
+	var store Store
+	if tt, ok := s.store.(TimeTraveler); ok {
+		past, err := tt.AsOf(at)
+		if err != nil {
+			return nil, err
+		}
+		store = past
+	} else {
+		todos, err := s.rewind(ctx, at)
+		if err != nil {
+			return nil, err
+		}
+		store = cache.NewInMemoryStoreFrom(cache.Snapshot{Todos: todos})
+	}
+	return &Service{store: store, deletePolicy: s.deletePolicy, workflow: s.workflow}, nil
+}
+
+// pastTodo is a todo being rewound: its JSON fields, since audit diffs are
+// recorded per JSON field, and what the fields leave out
+type pastTodo struct {
+	fields    map[string]json.RawMessage
+	version   int64
+	createdAt time.Time
+	deletedAt *time.Time
+	touched   bool // changed after the target time
+}
+
+// rewind reconstructs the todos as they were at the given time by undoing,
+// newest first, every audited change made after it. Todos purged since are
+// rebuilt from their full history when it starts with their creation.
+// Dependencies are not audited and are left out.
+func (s *Service) rewind(ctx context.Context, at time.Time) ([]model.Todo, error) {
+	live, err := s.store.List(ctx, cache.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	trash, err := s.store.List(ctx, cache.ListOptions{Deleted: true})
+	if err != nil {
+		return nil, err
+	}
+	todos := make(map[int64]*pastTodo, len(live)+len(trash))
+	for _, t := range append(live, trash...) {
+		todos[t.ID] = &pastTodo{fields: auditFields(&t), version: t.Version, createdAt: t.CreatedAt, deletedAt: t.DeletedAt}
+	}
+
+	entries, err := s.store.ListAudit(ctx, cache.AuditOptions{Since: at})
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !e.CreatedAt.After(at) {
+			continue
+		}
+		p, ok := todos[e.TodoID]
+		if !ok {
+			if p, err = s.replayPurged(ctx, e.TodoID); err != nil {
+				return nil, err
+			}
+			if p == nil {
+				continue // purged, and created before the audit log began
+			}
+			todos[e.TodoID] = p
+		}
+		p.touched = true
+		switch e.Action {
+		case model.AuditCreate:
+			delete(todos, e.TodoID)
+			continue
+		case model.AuditUpdate:
+			for _, c := range e.Changes {
+				if isNull(c.Old) {
+					delete(p.fields, c.Field)
+				} else {
+					p.fields[c.Field] = c.Old
+				}
+			}
+		case model.AuditDelete:
+			p.deletedAt = nil
+		case model.AuditRestore:
+			deletedAt := e.CreatedAt
+			p.deletedAt = &deletedAt
+		}
+		p.version--
+	}
+
+	out := make([]model.Todo, 0, len(todos))
+	for id, p := range todos {
+		t, err := p.todo()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind todo %d: %w", id, err)
+		}
+		t.ID = id
+		if p.touched {
+			// the last change the rewound todo had seen
+			prior, err := s.store.ListAudit(ctx, cache.AuditOptions{TodoID: id, Until: at.Add(time.Nanosecond)})
+			if err != nil {
+				return nil, err
+			}
+			t.UpdatedAt = t.CreatedAt
+			if n := len(prior); n > 0 {
+				t.UpdatedAt = prior[n-1].CreatedAt
+			}
+		}
+		out = append(out, *t)
+	}
+	return out, nil
+}
+
+// replayPurged rebuilds a todo that no longer exists from its audit
+// history, or returns nil when the history does not start with its creation
+func (s *Service) replayPurged(ctx context.Context, id int64) (*pastTodo, error) {
+	entries, err := s.store.ListAudit(ctx, cache.AuditOptions{TodoID: id})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].Action != model.AuditCreate {
+		return nil, nil
+	}
+	p := &pastTodo{fields: make(map[string]json.RawMessage), createdAt: entries[0].CreatedAt}
+	for _, e := range entries {
+		switch e.Action {
+		case model.AuditCreate, model.AuditUpdate:
+			for _, c := range e.Changes {
+				if isNull(c.New) {
+					delete(p.fields, c.Field)
+				} else {
+					p.fields[c.Field] = c.New
+				}
+			}
+		case model.AuditDelete:
+			deletedAt := e.CreatedAt
+			p.deletedAt = &deletedAt
+		case model.AuditRestore:
+			p.deletedAt = nil
+		}
+		p.version++
+	}
+	return p, nil
+}
+
+// todo decodes the rewound fields
+func (p *pastTodo) todo() (*model.Todo, error) {
+	b, err := json.Marshal(p.fields)
+	if err != nil {
+		return nil, err
+	}
+	var t model.Todo
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	t.Version = p.version
+	t.CreatedAt = p.createdAt
+	if t.UpdatedAt.IsZero() {
+		t.UpdatedAt = p.createdAt
+	}
+	t.DeletedAt = p.deletedAt
+	return &t, nil
+}
+
+// isNull reports whether a recorded field value is unset
+func isNull(v json.RawMessage) bool {
+	return len(v) == 0 || string(v) == "null"
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// tick returns a moment strictly between the changes made before and after
+// the call
+func tick() time.Time {
+	time.Sleep(2 * time.Millisecond)
+	at := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	return at
+}
+
+func TestService_AsOf(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore())
+
+	a := &model.Todo{Name: "a", Tags: []string{"x"}}
+	if _, err := s.Create(ctx, a); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	b := &model.Todo{Name: "b", Priority: 3}
+	if _, err := s.Create(ctx, b); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	sprintStart := tick()
+
+	a.Name, a.Tags, a.Description = "a2", nil, "added later"
+	if err := s.Update(ctx, a); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := s.Delete(ctx, b.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Purge(ctx, 0); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, err := s.Create(ctx, &model.Todo{Name: "c"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	page, err := s.ListPageAsOf(ctx, sprintStart, cache.ListOptions{SortBy: "id"})
+	if err != nil {
+		t.Fatalf("list as of: %v", err)
+	}
+	if len(page.Items) != 2 {
+		t.Fatalf("expected 2 todos at sprint start, got %+v", page.Items)
+	}
+	got := page.Items[0]
+	if got.Name != "a" || got.Description != "" || len(got.Tags) != 1 || got.Version != 1 {
+		t.Errorf("expected a at version 1, got %+v", got)
+	}
+	if got.UpdatedAt.After(sprintStart) {
+		t.Errorf("expected updated_at before %v, got %v", sprintStart, got.UpdatedAt)
+	}
+	// b was purged since, and is rebuilt from its history
+	if purged := page.Items[1]; purged.ID != b.ID || purged.Name != "b" || purged.Priority != 3 || purged.Version != 1 {
+		t.Errorf("unexpected purged todo %+v", purged)
+	}
+
+	if got, err := s.GetAsOf(ctx, a.ID, sprintStart); err != nil || got.Name != "a" {
+		t.Errorf("expected a as of sprint start, got %+v (err %v)", got, err)
+	}
+	if _, err := s.GetAsOf(ctx, 3, sprintStart); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a todo created later, got %v", err)
+	}
+	if _, err := s.GetAsOf(ctx, b.ID, time.Now()); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted todo, got %v", err)
+	}
+}
+
+func TestService_AsOf_DeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore())
+	todo := &model.Todo{Name: "a"}
+	if _, err := s.Create(ctx, todo); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := s.Delete(ctx, todo.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	inTrash := tick()
+	if _, err := s.Restore(ctx, todo.ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	if _, err := s.GetAsOf(ctx, todo.ID, inTrash); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound while in the trash, got %v", err)
+	}
+	got, err := s.GetAsOf(ctx, todo.ID, time.Now())
+	if err != nil || got.Version != 3 {
+		t.Errorf("expected the restored todo at version 3, got %+v (err %v)", got, err)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// Caller identifies who a change is made for. It is recorded with every
+// audit entry the change produces, including side effects such as progress
+// roll-ups.
+type Caller struct {
+	Actor     string
+	RequestID string
+}
+
+// As returns a copy of the service that attributes its changes to c
+func (s *Service) As(c Caller) *Service {
+	cp := *s
+	cp.caller = c
+	return &cp
+}
+
+// History returns the audit entries of one todo matching opts, oldest
+// first. Deleted and purged todos keep their history.
+func (s *Service) History(ctx context.Context, id int64, opts cache.AuditOptions) ([]model.AuditEntry, error) {
+	opts.TodoID = id
+	entries, err := s.store.ListAudit(ctx, opts)
+	if err != nil || len(entries) > 0 {
+		return entries, err
+	}
+	// nothing matched; tell an unknown todo apart from an empty result
+	known, err := s.store.ListAudit(ctx, cache.AuditOptions{TodoID: id, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(known) == 0 {
+		if _, err := s.store.Get(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Audit returns the audit entries of every todo matching opts, oldest first
+func (s *Service) Audit(ctx context.Context, opts cache.AuditOptions) ([]model.AuditEntry, error) {
+	return s.store.ListAudit(ctx, opts)
+}
+
+// record appends an audit entry for a change to todo id made on behalf of
+// the service's caller
+func (s *Service) record(ctx context.Context, action model.AuditAction, id int64, before, after *model.Todo) error {
+	e := &model.AuditEntry{
+		TodoID:    id,
+		Action:    action,
+		Actor:     s.caller.Actor,
+		RequestID: s.caller.RequestID,
+		Changes:   Diff(before, after),
+	}
+	if err := s.store.AddAudit(ctx, e); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// auditIgnored are the todo fields left out of diffs: they change on every
+// write or are implied by the entry's action
+var auditIgnored = map[string]bool{
+	"id": true, "version": true, "created_at": true, "updated_at": true, "deleted_at": true,
+}
+
+// Diff compares the JSON form of two todos field by field and returns the
+// fields that differ, sorted by name. Either todo may be nil, e.g. before
+// for a create.
+func Diff(before, after *model.Todo) []model.FieldChange {
+	old, cur := auditFields(before), auditFields(after)
+	names := make(map[string]bool)
+	for name := range old {
+		names[name] = true
+	}
+	for name := range cur {
+		names[name] = true
+	}
+
+	changes := []model.FieldChange{}
+	for name := range names {
+		if auditIgnored[name] || bytes.Equal(old[name], cur[name]) {
+			continue
+		}
+		changes = append(changes, model.FieldChange{Field: name, Old: old[name], New: cur[name]})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// auditFields returns the JSON value of each field of t. The due date is
+// normalized to stored precision so a time zone or monotonic clock
+// reading does not show up as a change.
+func auditFields(t *model.Todo) map[string]json.RawMessage {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	if !c.DueDate.IsZero() {
+		c.DueDate = c.DueDate.UTC().Truncate(time.Millisecond)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestDiff(t *testing.T) {
+	before := &model.Todo{ID: 1, Name: "draft", Description: "old", Tags: []string{"a"}, Version: 1}
+	after := &model.Todo{ID: 1, Name: "final", Tags: []string{"a"}, Priority: 2, Version: 2}
+
+	changes := Diff(before, after)
+	want := []struct{ field, old, new string }{
+		{"description", `"old"`, "null"},
+		{"name", `"draft"`, `"final"`},
+		{"priority", "null", "2"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Field != w.field || string(orNull(c.Old)) != w.old || string(orNull(c.New)) != w.new {
+			t.Errorf("change %d: expected %s %s -> %s, got %s %s -> %s", i, w.field, w.old, w.new, c.Field, c.Old, c.New)
+		}
+	}
+
+	if changes := Diff(after, after); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+	for _, c := range Diff(nil, after) {
+		if c.Field == "id" || c.Field == "version" || c.Old != nil {
+			t.Errorf("unexpected create change %+v", c)
+		}
+	}
+}
+
+func orNull(b []byte) []byte {
+	if b == nil {
+		return []byte("null")
+	}
+	return b
+}
+
+func TestService_Audit(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore(), WithDeletePolicy(DeleteCascade))
+	alice := s.As(Caller{Actor: "alice", RequestID: "req-1"})
+	bob := s.As(Caller{Actor: "bob", RequestID: "req-2"})
+
+	parent, _ := alice.Create(ctx, &model.Todo{Name: "release"})
+	child, _ := alice.Create(ctx, &model.Todo{Name: "notes", ParentID: parent})
+
+	got, _ := bob.Get(ctx, child)
+	got.Status = model.Completed
+	if err := bob.Update(ctx, got); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	history, err := s.History(ctx, child, cache.AuditOptions{})
+	if err != nil || len(history) != 2 {
+		t.Fatalf("expected create and update, got %+v, %v", history, err)
+	}
+	update := history[1]
+	if update.Action != model.AuditUpdate || update.Actor != "bob" || update.RequestID != "req-2" {
+		t.Fatalf("unexpected entry %+v", update)
+	}
+	fields := map[string]string{}
+	for _, c := range update.Changes {
+		fields[c.Field] = string(c.Old) + "->" + string(c.New)
+	}
+	if fields["status"] != `"not_started"->"completed"` || fields["progress"] != "0->100" || len(fields) != 2 {
+		t.Fatalf("unexpected diff %v", fields)
+	}
+
+	// the roll-up to the parent is attributed to the same request
+	rolled, _ := s.Audit(ctx, cache.AuditOptions{TodoID: parent, RequestID: "req-2"})
+	if len(rolled) != 1 || rolled[0].Changes[0].Field != "progress" {
+		t.Fatalf("expected the progress roll-up in bob's request, got %+v", rolled)
+	}
+
+	if err := bob.Delete(ctx, parent); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	deletes, _ := s.Audit(ctx, cache.AuditOptions{Actor: "bob", Action: model.AuditDelete})
+	if len(deletes) != 2 {
+		t.Fatalf("expected the cascade to record two deletes, got %+v", deletes)
+	}
+	if history, err := s.History(ctx, child, cache.AuditOptions{}); err != nil || len(history) != 3 {
+		t.Fatalf("expected a deleted todo to keep its history, got %+v, %v", history, err)
+	}
+	if history, err := s.History(ctx, child, cache.AuditOptions{Actor: "carol"}); err != nil || len(history) != 0 {
+		t.Fatalf("expected an empty filtered history, got %+v, %v", history, err)
+	}
+	if _, err := s.History(ctx, 99, cache.AuditOptions{}); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an unknown todo, got %v", err)
+	}
+
+	page, _ := s.Audit(ctx, cache.AuditOptions{Limit: 2})
+	next, _ := s.Audit(ctx, cache.AuditOptions{AfterID: page[1].ID})
+	if len(page) != 2 || len(next) == 0 || next[0].ID != page[1].ID+1 {
+		t.Fatalf("unexpected paging %+v then %+v", page, next)
+	}
+}
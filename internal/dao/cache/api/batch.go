@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// MaxBatchSize caps the number of operations in one batch
+const MaxBatchSize = 100
+
+// BatchKind is the kind of change a BatchOp makes
+type BatchKind string
+
+const (
+	BatchCreate BatchKind = "create"
+	BatchUpdate BatchKind = "update"
+	BatchDelete BatchKind = "delete"
+)
+
+// BatchOp is one operation of a batch: create Todo, replace todo ID with
+// Todo (honouring a non-zero Todo.Version like If-Match) or delete todo ID
+type BatchOp struct {
+	Op   BatchKind   `json:"op" enums:"create,update,delete"`
+	ID   int64       `json:"id,omitempty"`
+	Todo *model.Todo `json:"todo,omitempty"`
+}
+
+// OpResult is the outcome of one batch operation. Err is set on the
+// operations that made a batch fail; the others of a failed batch have
+// neither Todo nor Err.
+type OpResult struct {
+	Op   BatchKind
+	ID   int64
+	Todo *model.Todo // the created or updated todo
+	Err  error
+}
+
+// Change is a todo change made by a batch, in the form a Broadcaster is
+// told about it. Only the ID of deleted todos is set.
+type Change struct {
+	Type string // create, update, delete or restore
+	Todo model.Todo
+}
+
+// BatchResult is the outcome of a batch: one result per operation and
+// every change it made, side effects included, in order
+type BatchResult struct {
+	Results []OpResult
+	Changes []Change
+}
+
+// ErrBatchFailed is returned when an operation of a batch failed and none
+// was applied; the failing operations carry their error in the results
+var ErrBatchFailed = errors.New("batch failed, no operation was applied")
+
+// pendingOp is a validated batch operation waiting to be written
+type pendingOp struct {
+	cur, next *model.Todo // update: the stored todo and the next occurrence
+	deleted   []int64     // delete: the todo and its subtree, deepest first
+}
+
+// Batch validates and applies the operations in order in a single
+// transaction, each against the todos as the operations before it left
+// them. A todo may only be named by one operation.
+// Audit entries, progress roll-ups and recurrences follow once every
+// operation is written; the changes are collected in the result instead of
+// being reported to the broadcaster one by one.
+func (s *Service) Batch(ctx context.Context, ops []BatchOp) (*BatchResult, error) {
+	if len(ops) == 0 {
+		return nil, ErrInvalid("batch has no operations")
+	}
+	if len(ops) > MaxBatchSize {
+		return nil, ErrInvalid(fmt.Sprintf("batch has more than %d operations", MaxBatchSize))
+	}
+
+	res := &BatchResult{Results: make([]OpResult, len(ops))}
+	changes := &changeLog{}
+	quiet := *s
+	quiet.broadcaster = changes
+	err := quiet.inTx(ctx, func(tx *Service) error {
+		// each operation is checked against the todos the earlier ones
+		// left, so one cannot build on a todo another removed; a failed
+		// operation is skipped to report the errors of the ones after it
+		pending := make([]pendingOp, len(ops))
+		named := make(map[int64]bool)
+		failed := false
+		for i, op := range ops {
+			r := &res.Results[i]
+			r.Op, r.ID = op.Op, op.ID
+			err := tx.prepareOp(ctx, op, &pending[i], named)
+			if err == nil {
+				err = tx.writeOp(ctx, op, pending[i])
+			}
+			if err != nil {
+				r.Err = err
+				failed = true
+			}
+		}
+		if failed {
+			return ErrBatchFailed
+		}
+
+		for i, op := range ops {
+			r, p := &res.Results[i], pending[i]
+			var err error
+			switch op.Op {
+			case BatchCreate:
+				r.ID, r.Todo = op.Todo.ID, op.Todo
+				tx.broadcaster.BroadcastCreate(op.Todo)
+				err = tx.finishCreate(ctx, op.Todo)
+			case BatchUpdate:
+				r.Todo = op.Todo
+				tx.broadcaster.BroadcastUpdate(op.Todo)
+				err = tx.finishUpdate(ctx, p.cur, op.Todo, p.next)
+			case BatchDelete:
+				err = tx.finishDelete(ctx, p.cur, p.deleted)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrBatchFailed) {
+		return res, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Changes = changes.changes
+	return res, nil
+}
+
+// prepareOp validates op. named collects the todos named so far.
+func (s *Service) prepareOp(ctx context.Context, op BatchOp, p *pendingOp, named map[int64]bool) error {
+	name := func(id int64) error {
+		if named[id] {
+			return ErrInvalid(fmt.Sprintf("todo %d appears in more than one operation", id))
+		}
+		named[id] = true
+		return nil
+	}
+	switch op.Op {
+	case BatchCreate:
+		if op.Todo == nil {
+			return ErrInvalid("create needs a todo")
+		}
+		op.Todo.ID = 0
+		return s.prepareCreate(ctx, op.Todo)
+
+	case BatchUpdate:
+		if op.Todo == nil {
+			return ErrInvalid("update needs a todo")
+		}
+		op.Todo.ID = op.ID
+		if err := name(op.ID); err != nil {
+			return err
+		}
+		cur, next, err := s.prepareUpdate(ctx, op.Todo)
+		if err != nil {
+			return err
+		}
+		p.cur, p.next = cur, next
+		return nil
+
+	case BatchDelete:
+		cur, err := s.store.Get(ctx, op.ID)
+		if err != nil {
+			return err
+		}
+		if err := name(op.ID); err != nil {
+			return err
+		}
+		subtree, err := s.subtree(ctx, op.ID)
+		if err != nil {
+			return err
+		}
+		if len(subtree) > 0 && s.deletePolicy != DeleteCascade {
+			return ErrHasChildren
+		}
+		for _, id := range subtree {
+			if err := name(id); err != nil {
+				return err
+			}
+		}
+		p.cur, p.deleted = cur, append(subtree, op.ID)
+		return nil
+	}
+	return ErrInvalid(fmt.Sprintf("unknown operation %q", op.Op))
+}
+
+// writeOp stores a prepared operation
+func (s *Service) writeOp(ctx context.Context, op BatchOp, p pendingOp) error {
+	switch op.Op {
+	case BatchCreate:
+		id, err := s.store.Create(ctx, op.Todo)
+		op.Todo.ID = id
+		return err
+	case BatchUpdate:
+		return s.store.Update(ctx, op.Todo)
+	}
+	at := time.Now().UTC()
+	for _, id := range p.deleted {
+		if err := s.store.Delete(ctx, id, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtree lists the live descendants of id, deepest first
+func (s *Service) subtree(ctx context.Context, id int64) ([]int64, error) {
+	children, err := s.children(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var out []int64
+	for _, c := range children {
+		below, err := s.subtree(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(append(out, below...), c.ID)
+	}
+	return out, nil
+}
+
+// finishDelete records a stored delete of cur and its subtree and rolls
+// progress up to cur's parent
+func (s *Service) finishDelete(ctx context.Context, cur *model.Todo, deleted []int64) error {
+	for _, id := range deleted {
+		if err := s.record(ctx, model.AuditDelete, id, nil, nil); err != nil {
+			return err
+		}
+		if s.broadcaster != nil {
+			s.broadcaster.BroadcastDelete(id)
+		}
+	}
+	return s.rollUp(ctx, cur.ParentID)
+}
+
+// changeLog is a Broadcaster collecting the changes of a transaction
+type changeLog struct {
+	changes []Change
+}
+
+func (l *changeLog) BroadcastCreate(t *model.Todo)  { l.add("create", *t) }
+func (l *changeLog) BroadcastUpdate(t *model.Todo)  { l.add("update", *t) }
+func (l *changeLog) BroadcastDelete(id int64)       { l.add("delete", model.Todo{ID: id}) }
+func (l *changeLog) BroadcastRestore(t *model.Todo) { l.add("restore", *t) }
+
+func (l *changeLog) add(typ string, t model.Todo) {
+	l.changes = append(l.changes, Change{Type: typ, Todo: t})
+}
+
+// replay reports the collected changes to b, in order
+func (l *changeLog) replay(b Broadcaster) {
+	for _, c := range l.changes {
+		t := c.Todo
+		switch c.Type {
+		case "create":
+			b.BroadcastCreate(&t)
+		case "update":
+			b.BroadcastUpdate(&t)
+		case "delete":
+			b.BroadcastDelete(t.ID)
+		case "restore":
+			b.BroadcastRestore(&t)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestService_Batch(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewInMemoryStore()
+	s := NewService(store, WithDeletePolicy(DeleteCascade)).As(Caller{Actor: "alice", RequestID: "req-1"})
+	parent := &model.Todo{Name: "release"}
+	s.Create(ctx, parent)
+	child := &model.Todo{Name: "changelog", ParentID: parent.ID}
+	s.Create(ctx, child)
+	other := &model.Todo{Name: "retro"}
+	s.Create(ctx, other)
+
+	res, err := s.Batch(ctx, []BatchOp{
+		{Op: BatchCreate, Todo: &model.Todo{Name: "tag", ParentID: parent.ID}},
+		{Op: BatchUpdate, ID: child.ID, Todo: &model.Todo{Name: "changelog", ParentID: parent.ID, Status: model.Completed}},
+		{Op: BatchDelete, ID: other.ID},
+	})
+	if err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	if r := res.Results[0]; r.ID != 4 || r.Todo == nil || r.Todo.Version != 1 {
+		t.Errorf("unexpected create result %+v", r)
+	}
+	if r := res.Results[1]; r.Todo == nil || r.Todo.Version != 2 || r.Todo.Progress != 100 {
+		t.Errorf("unexpected update result %+v", r)
+	}
+	if _, err := s.Get(ctx, other.ID); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected the deleted todo gone, got %v", err)
+	}
+
+	// the parent's progress rolls up once, the whole batch being applied
+	var types []string
+	for _, c := range res.Changes {
+		types = append(types, c.Type)
+	}
+	want := []string{"create", "update", "update", "delete"}
+	if len(types) != len(want) {
+		t.Fatalf("expected changes %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("expected changes %v, got %v", want, types)
+		}
+	}
+	if p, _ := s.Get(ctx, parent.ID); p.Progress != 50 {
+		t.Errorf("expected parent progress 50, got %d", p.Progress)
+	}
+	entries, _ := s.Audit(ctx, cache.AuditOptions{RequestID: "req-1", AfterID: 3})
+	if len(entries) != 4 || entries[0].Actor != "alice" {
+		t.Errorf("expected every change audited under the request, got %+v", entries)
+	}
+}
+
+func TestService_Batch_AllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewInMemoryStore()
+	s := NewService(store)
+	a := &model.Todo{Name: "a"}
+	s.Create(ctx, a)
+	parent := &model.Todo{Name: "parent"}
+	s.Create(ctx, parent)
+	s.Create(ctx, &model.Todo{Name: "child", ParentID: parent.ID})
+
+	res, err := s.Batch(ctx, []BatchOp{
+		{Op: BatchCreate, Todo: &model.Todo{Name: "new"}},
+		{Op: BatchUpdate, ID: a.ID, Todo: &model.Todo{Name: "a2", Status: "archived"}},
+		{Op: BatchDelete, ID: parent.ID},
+		{Op: BatchDelete, ID: a.ID},
+		{Op: BatchCreate},
+	})
+	if !errors.Is(err, ErrBatchFailed) {
+		t.Fatalf("expected ErrBatchFailed, got %v", err)
+	}
+	var transition *TransitionError
+	var invalid ErrInvalid
+	switch {
+	case res.Results[0].Err != nil:
+		t.Errorf("expected the valid create to carry no error, got %v", res.Results[0].Err)
+	case !errors.As(res.Results[1].Err, &transition):
+		t.Errorf("expected a workflow error, got %v", res.Results[1].Err)
+	case !errors.Is(res.Results[2].Err, ErrHasChildren):
+		t.Errorf("expected ErrHasChildren, got %v", res.Results[2].Err)
+	case !errors.As(res.Results[3].Err, &invalid):
+		t.Errorf("expected a todo named twice to be invalid, got %v", res.Results[3].Err)
+	case !errors.As(res.Results[4].Err, &invalid):
+		t.Errorf("expected a create without todo to be invalid, got %v", res.Results[4].Err)
+	}
+	if list, _ := s.List(ctx, cache.ListOptions{}); len(list) != 3 {
+		t.Errorf("expected nothing applied, got %+v", list)
+	}
+
+	// a stale version is only caught by the store and still aborts everything
+	res, err = s.Batch(ctx, []BatchOp{
+		{Op: BatchCreate, Todo: &model.Todo{Name: "new"}},
+		{Op: BatchUpdate, ID: a.ID, Todo: &model.Todo{Name: "a2", Version: 7}},
+	})
+	if !errors.Is(err, ErrBatchFailed) || !errors.Is(res.Results[1].Err, cache.ErrConflict) {
+		t.Fatalf("expected a conflict on the update, got %v and %+v", err, res)
+	}
+	if list, _ := s.List(ctx, cache.ListOptions{}); len(list) != 3 {
+		t.Errorf("expected nothing applied, got %+v", list)
+	}
+	if entries, _ := s.Audit(ctx, cache.AuditOptions{AfterID: 3}); len(entries) != 0 {
+		t.Errorf("expected nothing audited, got %+v", entries)
+	}
+
+	if _, err := s.Batch(ctx, nil); !errors.As(err, &invalid) {
+		t.Errorf("expected an empty batch to be invalid, got %v", err)
+	}
+}
+
+func TestService_Batch_SeesEarlierOps(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewInMemoryStore()
+	s := NewService(store)
+	parent := &model.Todo{Name: "parent"}
+	s.Create(ctx, parent)
+	other := &model.Todo{Name: "other"}
+	s.Create(ctx, other)
+
+	// a todo cannot be put under a parent an earlier operation deleted
+	res, err := s.Batch(ctx, []BatchOp{
+		{Op: BatchDelete, ID: parent.ID},
+		{Op: BatchCreate, Todo: &model.Todo{Name: "child", ParentID: parent.ID}},
+		{Op: BatchUpdate, ID: other.ID, Todo: &model.Todo{Name: "other", ParentID: parent.ID}},
+	})
+	if !errors.Is(err, ErrBatchFailed) {
+		t.Fatalf("expected ErrBatchFailed, got %v", err)
+	}
+	if res.Results[0].Err != nil || res.Results[1].Err == nil || res.Results[2].Err == nil {
+		t.Fatalf("expected the create and update under the deleted parent to fail, got %+v", res.Results)
+	}
+	if list, _ := s.List(ctx, cache.ListOptions{}); len(list) != 2 {
+		t.Errorf("expected nothing applied, got %+v", list)
+	}
+
+	// nor can a parent be deleted once an earlier operation gave it a child
+	res, err = s.Batch(ctx, []BatchOp{
+		{Op: BatchCreate, Todo: &model.Todo{Name: "child", ParentID: parent.ID}},
+		{Op: BatchDelete, ID: parent.ID},
+	})
+	if !errors.Is(err, ErrBatchFailed) || !errors.Is(res.Results[1].Err, ErrHasChildren) {
+		t.Fatalf("expected ErrHasChildren on the delete, got %v and %+v", err, res)
+	}
+}
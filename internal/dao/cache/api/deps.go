@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// ErrBlocked is returned when completing a todo whose blockers are still open
+var ErrBlocked = errors.New("todo is blocked by open dependencies")
+
+// Graph is the dependency DAG around Root: every todo that transitively
+// blocks it or is blocked by it, and the edges between them
+type Graph struct {
+	Root  int64              `json:"root"`
+	Nodes []model.Todo       `json:"nodes"`
+	Edges []model.Dependency `json:"edges"`
+}
+
+// AddDependency makes todoID blocked by blockedBy, refusing edges that
+// would close a cycle
+func (s *Service) AddDependency(ctx context.Context, todoID, blockedBy int64) error {
+	return s.inTx(ctx, func(tx *Service) error { return tx.addDependency(ctx, todoID, blockedBy) })
+}
+
+// addDependency is AddDependency inside a transaction
+func (s *Service) addDependency(ctx context.Context, todoID, blockedBy int64) error {
+	if _, err := s.store.Get(ctx, todoID); err != nil {
+		return err
+	}
+	if todoID == blockedBy {
+		return ErrInvalid("a todo cannot block itself")
+	}
+	if _, err := s.store.Get(ctx, blockedBy); err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return ErrInvalid(fmt.Sprintf("blocker %d not found", blockedBy))
+		}
+		return err
+	}
+
+	// blockedBy must not already (transitively) wait on todoID
+	cyclic, err := s.reaches(ctx, blockedBy, todoID, s.store.Blockers)
+	if err != nil {
+		return err
+	}
+	if cyclic {
+		return ErrInvalid(fmt.Sprintf("dependency would create a cycle: %d already waits on %d", blockedBy, todoID))
+	}
+	return s.store.AddDependency(ctx, todoID, blockedBy)
+}
+
+// RemoveDependency drops the "todoID is blocked by blockedBy" edge
+func (s *Service) RemoveDependency(ctx context.Context, todoID, blockedBy int64) error {
+	return s.store.RemoveDependency(ctx, todoID, blockedBy)
+}
+
+// DependencyGraph returns the dependency DAG reachable from id in both
+// directions
+func (s *Service) DependencyGraph(ctx context.Context, id int64) (*Graph, error) {
+	root, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{Root: id, Nodes: []model.Todo{*root}, Edges: []model.Dependency{}}
+	seen := map[int64]bool{id: true}
+	edges := make(map[model.Dependency]bool)
+
+	// walk upstream (blockers) and downstream (dependents) separately so
+	// unrelated branches of a shared blocker are not pulled in
+	for _, upstream := range []bool{true, false} {
+		queue := []int64{id}
+		visited := map[int64]bool{id: true}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			next, err := s.store.Dependents(ctx, cur)
+			if upstream {
+				next, err = s.store.Blockers(ctx, cur)
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range next {
+				e := model.Dependency{TodoID: n, BlockedBy: cur}
+				if upstream {
+					e = model.Dependency{TodoID: cur, BlockedBy: n}
+				}
+				edges[e] = true
+				if visited[n] {
+					continue
+				}
+				visited[n] = true
+				queue = append(queue, n)
+				if !seen[n] {
+					seen[n] = true
+					t, err := s.store.Get(ctx, n)
+					if err != nil {
+						return nil, err
+					}
+					g.Nodes = append(g.Nodes, *t)
+				}
+			}
+		}
+	}
+
+	for e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].TodoID != g.Edges[j].TodoID {
+			return g.Edges[i].TodoID < g.Edges[j].TodoID
+		}
+		return g.Edges[i].BlockedBy < g.Edges[j].BlockedBy
+	})
+	return g, nil
+}
+
+// checkBlockers returns ErrBlocked when t is being completed while one of
+// its blockers is still open
+func (s *Service) checkBlockers(ctx context.Context, t *model.Todo, cur *model.Todo) error {
+	if t.Status != model.Completed || cur.Status == model.Completed {
+		return nil
+	}
+	blockers, err := s.store.Blockers(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	var open []int64
+	for _, id := range blockers {
+		b, err := s.store.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if b.Status != model.Completed {
+			open = append(open, id)
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("%w: %v", ErrBlocked, open)
+	}
+	return nil
+}
+
+// reaches reports whether to can be reached from from by following next
+func (s *Service) reaches(ctx context.Context, from, to int64, next func(context.Context, int64) ([]int64, error)) (bool, error) {
+	visited := map[int64]bool{from: true}
+	queue := []int64{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			return true, nil
+		}
+		ids, err := next(ctx, cur)
+		if err != nil {
+			return false, err
+		}
+		for _, id := range ids {
+			if !visited[id] {
+				visited[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+	return false, nil
+}
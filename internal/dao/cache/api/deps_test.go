@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestService_Dependencies(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore())
+	design, _ := s.Create(ctx, &model.Todo{Name: "design"})
+	build, _ := s.Create(ctx, &model.Todo{Name: "build"})
+	ship, _ := s.Create(ctx, &model.Todo{Name: "ship"})
+	docs, _ := s.Create(ctx, &model.Todo{Name: "docs"})
+
+	// ship <- build <- design, docs <- design
+	for _, d := range [][2]int64{{build, design}, {ship, build}, {docs, design}} {
+		if err := s.AddDependency(ctx, d[0], d[1]); err != nil {
+			t.Fatalf("add %v failed: %v", d, err)
+		}
+	}
+
+	var invalid ErrInvalid
+	if err := s.AddDependency(ctx, design, ship); !errors.As(err, &invalid) {
+		t.Errorf("expected cycle to be rejected, got %v", err)
+	}
+	if err := s.AddDependency(ctx, ship, ship); !errors.As(err, &invalid) {
+		t.Errorf("expected self dependency to be rejected, got %v", err)
+	}
+	if err := s.AddDependency(ctx, ship, 999); !errors.As(err, &invalid) {
+		t.Errorf("expected unknown blocker to be rejected, got %v", err)
+	}
+	if err := s.AddDependency(ctx, 999, ship); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for unknown todo, got %v", err)
+	}
+
+	// build cannot be completed while design is open
+	got, _ := s.Get(ctx, build)
+	got.Status = model.Completed
+	if err := s.Update(ctx, got); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected ErrBlocked, got %v", err)
+	}
+	d, _ := s.Get(ctx, design)
+	d.Status = model.Completed
+	if err := s.Update(ctx, d); err != nil {
+		t.Fatalf("complete design failed: %v", err)
+	}
+	got, _ = s.Get(ctx, build)
+	got.Status = model.Completed
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatalf("expected build to complete once unblocked, got %v", err)
+	}
+
+	g, err := s.DependencyGraph(ctx, build)
+	if err != nil {
+		t.Fatalf("graph failed: %v", err)
+	}
+	if len(g.Nodes) != 3 || g.Nodes[0].ID != design || g.Nodes[1].ID != build || g.Nodes[2].ID != ship {
+		t.Errorf("expected design, build and ship in the graph, got %+v", g.Nodes)
+	}
+	want := []model.Dependency{{TodoID: build, BlockedBy: design}, {TodoID: ship, BlockedBy: build}}
+	if len(g.Edges) != 2 || g.Edges[0] != want[0] || g.Edges[1] != want[1] {
+		t.Errorf("expected edges %v, got %v", want, g.Edges)
+	}
+
+	if err := s.RemoveDependency(ctx, ship, build); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if err := s.RemoveDependency(ctx, ship, build); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound removing twice, got %v", err)
+	}
+
+	// deleting a todo drops its dependencies
+	if err := s.Delete(ctx, design); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if g, _ := s.DependencyGraph(ctx, docs); len(g.Edges) != 0 {
+		t.Errorf("expected no edges after deleting the blocker, got %v", g.Edges)
+	}
+}
+
+func TestService_Dependencies_RestoreCycle(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore())
+	a, _ := s.Create(ctx, &model.Todo{Name: "a"})
+	b, _ := s.Create(ctx, &model.Todo{Name: "b"})
+	c, _ := s.Create(ctx, &model.Todo{Name: "c"})
+
+	// b <- a <- c; with a in the trash, c may wait on b
+	s.AddDependency(ctx, b, a)
+	s.AddDependency(ctx, a, c)
+	if err := s.Delete(ctx, a); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := s.AddDependency(ctx, c, b); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	var invalid ErrInvalid
+	if _, err := s.Restore(ctx, a); !errors.As(err, &invalid) {
+		t.Fatalf("expected the restore closing a cycle to be rejected, got %v", err)
+	}
+	if _, err := s.Get(ctx, a); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected a to stay in the trash, got %v", err)
+	}
+
+	s.RemoveDependency(ctx, c, b)
+	if _, err := s.Restore(ctx, a); err != nil {
+		t.Errorf("expected the restore to succeed without the cycle, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// MaxImportSize caps the number of todos in one import
+const MaxImportSize = 10000
+
+// ImportStatus is what an import did with one todo
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created"
+	ImportSkipped ImportStatus = "skipped" // a duplicate of an existing or earlier todo
+	ImportInvalid ImportStatus = "invalid"
+)
+
+// ImportRow is the outcome of one imported todo. Row is its position in
+// the import, starting at 1; ID is only set once the todo was stored.
+type ImportRow struct {
+	Row    int          `json:"row"`
+	Status ImportStatus `json:"status" enums:"created,skipped,invalid"`
+	ID     int64        `json:"id,omitempty"`
+	Name   string       `json:"name"`
+	Reason string       `json:"reason,omitempty"`
+}
+
+// ImportReport is the outcome of an import. In a dry run, and when a row
+// was invalid, nothing was stored and the created rows are those that
+// would have been.
+type ImportReport struct {
+	DryRun  bool        `json:"dry_run"`
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Invalid int         `json:"invalid"`
+	Rows    []ImportRow `json:"rows"`
+	Changes []Change    `json:"-"` // every change made, side effects included
+}
+
+// ErrImportInvalid is returned with the report when a row of an import was
+// invalid and nothing was imported
+var ErrImportInvalid = errors.New("import has invalid rows, nothing was imported")
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// Import creates todos as new top-level todos in a single transaction,
+// skipping those with the name and due date of a live todo or of an
+// earlier row. Names compare case-insensitively and due dates by day; a
+// todo without a due date duplicates any todo of the same name. IDs,
+// parents and timestamps in todos are ignored. A dry run validates and
+// reports without storing anything. Like Batch, the changes are collected
+// in the report instead of being reported to the broadcaster.
+func (s *Service) Import(ctx context.Context, todos []model.Todo, dryRun bool) (*ImportReport, error) {
+	if len(todos) == 0 {
+		return nil, ErrInvalid("import has no todos")
+	}
+	if len(todos) > MaxImportSize {
+		return nil, ErrInvalid(fmt.Sprintf("import has more than %d todos", MaxImportSize))
+	}
+
+	rep := &ImportReport{DryRun: dryRun, Rows: make([]ImportRow, len(todos))}
+	changes := &changeLog{}
+	quiet := *s
+	quiet.broadcaster = changes
+	err := quiet.inTx(ctx, func(tx *Service) error {
+		live, err := tx.store.List(ctx, cache.ListOptions{})
+		if err != nil {
+			return err
+		}
+		seen := newDuplicates()
+		for _, t := range live {
+			seen.add(t, fmt.Sprintf("todo %d", t.ID))
+		}
+
+		for i, in := range todos {
+			r := &rep.Rows[i]
+			r.Row, r.Name = i+1, in.Name
+			t := model.Todo{
+				Name:        in.Name,
+				Description: in.Description,
+				DueDate:     in.DueDate,
+				Status:      in.Status,
+				Priority:    in.Priority,
+				Tags:        in.Tags,
+				Recurrence:  in.Recurrence,
+			}
+			if dup, ok := seen.find(t); ok {
+				r.Status, r.Reason = ImportSkipped, "duplicate of "+dup
+				rep.Skipped++
+				continue
+			}
+			key := t
+			if err := tx.createRow(ctx, &t); err != nil {
+				var invalid ErrInvalid
+				var transition *TransitionError
+				if !errors.As(err, &invalid) && !errors.As(err, &transition) {
+					return err
+				}
+				r.Status, r.Reason = ImportInvalid, err.Error()
+				rep.Invalid++
+				continue
+			}
+			r.Status, r.ID = ImportCreated, t.ID
+			rep.Created++
+			seen.add(key, fmt.Sprintf("row %d", r.Row))
+		}
+
+		if rep.Invalid > 0 {
+			return ErrImportInvalid
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) || errors.Is(err, ErrImportInvalid) {
+		// the IDs were rolled back with the todos
+		for i := range rep.Rows {
+			rep.Rows[i].ID = 0
+		}
+		if errors.Is(err, errDryRun) {
+			return rep, nil
+		}
+		return rep, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	rep.Changes = changes.changes
+	return rep, nil
+}
+
+// createRow creates one imported todo inside the import transaction
+func (s *Service) createRow(ctx context.Context, t *model.Todo) error {
+	if err := s.prepareCreate(ctx, t); err != nil {
+		return err
+	}
+	id, err := s.store.Create(ctx, t)
+	if err != nil {
+		return err
+	}
+	t.ID = id
+	s.broadcaster.BroadcastCreate(t)
+	return s.finishCreate(ctx, t)
+}
+
+// duplicates finds todos with the name and due date of one seen before
+type duplicates struct {
+	byDay  map[[2]string]string // name and due day to what was seen
+	byName map[string]string
+}
+
+func newDuplicates() *duplicates {
+	return &duplicates{byDay: make(map[[2]string]string), byName: make(map[string]string)}
+}
+
+// add remembers t as what
+func (d *duplicates) add(t model.Todo, what string) {
+	name := strings.ToLower(strings.TrimSpace(t.Name))
+	if _, ok := d.byName[name]; !ok {
+		d.byName[name] = what
+	}
+	key := [2]string{name, dueDay(t)}
+	if _, ok := d.byDay[key]; !ok {
+		d.byDay[key] = what
+	}
+}
+
+// find returns what t duplicates
+func (d *duplicates) find(t model.Todo) (string, bool) {
+	name := strings.ToLower(strings.TrimSpace(t.Name))
+	if t.DueDate.IsZero() {
+		what, ok := d.byName[name]
+		return what, ok
+	}
+	what, ok := d.byDay[[2]string{name, dueDay(t)}]
+	return what, ok
+}
+
+// dueDay is the UTC day t is due, empty when it has no due date
+func dueDay(t model.Todo) string {
+	if t.DueDate.IsZero() {
+		return ""
+	}
+	return t.DueDate.UTC().Format("2006-01-02")
+}
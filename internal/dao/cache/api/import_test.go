@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestService_Import(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore())
+	due := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s.Create(ctx, &model.Todo{Name: "Pay rent", DueDate: due})
+
+	todos := []model.Todo{
+		{Name: "pay rent", DueDate: due.Add(8 * time.Hour)}, // same day
+		{Name: "Pay rent", DueDate: due.AddDate(0, 1, 0)},
+		{ID: 7, Name: "Water plants", ParentID: 99, Tags: []string{"home"}},
+		{Name: "water plants"},
+		{Name: "Call mom", Status: model.Completed, Priority: 1},
+	}
+
+	rep, err := s.Import(ctx, todos, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if rep.Created != 3 || rep.Skipped != 2 || rep.Invalid != 0 || !rep.DryRun {
+		t.Fatalf("unexpected dry run report %+v", rep)
+	}
+	if list, _ := s.List(ctx, cache.ListOptions{}); len(list) != 1 {
+		t.Fatalf("expected the dry run to store nothing, got %+v", list)
+	}
+	if r := rep.Rows[0]; r.Status != ImportSkipped || r.Reason != "duplicate of todo 1" {
+		t.Errorf("unexpected row %+v", r)
+	}
+	if r := rep.Rows[3]; r.Status != ImportSkipped || r.Reason != "duplicate of row 3" {
+		t.Errorf("unexpected row %+v", r)
+	}
+
+	rep, err = s.Import(ctx, todos, false)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if rep.Created != 3 || len(rep.Changes) != 3 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	plants, err := s.Get(ctx, rep.Rows[2].ID)
+	if err != nil || plants.ParentID != 0 || plants.Tags[0] != "home" {
+		t.Errorf("expected a new top-level todo, got %+v, %v", plants, err)
+	}
+	if mom, _ := s.Get(ctx, rep.Rows[4].ID); mom.Status != model.Completed || mom.Progress != 100 {
+		t.Errorf("expected the completed todo imported as such, got %+v", mom)
+	}
+
+	// importing the same file again creates nothing
+	if rep, _ = s.Import(ctx, todos, false); rep.Created != 0 || rep.Skipped != 5 {
+		t.Errorf("expected every row skipped the second time, got %+v", rep)
+	}
+}
+
+func TestService_Import_Invalid(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore())
+
+	rep, err := s.Import(ctx, []model.Todo{
+		{Name: "fine"},
+		{Name: ""},
+		{Name: "odd", Status: "archived"},
+		{Name: "weird", Recurrence: "FREQ=HOURLY"},
+	}, false)
+	if !errors.Is(err, ErrImportInvalid) {
+		t.Fatalf("expected ErrImportInvalid, got %v", err)
+	}
+	if rep.Invalid != 3 || rep.Rows[0].Status != ImportCreated || rep.Rows[0].ID != 0 {
+		t.Errorf("unexpected report %+v", rep)
+	}
+	for _, r := range rep.Rows[1:] {
+		if r.Status != ImportInvalid || r.Reason == "" {
+			t.Errorf("expected row %d invalid with a reason, got %+v", r.Row, r)
+		}
+	}
+	if list, _ := s.List(ctx, cache.ListOptions{}); len(list) != 0 {
+		t.Errorf("expected nothing imported, got %+v", list)
+	}
+
+	if _, err := s.Import(ctx, nil, false); err == nil {
+		t.Error("expected an empty import to fail")
+	}
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// MergePatch applies an RFC 7396 JSON merge patch to the todo with the given
+// id and stores the result. A non-zero version must match the stored one.
+func (s *Service) MergePatch(ctx context.Context, id int64, patch []byte, version int64) (*model.Todo, error) {
+	p, err := decodeJSON(patch)
+	if err != nil {
+		return nil, ErrInvalid("invalid merge patch: " + err.Error())
+	}
+	return s.patch(ctx, id, version, func(doc interface{}) (interface{}, error) {
+		return mergePatch(doc, p), nil
+	})
+}
+
+// JSONPatch applies an RFC 6902 JSON patch document to the todo with the
+// given id and stores the result. A non-zero version must match the stored one.
+func (s *Service) JSONPatch(ctx context.Context, id int64, patch []byte, version int64) (*model.Todo, error) {
+	var ops []patchOp
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	dec.UseNumber()
+	if err := dec.Decode(&ops); err != nil {
+		return nil, ErrInvalid("invalid json patch: " + err.Error())
+	}
+	return s.patch(ctx, id, version, func(doc interface{}) (interface{}, error) {
+		for i, op := range ops {
+			var err error
+			if doc, err = op.apply(doc); err != nil {
+				return nil, ErrInvalid(fmt.Sprintf("json patch operation %d (%s %s): %v", i, op.Op, op.Path, err))
+			}
+		}
+		return doc, nil
+	})
+}
+
+// patch runs apply on the JSON form of the stored todo and writes the result
+// back in the same transaction, so no concurrent update is lost
+func (s *Service) patch(ctx context.Context, id int64, version int64, apply func(interface{}) (interface{}, error)) (*model.Todo, error) {
+	var next *model.Todo
+	err := s.inTx(ctx, func(tx *Service) (err error) {
+		next, err = tx.applyPatch(ctx, id, version, apply)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// applyPatch is patch inside a transaction
+func (s *Service) applyPatch(ctx context.Context, id int64, version int64, apply func(interface{}) (interface{}, error)) (*model.Todo, error) {
+	cur, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != cur.Version {
+		return nil, cache.ErrConflict
+	}
+
+	raw, err := json.Marshal(cur)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err = apply(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var next model.Todo
+	if err := json.Unmarshal(raw, &next); err != nil {
+		return nil, ErrInvalid("patched document is not a valid todo: " + err.Error())
+	}
+
+	// id and version are server-managed and cannot be patched
+	next.ID = cur.ID
+	next.Version = cur.Version
+	if next.Name == "" {
+		return nil, ErrInvalid("name is required")
+	}
+
+	if err := s.Update(ctx, &next); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// decodeJSON decodes b into generic values, keeping numbers exact
+func decodeJSON(b []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7396 section 2
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// patchOp is one RFC 6902 operation
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (op patchOp) value() (interface{}, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	return decodeJSON(op.Value)
+}
+
+// apply runs the operation against doc and returns the new document
+func (op patchOp) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, v)
+	case "remove":
+		return removeAt(doc, path)
+	case "replace":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = removeAt(doc, path); err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, v)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := getAt(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, fmt.Errorf("cannot move a value into one of its children")
+			}
+			if doc, err = removeAt(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			// copy must not alias the source
+			raw, _ := json.Marshal(v)
+			v, _ = decodeJSON(raw)
+		}
+		return addAt(doc, path, v)
+	case "test":
+		want, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := getAt(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(got, want) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped tokens
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func getAt(doc interface{}, path []string) (interface{}, error) {
+	for _, tok := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[tok]
+			if !ok {
+				return nil, fmt.Errorf("path not found")
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(tok, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path not found")
+		}
+	}
+	return doc, nil
+}
+
+// updateParent walks to the container holding the last token of path and
+// replaces it with what fn returns, rebuilding slices on the way back up
+func updateParent(doc interface{}, path []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("path not found")
+		}
+		c, err := updateParent(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = c
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		c, err := updateParent(node[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = c
+		return node, nil
+	}
+	return nil, fmt.Errorf("path not found")
+}
+
+func addAt(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	return updateParent(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[key] = v
+			return node, nil
+		case []interface{}:
+			if key == "-" {
+				return append(node, v), nil
+			}
+			i, err := arrayIndex(key, len(node))
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = v
+			return node, nil
+		}
+		return nil, fmt.Errorf("path not found")
+	})
+}
+
+func removeAt(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+	return updateParent(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[key]; !ok {
+				return nil, fmt.Errorf("path not found")
+			}
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("path not found")
+	})
+}
+
+// arrayIndex parses an array index token and checks 0 <= index <= max
+func arrayIndex(tok string, max int) (int, error) {
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("array index %q out of range", tok)
+	}
+	return i, nil
+}
+
+// jsonEqual compares decoded JSON values, treating numbers by value
+func jsonEqual(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, _ := an.Float64()
+		bf, _ := bn.Float64()
+		return af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func newPatchFixture(t *testing.T) (*Service, int64) {
+	ctx := context.Background()
+	t.Helper()
+	s := NewService(cache.NewInMemoryStore())
+	id, err := s.Create(ctx, &model.Todo{Name: "task", Description: "desc", Priority: 3, Tags: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	return s, id
+}
+
+func TestService_MergePatch(t *testing.T) {
+	ctx := context.Background()
+	s, id := newPatchFixture(t)
+
+	got, err := s.MergePatch(ctx, id, []byte(`{"status":"in_progress","description":null}`), 0)
+	if err != nil {
+		t.Fatalf("merge patch failed: %v", err)
+	}
+	if got.Status != model.InProgress || got.Description != "" {
+		t.Fatalf("patch not applied: %+v", got)
+	}
+	if got.Priority != 3 || len(got.Tags) != 2 {
+		t.Fatalf("omitted fields must be preserved, got priority=%d tags=%v", got.Priority, got.Tags)
+	}
+	if got.Version != 2 {
+		t.Fatalf("expected version 2, got %d", got.Version)
+	}
+
+	// id and version in the patch are ignored
+	got, err = s.MergePatch(ctx, id, []byte(`{"id":42,"version":99,"name":"renamed"}`), 0)
+	if err != nil {
+		t.Fatalf("merge patch failed: %v", err)
+	}
+	if got.ID != id || got.Version != 3 || got.Name != "renamed" {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+
+	if _, err := s.MergePatch(ctx, id, []byte(`{"name":null}`), 0); err == nil {
+		t.Fatal("expected error when removing the name")
+	}
+	if _, err := s.MergePatch(ctx, id, []byte(`{"priority":"high"}`), 0); err == nil {
+		t.Fatal("expected error for a wrongly typed field")
+	}
+	if _, err := s.MergePatch(ctx, id, []byte(`{"name":"x"}`), 1); err != cache.ErrConflict {
+		t.Fatalf("expected ErrConflict for stale version, got %v", err)
+	}
+	if _, err := s.MergePatch(ctx, 999, []byte(`{"name":"x"}`), 0); err != cache.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestService_JSONPatch(t *testing.T) {
+	ctx := context.Background()
+	s, id := newPatchFixture(t)
+
+	got, err := s.JSONPatch(ctx, id, []byte(`[
+		{"op":"test","path":"/priority","value":3},
+		{"op":"replace","path":"/priority","value":7},
+		{"op":"add","path":"/tags/-","value":"c"},
+		{"op":"remove","path":"/tags/0"},
+		{"op":"copy","from":"/name","path":"/description"}
+	]`), 1)
+	if err != nil {
+		t.Fatalf("json patch failed: %v", err)
+	}
+	if got.Priority != 7 || got.Description != "task" {
+		t.Fatalf("patch not applied: %+v", got)
+	}
+	if len(got.Tags) != 2 || got.Tags[0] != "b" || got.Tags[1] != "c" {
+		t.Fatalf("unexpected tags: %v", got.Tags)
+	}
+
+	// a failing test op aborts the whole document
+	_, err = s.JSONPatch(ctx, id, []byte(`[
+		{"op":"replace","path":"/name","value":"nope"},
+		{"op":"test","path":"/priority","value":1}
+	]`), 0)
+	if _, ok := err.(ErrInvalid); !ok {
+		t.Fatalf("expected ErrInvalid for failed test op, got %v", err)
+	}
+	cur, _ := s.Get(ctx, id)
+	if cur.Name != "task" {
+		t.Fatalf("failed patch must not be stored, got name %q", cur.Name)
+	}
+
+	for _, bad := range []string{
+		`[{"op":"remove","path":"/missing"}]`,
+		`[{"op":"add","path":"/tags/5","value":"x"}]`,
+		`[{"op":"replace","path":"name","value":"x"}]`,
+		`[{"op":"frobnicate","path":"/name"}]`,
+		`[{"op":"add","path":"/name"}]`,
+		`{"op":"add"}`,
+	} {
+		if _, err := s.JSONPatch(ctx, id, []byte(bad), 0); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
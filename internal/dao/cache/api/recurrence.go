@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+	"github.com/conbanwa/todo/internal/rrule"
+)
+
+// normalizeRecurrence validates t.Recurrence and stores it in canonical form.
+// A rule whose BYDAY the occurrences can never land on from t's due date is
+// refused rather than left to end the series silently.
+func normalizeRecurrence(t *model.Todo) error {
+	if t.Recurrence == "" {
+		return nil
+	}
+	r, err := rrule.Parse(t.Recurrence)
+	if err != nil {
+		return ErrInvalid("invalid recurrence: " + err.Error())
+	}
+	start := t.DueDate
+	if start.IsZero() {
+		start = time.Now()
+	}
+	if !r.Reachable(start) {
+		return ErrInvalid(fmt.Sprintf("invalid recurrence: with INTERVAL=%d every occurrence falls on a %s, which BYDAY leaves out", r.Interval, start.Weekday()))
+	}
+	t.Recurrence = r.String()
+	return nil
+}
+
+// nextOccurrence returns the todo that follows t in its series, or nil when
+// t does not recur or the rule is exhausted. The rule moves to the new
+// todo, with COUNT decremented.
+func nextOccurrence(t *model.Todo) *model.Todo {
+	if t.Recurrence == "" {
+		return nil
+	}
+	r, err := rrule.Parse(t.Recurrence)
+	if err != nil {
+		return nil
+	}
+	prev := t.DueDate
+	if prev.IsZero() {
+		prev = time.Now()
+	}
+	due, ok := r.Next(prev)
+	if !ok {
+		return nil
+	}
+	return &model.Todo{
+		Name:        t.Name,
+		Description: t.Description,
+		DueDate:     due,
+		Priority:    t.Priority,
+		Tags:        append([]string(nil), t.Tags...),
+		ParentID:    t.ParentID,
+		Recurrence:  r.After().String(),
+	}
+}
+
+// spawnNext creates the occurrence following a recurring todo that was just
+// completed and reports it to the broadcaster
+func (s *Service) spawnNext(ctx context.Context, next *model.Todo) error {
+	if next == nil {
+		return nil
+	}
+	id, err := s.Create(ctx, next)
+	if err != nil {
+		return err
+	}
+	next.ID = id
+	if s.broadcaster != nil {
+		s.broadcaster.BroadcastCreate(next)
+	}
+	return nil
+}
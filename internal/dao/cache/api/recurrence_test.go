@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestService_Recurrence(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	store := cache.NewInMemoryStore()
+	s := NewService(store, WithBroadcaster(rec))
+
+	// Monday
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	id, err := s.Create(ctx, &model.Todo{Name: "rotate keys", DueDate: due, Tags: []string{"ops"}, Recurrence: "rrule:freq=weekly;byday=mo,th;count=3"})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	got, _ := s.Get(ctx, id)
+	if got.Recurrence != "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=3" {
+		t.Fatalf("expected canonical rule, got %q", got.Recurrence)
+	}
+
+	complete := func(id int64) {
+		t.Helper()
+		got, _ := s.Get(ctx, id)
+		got.Status = model.Completed
+		if err := s.Update(ctx, got); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+	}
+
+	wantDue := []time.Time{due.AddDate(0, 0, 3), due.AddDate(0, 0, 7)}
+	for i, want := range wantDue {
+		complete(id)
+		if len(rec.created) != i+1 {
+			t.Fatalf("expected %d occurrences broadcast, got %d", i+1, len(rec.created))
+		}
+		next := rec.created[i]
+		if !next.DueDate.Equal(want) || next.Status != model.NotStarted || next.Tags[0] != "ops" {
+			t.Fatalf("unexpected occurrence %+v, want due %s", next, want)
+		}
+		if done, _ := s.Get(ctx, id); done.Recurrence != "" {
+			t.Fatalf("expected the completed todo to hand over its rule, got %q", done.Recurrence)
+		}
+		id = next.ID
+	}
+	if got, _ := s.Get(ctx, id); got.Recurrence != "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=1" {
+		t.Fatalf("expected COUNT to count down, got %q", got.Recurrence)
+	}
+
+	// the last occurrence ends the series
+	complete(id)
+	if len(rec.created) != 2 {
+		t.Fatalf("expected no occurrence after COUNT ran out, got %d", len(rec.created))
+	}
+
+	if _, err := s.Create(ctx, &model.Todo{Name: "bad", Recurrence: "FREQ=HOURLY"}); err == nil {
+		t.Fatalf("expected invalid rule to be rejected")
+	}
+	// every seventh day from a Monday is never a Tuesday
+	var invalid ErrInvalid
+	if _, err := s.Create(ctx, &model.Todo{Name: "weekly", DueDate: due, Recurrence: "FREQ=DAILY;INTERVAL=7;BYDAY=TU"}); !errors.As(err, &invalid) {
+		t.Fatalf("expected an unreachable BYDAY to be rejected, got %v", err)
+	}
+	if _, err := s.Create(ctx, &model.Todo{Name: "weekly", DueDate: due.AddDate(0, 0, 1), Recurrence: "FREQ=DAILY;INTERVAL=7;BYDAY=TU"}); err != nil {
+		t.Fatalf("expected the rule accepted from a Tuesday, got %v", err)
+	}
+}
@@ -1,48 +1,255 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/conbanwa/todo/internal/dao/cache"
 	"github.com/conbanwa/todo/internal/model"
 )
 
-type Store interface {
-	Create(*model.Todo) (int64, error)
-	Get(int64) (*model.Todo, error)
-	Update(*model.Todo) error
-	Delete(int64) error
-	List(cache.ListOptions) ([]model.Todo, error)
+// Store is the persistence interface the service runs on
+type Store = cache.Store
+
+// Broadcaster is told about changes the service makes on its own, beyond
+// the todo a caller asked to change, such as parents whose progress rolled
+// up. transport.Hub implements it.
+type Broadcaster interface {
+	BroadcastCreate(*model.Todo)
+	BroadcastUpdate(*model.Todo)
+	BroadcastDelete(id int64)
+	BroadcastRestore(*model.Todo)
 }
 
 type Service struct {
-	store Store
+	store        Store
+	deletePolicy DeletePolicy
+	broadcaster  Broadcaster
+	workflow     *Workflow
+	caller       Caller
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithDeletePolicy sets what Delete does with todos that have subtasks
+func WithDeletePolicy(p DeletePolicy) Option {
+	return func(s *Service) { s.deletePolicy = p }
+}
+
+// WithWorkflow replaces DefaultWorkflow
+func WithWorkflow(w *Workflow) Option {
+	return func(s *Service) { s.workflow = w }
+}
+
+// WithBroadcaster reports side-effect changes to b
+func WithBroadcaster(b Broadcaster) Option {
+	return func(s *Service) { s.broadcaster = b }
 }
 
-func NewService(s Store) *Service { return &Service{store: s} }
+func NewService(s Store, opts ...Option) *Service {
+	svc := &Service{store: s, deletePolicy: DeleteBlock, workflow: DefaultWorkflow()}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
 
-func (s *Service) Create(t *model.Todo) (int64, error) {
+// inTx runs fn on a copy of the service whose store is a transaction, see
+// Store.WithTx. The changes fn reports to the broadcaster are held back
+// until the transaction committed.
+func (s *Service) inTx(ctx context.Context, fn func(tx *Service) error) error {
+	changes := &changeLog{}
+	err := s.store.WithTx(ctx, func(store Store) error {
+		tx := *s
+		tx.store, tx.broadcaster = store, changes
+		return fn(&tx)
+	})
+	if err == nil && s.broadcaster != nil {
+		changes.replay(s.broadcaster)
+	}
+	return err
+}
+
+func (s *Service) Create(ctx context.Context, t *model.Todo) (int64, error) {
+	err := s.inTx(ctx, func(tx *Service) error {
+		if err := tx.prepareCreate(ctx, t); err != nil {
+			return err
+		}
+		id, err := tx.store.Create(ctx, t)
+		if err != nil {
+			return err
+		}
+		t.ID = id
+		return tx.finishCreate(ctx, t)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return t.ID, nil
+}
+
+// prepareCreate validates a new todo and fills in its defaults
+func (s *Service) prepareCreate(ctx context.Context, t *model.Todo) error {
 	if t.Name == "" {
-		return 0, ErrInvalid("name is required")
+		return ErrInvalid("name is required")
 	}
 	if t.DueDate.IsZero() {
 		t.DueDate = time.Now().Add(24 * time.Hour)
 	}
-	return s.store.Create(t)
+	if err := s.workflow.checkCreate(t); err != nil {
+		return err
+	}
+	if err := s.checkParent(ctx, t); err != nil {
+		return err
+	}
+	if err := normalizeRecurrence(t); err != nil {
+		return err
+	}
+	t.Progress = leafProgress(t)
+	return nil
 }
 
-func (s *Service) Get(id int64) (*model.Todo, error) { return s.store.Get(id) }
+// finishCreate records a stored todo and rolls its progress up
+func (s *Service) finishCreate(ctx context.Context, t *model.Todo) error {
+	if err := s.record(ctx, model.AuditCreate, t.ID, nil, t); err != nil {
+		return err
+	}
+	return s.rollUp(ctx, t.ParentID)
+}
 
-func (s *Service) Update(t *model.Todo) error {
+func (s *Service) Get(ctx context.Context, id int64) (*model.Todo, error) {
+	return s.store.Get(ctx, id)
+}
+
+// Workflow returns the workflow status changes are checked against
+func (s *Service) Workflow() *Workflow { return s.workflow }
+
+func (s *Service) Update(ctx context.Context, t *model.Todo) error {
+	return s.inTx(ctx, func(tx *Service) error {
+		cur, next, err := tx.prepareUpdate(ctx, t)
+		if err != nil {
+			return err
+		}
+		if err := tx.store.Update(ctx, t); err != nil {
+			return err
+		}
+		return tx.finishUpdate(ctx, cur, t, next)
+	})
+}
+
+// prepareUpdate validates the change of the stored todo to t. It returns
+// the stored todo and, when t completes a recurring todo, the next
+// occurrence to create.
+func (s *Service) prepareUpdate(ctx context.Context, t *model.Todo) (cur, next *model.Todo, err error) {
 	if t.ID == 0 {
-		return ErrInvalid("id is required")
+		return nil, nil, ErrInvalid("id is required")
+	}
+	cur, err = s.store.Get(ctx, t.ID)
+	if err != nil {
+		return nil, nil, err
 	}
-	return s.store.Update(t)
+	if err := s.workflow.checkTransition(cur, t); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkParent(ctx, t); err != nil {
+		return nil, nil, err
+	}
+	// the CalDAV identity and the trash stay out of reach of a replacement;
+	// only Delete trashes a todo, with its subtasks, audit and broadcast
+	t.UID, t.CalDAVName = cur.UID, cur.CalDAVName
+	t.DeletedAt = cur.DeletedAt
+	if err := s.checkBlockers(ctx, t, cur); err != nil {
+		return nil, nil, err
+	}
+	if err := normalizeRecurrence(t); err != nil {
+		return nil, nil, err
+	}
+	// completing a recurring todo hands its rule on to the next occurrence
+	if t.Status == model.Completed && cur.Status != model.Completed {
+		next = nextOccurrence(t)
+		t.Recurrence = ""
+	}
+	if t.Progress, err = s.progress(ctx, t); err != nil {
+		return nil, nil, err
+	}
+	return cur, next, nil
+}
+
+// finishUpdate records a stored change, spawns the next occurrence and
+// rolls progress up to the old and new parents
+func (s *Service) finishUpdate(ctx context.Context, cur, t, next *model.Todo) error {
+	if err := s.record(ctx, model.AuditUpdate, t.ID, cur, t); err != nil {
+		return err
+	}
+	if err := s.spawnNext(ctx, next); err != nil {
+		return err
+	}
+	if err := s.rollUp(ctx, t.ParentID); err != nil {
+		return err
+	}
+	if cur.ParentID != t.ParentID {
+		return s.rollUp(ctx, cur.ParentID)
+	}
+	return nil
+}
+
+func (s *Service) List(ctx context.Context, opts cache.ListOptions) ([]model.Todo, error) {
+	return s.store.List(ctx, opts)
 }
 
-func (s *Service) Delete(id int64) error { return s.store.Delete(id) }
+// Search returns todos ranked by full-text relevance to query
+func (s *Service) Search(ctx context.Context, query string, limit int) ([]cache.SearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrInvalid("query is required")
+	}
+	return s.store.Search(ctx, query, limit)
+}
 
-func (s *Service) List(opts cache.ListOptions) ([]model.Todo, error) { return s.store.List(opts) }
+// Page is one page of a cursor-paginated listing. NextCursor is empty on
+// the last page.
+type Page struct {
+	Items      []model.Todo
+	NextCursor string
+}
+
+// ListPage lists one page of todos. When opts.Limit is set it fetches one
+// extra item to find out whether another page follows.
+func (s *Service) ListPage(ctx context.Context, opts cache.ListOptions) (*Page, error) {
+	for _, st := range append([]model.Status{opts.Status}, opts.Statuses...) {
+		if st != "" && !s.workflow.Has(st) {
+			return nil, ErrInvalid(fmt.Sprintf("unknown status %q", st))
+		}
+	}
+	if opts.Cursor != "" {
+		if _, err := cache.DecodeCursor(opts); err != nil {
+			return nil, ErrInvalid(err.Error())
+		}
+	}
+	if opts.Limit <= 0 {
+		items, err := s.store.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &Page{Items: items}, nil
+	}
+
+	limit := opts.Limit
+	opts.Limit++
+	items, err := s.store.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = cache.NewCursor(items[limit-1], opts)
+	}
+	return page, nil
+}
 
 type ErrInvalid string
 
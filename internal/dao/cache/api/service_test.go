@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -9,13 +11,14 @@ import (
 )
 
 func TestService_Create_Validation(t *testing.T) {
+	ctx := context.Background()
 	s := NewService(cache.NewInMemoryStore())
-	_, err := s.Create(&model.Todo{})
+	_, err := s.Create(ctx, &model.Todo{})
 	if err == nil {
 		t.Fatalf("expected error for missing name")
 	}
 
-	id, err := s.Create(&model.Todo{Name: "ok", DueDate: time.Now().Add(48 * time.Hour)})
+	id, err := s.Create(ctx, &model.Todo{Name: "ok", DueDate: time.Now().Add(48 * time.Hour)})
 	if err != nil {
 		t.Fatalf("create failed: %v", err)
 	}
@@ -23,3 +26,47 @@ func TestService_Create_Validation(t *testing.T) {
 		t.Fatalf("expected id > 0")
 	}
 }
+
+// failingAudit is a store whose audit writes fail once err is set
+type failingAudit struct {
+	*cache.InMemoryStore
+	err error
+}
+
+func (f *failingAudit) AddAudit(ctx context.Context, e *model.AuditEntry) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.InMemoryStore.AddAudit(ctx, e)
+}
+
+func (f *failingAudit) WithTx(ctx context.Context, fn func(cache.Store) error) error {
+	return f.InMemoryStore.Transact(func(tx *cache.InMemoryStore) error {
+		return fn(&failingAudit{InMemoryStore: tx, err: f.err})
+	})
+}
+
+func TestService_Update_RollsBackWithAudit(t *testing.T) {
+	ctx := context.Background()
+	store := &failingAudit{InMemoryStore: cache.NewInMemoryStore()}
+	rec := &recorder{}
+	s := NewService(store, WithBroadcaster(rec))
+	parent, _ := s.Create(ctx, &model.Todo{Name: "release"})
+	child := &model.Todo{Name: "build", ParentID: parent}
+	s.Create(ctx, child)
+
+	store.err = errors.New("disk full")
+	child.Status = model.Completed
+	if err := s.Update(ctx, child); !errors.Is(err, store.err) {
+		t.Fatalf("expected the audit error, got %v", err)
+	}
+	if got, _ := s.Get(ctx, child.ID); got.Status != model.NotStarted || got.Version != 1 {
+		t.Errorf("expected the update rolled back, got %+v", got)
+	}
+	if got, _ := s.Get(ctx, parent); got.Progress != 0 {
+		t.Errorf("expected the roll-up rolled back, got %+v", got)
+	}
+	if len(rec.updated) != 0 {
+		t.Errorf("expected nothing broadcast, got %+v", rec.updated)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// Trash lists deleted todos with the usual list options
+func (s *Service) Trash(ctx context.Context, opts cache.ListOptions) (*Page, error) {
+	opts.Deleted = true
+	return s.ListPage(ctx, opts)
+}
+
+// Restore takes id out of the trash together with the subtasks deleted with
+// it; subtasks deleted on their own before stay in the trash. A todo whose
+// parent is no longer available comes back as a top-level todo.
+// Restored subtasks are reported to the broadcaster; id itself is left to
+// the caller.
+func (s *Service) Restore(ctx context.Context, id int64) (*model.Todo, error) {
+	var t *model.Todo
+	err := s.inTx(ctx, func(tx *Service) (err error) {
+		t, err = tx.restore(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// restore is Restore inside a transaction
+func (s *Service) restore(ctx context.Context, id int64) (*model.Todo, error) {
+	deletedAt, err := s.deletedAt(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.store.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRestoredCycle(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, model.AuditRestore, id, nil, nil); err != nil {
+		return nil, err
+	}
+	if t.ParentID != 0 {
+		_, err := s.store.Get(ctx, t.ParentID)
+		if errors.Is(err, cache.ErrNotFound) {
+			before := *t
+			t.ParentID = 0
+			if err = s.store.Update(ctx, t); err == nil {
+				err = s.record(ctx, model.AuditUpdate, id, &before, t)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.restoreTree(ctx, id, deletedAt); err != nil {
+		return nil, err
+	}
+	if err := s.rollUp(ctx, t.ParentID); err != nil {
+		return nil, err
+	}
+	return s.store.Get(ctx, id)
+}
+
+// deletedAt returns when id went to the trash, or ErrNotFound if it is not
+// there
+func (s *Service) deletedAt(ctx context.Context, id int64) (time.Time, error) {
+	trash, err := s.store.List(ctx, cache.ListOptions{Deleted: true})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, t := range trash {
+		if t.ID == id {
+			return *t.DeletedAt, nil
+		}
+	}
+	return time.Time{}, cache.ErrNotFound
+}
+
+// restoreTree restores the subtasks below id that were deleted at at, by
+// the same cascade, and recomputes the progress of id from them
+func (s *Service) restoreTree(ctx context.Context, id int64, at time.Time) error {
+	trashed, err := s.store.List(ctx, cache.ListOptions{ParentID: &id, Deleted: true})
+	if err != nil {
+		return err
+	}
+	if len(trashed) == 0 {
+		return nil
+	}
+	for _, c := range trashed {
+		if !c.DeletedAt.Equal(at) {
+			continue
+		}
+		r, err := s.store.Restore(ctx, c.ID)
+		if errors.Is(err, cache.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.checkRestoredCycle(ctx, c.ID); err != nil {
+			return err
+		}
+		if err := s.record(ctx, model.AuditRestore, c.ID, nil, nil); err != nil {
+			return err
+		}
+		if s.broadcaster != nil {
+			s.broadcaster.BroadcastRestore(r)
+		}
+		if err := s.restoreTree(ctx, c.ID, at); err != nil {
+			return err
+		}
+	}
+	return s.rollUp(ctx, id)
+}
+
+// checkRestoredCycle refuses the restore of id when it closes a dependency
+// cycle. Trashed todos do not count as blockers, so edges may have been
+// added around id while it was in the trash.
+func (s *Service) checkRestoredCycle(ctx context.Context, id int64) error {
+	blockers, err := s.store.Blockers(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, b := range blockers {
+		cyclic, err := s.reaches(ctx, b, id, s.store.Blockers)
+		if err != nil {
+			return err
+		}
+		if cyclic {
+			return ErrInvalid(fmt.Sprintf("restoring %d would create a dependency cycle: %d already waits on it; remove a dependency first", id, b))
+		}
+	}
+	return nil
+}
+
+// Purge permanently removes the todos that have been in the trash for
+// longer than retention and returns how many were removed
+func (s *Service) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.store.Purge(ctx, time.Now().Add(-retention))
+}
+
+// RunPurge purges the trash now and then every interval until ctx is done
+func (s *Service) RunPurge(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.Purge(ctx, retention); err != nil {
+			log.Printf("failed to purge trash: %v", err)
+		} else if n > 0 {
+			log.Printf("purged %d todos from the trash", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
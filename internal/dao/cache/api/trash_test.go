@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestService_Trash_Restore(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	s := NewService(cache.NewInMemoryStore(), WithDeletePolicy(DeleteCascade), WithBroadcaster(rec))
+
+	root, _ := s.Create(ctx, &model.Todo{Name: "release"})
+	child, _ := s.Create(ctx, &model.Todo{Name: "notes", ParentID: root, Status: model.Completed})
+	leaf, _ := s.Create(ctx, &model.Todo{Name: "changelog", ParentID: child, Status: model.Completed})
+	other, _ := s.Create(ctx, &model.Todo{Name: "tag", ParentID: root})
+
+	if err := s.Delete(ctx, child); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if got, _ := s.Get(ctx, root); got.Progress != 0 {
+		t.Fatalf("expected progress to drop without the deleted subtask, got %d", got.Progress)
+	}
+	page, err := s.Trash(ctx, cache.ListOptions{})
+	if err != nil || len(page.Items) != 2 {
+		t.Fatalf("expected the subtree in the trash, got %+v, %v", page, err)
+	}
+
+	restored, err := s.Restore(ctx, child)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored.ParentID != root || restored.DeletedAt != nil {
+		t.Fatalf("unexpected restored todo %+v", restored)
+	}
+	if len(rec.restored) != 1 || rec.restored[0].ID != leaf {
+		t.Fatalf("expected the subtask restore broadcast, got %+v", rec.restored)
+	}
+	if got, _ := s.Get(ctx, root); got.Progress != 50 {
+		t.Fatalf("expected progress to roll up again, got %d", got.Progress)
+	}
+	if _, err := s.Restore(ctx, child); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound restoring a live todo, got %v", err)
+	}
+
+	// a subtask whose parent is still in the trash comes back top-level
+	s.Delete(ctx, other)
+	s.Delete(ctx, root)
+	restored, err = s.Restore(ctx, other)
+	if err != nil || restored.ParentID != 0 {
+		t.Fatalf("expected a top-level todo, got %+v, %v", restored, err)
+	}
+
+	if n, err := s.Purge(ctx, time.Hour); err != nil || n != 0 {
+		t.Fatalf("expected nothing old enough to purge, got %d, %v", n, err)
+	}
+	if n, err := s.Purge(ctx, -time.Second); err != nil || n != 3 {
+		t.Fatalf("expected the trashed subtree purged, got %d, %v", n, err)
+	}
+}
+
+func TestService_Restore_KeepsEarlierDeletes(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore(), WithDeletePolicy(DeleteCascade))
+
+	root, _ := s.Create(ctx, &model.Todo{Name: "release"})
+	notes, _ := s.Create(ctx, &model.Todo{Name: "notes", ParentID: root})
+	draft, _ := s.Create(ctx, &model.Todo{Name: "draft", ParentID: notes})
+	tag, _ := s.Create(ctx, &model.Todo{Name: "tag", ParentID: root})
+
+	// the draft is thrown away on purpose before the whole release
+	if err := s.Delete(ctx, draft); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := s.Delete(ctx, root); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if _, err := s.Restore(ctx, root); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	for _, id := range []int64{notes, tag} {
+		if _, err := s.Get(ctx, id); err != nil {
+			t.Errorf("expected %d restored with the cascade, got %v", id, err)
+		}
+	}
+	if _, err := s.Get(ctx, draft); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected the draft deleted before to stay in the trash, got %v", err)
+	}
+}
+
+func TestService_Update_CannotTrash(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	s := NewService(cache.NewInMemoryStore(), WithDeletePolicy(DeleteCascade), WithBroadcaster(rec))
+	parent, _ := s.Create(ctx, &model.Todo{Name: "release"})
+	s.Create(ctx, &model.Todo{Name: "notes", ParentID: parent})
+
+	// a deleted_at sent with a replacement is ignored; only Delete trashes
+	now := time.Now()
+	if err := s.Update(ctx, &model.Todo{ID: parent, Name: "release", DeletedAt: &now}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	got, err := s.Get(ctx, parent)
+	if err != nil || got.DeletedAt != nil {
+		t.Fatalf("expected the todo still live, got %+v, %v", got, err)
+	}
+	if page, _ := s.Trash(ctx, cache.ListOptions{}); len(page.Items) != 0 {
+		t.Errorf("expected an empty trash, got %+v", page.Items)
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// DeletePolicy decides what happens to subtasks when their parent is deleted
+type DeletePolicy string
+
+const (
+	// DeleteBlock refuses to delete a todo that still has subtasks
+	DeleteBlock DeletePolicy = "block"
+	// DeleteCascade deletes the whole subtree
+	DeleteCascade DeletePolicy = "cascade"
+)
+
+// ParseDeletePolicy parses a policy name; empty means DeleteBlock
+func ParseDeletePolicy(v string) (DeletePolicy, error) {
+	switch DeletePolicy(v) {
+	case "", DeleteBlock:
+		return DeleteBlock, nil
+	case DeleteCascade:
+		return DeleteCascade, nil
+	}
+	return "", fmt.Errorf("unknown delete policy %q (want block or cascade)", v)
+}
+
+// ErrHasChildren is returned by Delete under DeleteBlock when the todo has subtasks
+var ErrHasChildren = errors.New("todo has subtasks")
+
+// Children lists the direct subtasks of id with the usual list options
+func (s *Service) Children(ctx context.Context, id int64, opts cache.ListOptions) (*Page, error) {
+	if _, err := s.store.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	opts.ParentID = &id
+	return s.ListPage(ctx, opts)
+}
+
+// Delete moves id to the trash. Subtasks are handled by the delete policy;
+// under DeleteCascade they go to the trash as well.
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	return s.inTx(ctx, func(tx *Service) error { return tx.deleteTodo(ctx, id) })
+}
+
+// deleteTodo is Delete inside a transaction
+func (s *Service) deleteTodo(ctx context.Context, id int64) error {
+	cur, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	children, err := s.children(ctx, id)
+	if err != nil {
+		return err
+	}
+	// the whole cascade shares one deleted_at, see restoreTree
+	at := time.Now().UTC()
+	if len(children) > 0 {
+		if s.deletePolicy != DeleteCascade {
+			return ErrHasChildren
+		}
+		for _, c := range children {
+			if err := s.deleteTree(ctx, c.ID, at); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.store.Delete(ctx, id, at); err != nil {
+		return err
+	}
+	if err := s.record(ctx, model.AuditDelete, id, nil, nil); err != nil {
+		return err
+	}
+	return s.rollUp(ctx, cur.ParentID)
+}
+
+// deleteTree moves id and its descendants to the trash at at, deepest first
+func (s *Service) deleteTree(ctx context.Context, id int64, at time.Time) error {
+	children, err := s.children(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, c := range children {
+		if err := s.deleteTree(ctx, c.ID, at); err != nil {
+			return err
+		}
+	}
+	if err := s.store.Delete(ctx, id, at); err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := s.record(ctx, model.AuditDelete, id, nil, nil); err != nil {
+		return err
+	}
+	if s.broadcaster != nil {
+		s.broadcaster.BroadcastDelete(id)
+	}
+	return nil
+}
+
+func (s *Service) children(ctx context.Context, id int64) ([]model.Todo, error) {
+	return s.store.List(ctx, cache.ListOptions{ParentID: &id})
+}
+
+// checkParent verifies that t.ParentID exists and is not t itself or one of
+// its descendants
+func (s *Service) checkParent(ctx context.Context, t *model.Todo) error {
+	seen := make(map[int64]bool)
+	for id := t.ParentID; id != 0; {
+		if id == t.ID {
+			return ErrInvalid("parent_id would create a cycle")
+		}
+		if seen[id] {
+			// an existing cycle further up; do not loop forever
+			break
+		}
+		seen[id] = true
+		p, err := s.store.Get(ctx, id)
+		if errors.Is(err, cache.ErrNotFound) {
+			return ErrInvalid(fmt.Sprintf("parent %d not found", id))
+		}
+		if err != nil {
+			return err
+		}
+		id = p.ParentID
+	}
+	return nil
+}
+
+// leafProgress is the progress of a todo without subtasks
+func leafProgress(t *model.Todo) int {
+	if t.Status == model.Completed {
+		return 100
+	}
+	return 0
+}
+
+// progress computes t's completion percentage: the mean progress of its
+// direct subtasks, or 0/100 by status when it has none
+func (s *Service) progress(ctx context.Context, t *model.Todo) (int, error) {
+	children, err := s.children(ctx, t.ID)
+	if err != nil {
+		return 0, err
+	}
+	if len(children) == 0 {
+		return leafProgress(t), nil
+	}
+	sum := 0
+	for _, c := range children {
+		sum += c.Progress
+	}
+	return sum / len(children), nil
+}
+
+// rollUp recomputes the progress of id and its ancestors after a subtask
+// changed, stopping as soon as a value is unchanged. Every parent written
+// is reported to the broadcaster.
+func (s *Service) rollUp(ctx context.Context, id int64) error {
+	seen := make(map[int64]bool)
+	for id != 0 && !seen[id] {
+		seen[id] = true
+		p, err := s.store.Get(ctx, id)
+		if errors.Is(err, cache.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		progress, err := s.progress(ctx, p)
+		if err != nil {
+			return err
+		}
+		if progress == p.Progress {
+			return nil
+		}
+		before := *p
+		p.Progress = progress
+		if err := s.store.Update(ctx, p); err != nil {
+			return fmt.Errorf("failed to roll up progress to %d: %w", id, err)
+		}
+		if err := s.record(ctx, model.AuditUpdate, id, &before, p); err != nil {
+			return err
+		}
+		if s.broadcaster != nil {
+			s.broadcaster.BroadcastUpdate(p)
+		}
+		id = p.ParentID
+	}
+	return nil
+}
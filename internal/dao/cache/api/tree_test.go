@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// recorder is a Broadcaster that remembers what it was told
+type recorder struct {
+	created, updated, restored []model.Todo
+	deleted                    []int64
+}
+
+func (r *recorder) BroadcastCreate(t *model.Todo)  { r.created = append(r.created, *t) }
+func (r *recorder) BroadcastUpdate(t *model.Todo)  { r.updated = append(r.updated, *t) }
+func (r *recorder) BroadcastDelete(id int64)       { r.deleted = append(r.deleted, id) }
+func (r *recorder) BroadcastRestore(t *model.Todo) { r.restored = append(r.restored, *t) }
+
+func TestService_Subtasks_Progress(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+	s := NewService(cache.NewInMemoryStore(), WithBroadcaster(rec))
+
+	root, _ := s.Create(ctx, &model.Todo{Name: "release"})
+	a, _ := s.Create(ctx, &model.Todo{Name: "build", ParentID: root})
+	b, _ := s.Create(ctx, &model.Todo{Name: "test", ParentID: root})
+	b1, _ := s.Create(ctx, &model.Todo{Name: "unit", ParentID: b})
+	_, _ = s.Create(ctx, &model.Todo{Name: "e2e", ParentID: b})
+
+	if _, err := s.Create(ctx, &model.Todo{Name: "orphan", ParentID: 999}); err == nil {
+		t.Fatalf("expected error for unknown parent")
+	}
+
+	complete := func(id int64) {
+		t.Helper()
+		got, _ := s.Get(ctx, id)
+		got.Status = model.Completed
+		if err := s.Update(ctx, got); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+	}
+	progress := func(id int64) int {
+		got, _ := s.Get(ctx, id)
+		return got.Progress
+	}
+
+	complete(a)
+	if p := progress(root); p != 50 {
+		t.Fatalf("expected root at 50%%, got %d", p)
+	}
+	complete(b1)
+	if p := progress(b); p != 50 {
+		t.Fatalf("expected test at 50%%, got %d", p)
+	}
+	if p := progress(root); p != 75 {
+		t.Fatalf("expected root at 75%%, got %d", p)
+	}
+	if len(rec.updated) == 0 || rec.updated[len(rec.updated)-1].ID != root {
+		t.Fatalf("expected roll-up to broadcast the root, got %+v", rec.updated)
+	}
+
+	// a parent's own status does not override its subtasks
+	complete(b)
+	if p := progress(b); p != 50 {
+		t.Fatalf("expected test to stay at 50%%, got %d", p)
+	}
+
+	page, err := s.Children(ctx, b, cache.ListOptions{})
+	if err != nil {
+		t.Fatalf("children failed: %v", err)
+	}
+	if len(page.Items) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(page.Items))
+	}
+	if _, err := s.Children(ctx, 999, cache.ListOptions{}); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestService_Subtasks_Cycles(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(cache.NewInMemoryStore())
+	a, _ := s.Create(ctx, &model.Todo{Name: "a"})
+	b, _ := s.Create(ctx, &model.Todo{Name: "b", ParentID: a})
+	c, _ := s.Create(ctx, &model.Todo{Name: "c", ParentID: b})
+
+	for _, tc := range []struct{ id, parent int64 }{{a, a}, {a, c}, {b, c}} {
+		got, _ := s.Get(ctx, tc.id)
+		got.ParentID = tc.parent
+		var invalid ErrInvalid
+		if err := s.Update(ctx, got); !errors.As(err, &invalid) {
+			t.Errorf("moving %d under %d: expected ErrInvalid, got %v", tc.id, tc.parent, err)
+		}
+	}
+
+	// moving a subtree elsewhere is fine and re-rolls both parents
+	got, _ := s.Get(ctx, c)
+	got.ParentID = a
+	got.Status = model.Completed
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if p, _ := s.Get(ctx, a); p.Progress != 50 {
+		t.Errorf("expected a at 50%%, got %d", p.Progress)
+	}
+	if p, _ := s.Get(ctx, b); p.Progress != 0 {
+		t.Errorf("expected b back to 0%%, got %d", p.Progress)
+	}
+}
+
+func TestService_Delete_Policy(t *testing.T) {
+	ctx := context.Background()
+	t.Run("block", func(t *testing.T) {
+		s := NewService(cache.NewInMemoryStore())
+		root, _ := s.Create(ctx, &model.Todo{Name: "root"})
+		child, _ := s.Create(ctx, &model.Todo{Name: "child", ParentID: root})
+
+		if err := s.Delete(ctx, root); !errors.Is(err, ErrHasChildren) {
+			t.Fatalf("expected ErrHasChildren, got %v", err)
+		}
+		if err := s.Delete(ctx, child); err != nil {
+			t.Fatalf("delete child failed: %v", err)
+		}
+		if err := s.Delete(ctx, root); err != nil {
+			t.Fatalf("delete root failed: %v", err)
+		}
+	})
+
+	t.Run("cascade", func(t *testing.T) {
+		rec := &recorder{}
+		s := NewService(cache.NewInMemoryStore(), WithDeletePolicy(DeleteCascade), WithBroadcaster(rec))
+		root, _ := s.Create(ctx, &model.Todo{Name: "root"})
+		child, _ := s.Create(ctx, &model.Todo{Name: "child", ParentID: root})
+		grandchild, _ := s.Create(ctx, &model.Todo{Name: "grandchild", ParentID: child})
+		other, _ := s.Create(ctx, &model.Todo{Name: "other"})
+
+		if err := s.Delete(ctx, root); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+		for _, id := range []int64{root, child, grandchild} {
+			if _, err := s.Get(ctx, id); !errors.Is(err, cache.ErrNotFound) {
+				t.Errorf("expected %d to be deleted, got %v", id, err)
+			}
+		}
+		if _, err := s.Get(ctx, other); err != nil {
+			t.Errorf("expected unrelated todo to survive, got %v", err)
+		}
+		if len(rec.deleted) != 2 || rec.deleted[0] != grandchild || rec.deleted[1] != child {
+			t.Errorf("expected descendants broadcast deepest first, got %v", rec.deleted)
+		}
+	})
+}
+
+func TestParseDeletePolicy(t *testing.T) {
+	if p, err := ParseDeletePolicy(""); err != nil || p != DeleteBlock {
+		t.Errorf("expected default block, got %q, %v", p, err)
+	}
+	if p, err := ParseDeletePolicy("cascade"); err != nil || p != DeleteCascade {
+		t.Errorf("expected cascade, got %q, %v", p, err)
+	}
+	if _, err := ParseDeletePolicy("nuke"); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
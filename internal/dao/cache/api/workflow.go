@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// State is one status a todo can be in
+type State struct {
+	Name  model.Status `json:"name"`
+	Label string       `json:"label,omitempty"`
+}
+
+// Workflow lists the statuses a todo can have and which status changes are
+// allowed. A status missing from Transitions has no outgoing transitions;
+// moving to the current status is always allowed.
+type Workflow struct {
+	States      []State                         `json:"states"`
+	Initial     model.Status                    `json:"initial"`
+	Transitions map[model.Status][]model.Status `json:"transitions"`
+}
+
+// DefaultWorkflow is the built-in workflow: the three model statuses with
+// every transition between them allowed
+func DefaultWorkflow() *Workflow {
+	all := []model.Status{model.NotStarted, model.InProgress, model.Completed}
+	w := &Workflow{
+		States: []State{
+			{Name: model.NotStarted, Label: "Not Started"},
+			{Name: model.InProgress, Label: "In Progress"},
+			{Name: model.Completed, Label: "Completed"},
+		},
+		Initial:     model.NotStarted,
+		Transitions: make(map[model.Status][]model.Status),
+	}
+	for _, from := range all {
+		for _, to := range all {
+			if to != from {
+				w.Transitions[from] = append(w.Transitions[from], to)
+			}
+		}
+	}
+	return w
+}
+
+// LoadWorkflow reads a JSON workflow definition and validates it
+func LoadWorkflow(r io.Reader) (*Workflow, error) {
+	var w Workflow
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("failed to decode workflow: %w", err)
+	}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Validate checks that the workflow is self-consistent. The completed
+// status must exist because dependencies, progress and recurrence rely on it.
+func (w *Workflow) Validate() error {
+	seen := make(map[model.Status]bool)
+	for _, st := range w.States {
+		if st.Name == "" {
+			return fmt.Errorf("workflow state without name")
+		}
+		if seen[st.Name] {
+			return fmt.Errorf("duplicate workflow state %q", st.Name)
+		}
+		seen[st.Name] = true
+	}
+	if !seen[model.Completed] {
+		return fmt.Errorf("workflow must define the %q state", model.Completed)
+	}
+	if !seen[w.Initial] {
+		return fmt.Errorf("initial state %q is not a workflow state", w.Initial)
+	}
+	for from, tos := range w.Transitions {
+		if !seen[from] {
+			return fmt.Errorf("transition from unknown state %q", from)
+		}
+		for _, to := range tos {
+			if !seen[to] {
+				return fmt.Errorf("transition from %q to unknown state %q", from, to)
+			}
+		}
+	}
+	return nil
+}
+
+// Has reports whether status is a workflow state
+func (w *Workflow) Has(status model.Status) bool {
+	return slices.ContainsFunc(w.States, func(st State) bool { return st.Name == status })
+}
+
+// Allowed returns the statuses a todo in from may move to. Todos stored
+// with a status the workflow does not know may move to any state.
+func (w *Workflow) Allowed(from model.Status) []model.Status {
+	if !w.Has(from) {
+		out := make([]model.Status, len(w.States))
+		for i, st := range w.States {
+			out[i] = st.Name
+		}
+		return out
+	}
+	if tos := w.Transitions[from]; tos != nil {
+		return tos
+	}
+	return []model.Status{}
+}
+
+// TransitionError reports a status change the workflow does not allow
+type TransitionError struct {
+	From    model.Status   `json:"from,omitempty"`
+	To      model.Status   `json:"to"`
+	Allowed []model.Status `json:"allowed"`
+}
+
+func (e *TransitionError) Error() string {
+	if e.From == "" {
+		return fmt.Sprintf("unknown status %q", e.To)
+	}
+	return fmt.Sprintf("cannot change status from %q to %q", e.From, e.To)
+}
+
+// checkCreate validates the status of a new todo, defaulting it to Initial
+func (w *Workflow) checkCreate(t *model.Todo) error {
+	if t.Status == "" {
+		t.Status = w.Initial
+	}
+	if !w.Has(t.Status) {
+		return &TransitionError{To: t.Status, Allowed: w.Allowed("")}
+	}
+	return nil
+}
+
+// checkTransition validates moving cur to t.Status. An empty status keeps
+// the current one.
+func (w *Workflow) checkTransition(cur, t *model.Todo) error {
+	if t.Status == "" {
+		t.Status = cur.Status
+	}
+	if t.Status == cur.Status {
+		return nil
+	}
+	if !w.Has(t.Status) {
+		return &TransitionError{To: t.Status, Allowed: w.Allowed("")}
+	}
+	allowed := w.Allowed(cur.Status)
+	if !slices.Contains(allowed, t.Status) {
+		return &TransitionError{From: cur.Status, To: t.Status, Allowed: allowed}
+	}
+	return nil
+}
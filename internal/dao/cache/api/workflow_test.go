@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+const reviewWorkflow = `{
+	"states": [
+		{"name": "not_started"}, {"name": "in_progress"}, {"name": "blocked"},
+		{"name": "review", "label": "In Review"}, {"name": "completed"}
+	],
+	"initial": "not_started",
+	"transitions": {
+		"not_started": ["in_progress"],
+		"in_progress": ["blocked", "review"],
+		"blocked": ["in_progress"],
+		"review": ["in_progress", "completed"]
+	}
+}`
+
+func TestLoadWorkflow(t *testing.T) {
+	w, err := LoadWorkflow(strings.NewReader(reviewWorkflow))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !w.Has("review") || w.Has("archived") {
+		t.Fatalf("unexpected states %+v", w.States)
+	}
+	if got := w.Allowed(model.Completed); len(got) != 0 {
+		t.Fatalf("expected completed to be final, got %v", got)
+	}
+
+	invalid := map[string]string{
+		"unknown field":      `{"states": [{"name": "completed"}], "initial": "completed", "final": true}`,
+		"missing completed":  `{"states": [{"name": "todo"}], "initial": "todo"}`,
+		"duplicate state":    `{"states": [{"name": "completed"}, {"name": "completed"}], "initial": "completed"}`,
+		"unknown initial":    `{"states": [{"name": "completed"}], "initial": "todo"}`,
+		"unknown transition": `{"states": [{"name": "completed"}], "initial": "completed", "transitions": {"completed": ["todo"]}}`,
+	}
+	for name, def := range invalid {
+		if _, err := LoadWorkflow(strings.NewReader(def)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestService_Workflow(t *testing.T) {
+	ctx := context.Background()
+	w, err := LoadWorkflow(strings.NewReader(reviewWorkflow))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	s := NewService(cache.NewInMemoryStore(), WithWorkflow(w))
+
+	if _, err := s.Create(ctx, &model.Todo{Name: "bad", Status: "archived"}); !isTransition(err, "", "archived") {
+		t.Fatalf("expected a transition error for an unknown status, got %v", err)
+	}
+	id, err := s.Create(ctx, &model.Todo{Name: "ship"})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	move := func(status model.Status) error {
+		cur, _ := s.Get(ctx, id)
+		cur.Status = status
+		return s.Update(ctx, cur)
+	}
+
+	err = move(model.Completed)
+	var te *TransitionError
+	if !errors.As(err, &te) || te.From != model.NotStarted || !slices.Equal(te.Allowed, []model.Status{model.InProgress}) {
+		t.Fatalf("expected not_started -> completed to be rejected, got %v", err)
+	}
+	for _, status := range []model.Status{model.InProgress, "blocked", model.InProgress, "review", model.Completed} {
+		if err := move(status); err != nil {
+			t.Fatalf("move to %s failed: %v", status, err)
+		}
+	}
+
+	// an empty status keeps the current one, even when no transition is left
+	cur, _ := s.Get(ctx, id)
+	cur.Status = ""
+	cur.Name = "shipped"
+	if err := s.Update(ctx, cur); err != nil {
+		t.Fatalf("update without status failed: %v", err)
+	}
+	if got, _ := s.Get(ctx, id); got.Status != model.Completed || got.Progress != 100 {
+		t.Fatalf("expected the todo to stay completed, got %+v", got)
+	}
+
+	if _, err := s.ListPage(ctx, cache.ListOptions{Statuses: []model.Status{"review"}}); err != nil {
+		t.Fatalf("expected custom status filter to work, got %v", err)
+	}
+	if _, err := s.ListPage(ctx, cache.ListOptions{Statuses: []model.Status{"archived"}}); !isInvalid(err) {
+		t.Fatalf("expected ErrInvalid for an unknown status filter, got %v", err)
+	}
+}
+
+func isTransition(err error, from, to model.Status) bool {
+	var te *TransitionError
+	return errors.As(err, &te) && te.From == from && te.To == to
+}
+
+func isInvalid(err error) bool {
+	var e ErrInvalid
+	return errors.As(err, &e)
+}
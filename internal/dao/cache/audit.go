@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// AuditOptions filters audit entries. Entries are returned oldest first.
+type AuditOptions struct {
+	TodoID    int64             // entries about this todo, 0 for all
+	Actor     string            // exact actor
+	Action    model.AuditAction // create, update, delete or restore
+	RequestID string            // entries written while serving this request
+	Since     time.Time         // recorded at or after
+	Until     time.Time         // recorded strictly before
+	AfterID   int64             // entries with a greater id, for paging
+	Limit     int               // maximum number of entries, 0 means no limit
+}
+
+// MatchAudit reports whether e passes every filter in opts except AfterID
+// and Limit
+func MatchAudit(e model.AuditEntry, opts AuditOptions) bool {
+	switch {
+	case opts.TodoID != 0 && e.TodoID != opts.TodoID,
+		opts.Actor != "" && e.Actor != opts.Actor,
+		opts.Action != "" && e.Action != opts.Action,
+		opts.RequestID != "" && e.RequestID != opts.RequestID,
+		!opts.Since.IsZero() && e.CreatedAt.Before(opts.Since),
+		!opts.Until.IsZero() && !e.CreatedAt.Before(opts.Until):
+		return false
+	}
+	return true
+}
+
+// AddAudit appends e to the audit log, setting its ID and CreatedAt
+func (s *InMemoryStore) AddAudit(ctx context.Context, e *model.AuditEntry) error {
+	defer s.lock()()
+	e.ID = int64(len(s.audit)) + 1
+	e.CreatedAt = time.Now().UTC()
+	s.audit = append(s.audit, *e)
+	return nil
+}
+
+// ListAudit returns the audit entries matching opts, oldest first
+func (s *InMemoryStore) ListAudit(ctx context.Context, opts AuditOptions) ([]model.AuditEntry, error) {
+	defer s.rlock()()
+	out := []model.AuditEntry{}
+	for _, e := range s.audit {
+		if e.ID <= opts.AfterID || !MatchAudit(e, opts) {
+			continue
+		}
+		out = append(out, e)
+		if opts.Limit > 0 && len(out) == opts.Limit {
+			break
+		}
+	}
+	return out, nil
+}
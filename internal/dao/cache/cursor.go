@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the decoded form of ListOptions.Cursor. It records the sort key
+// and ID of the last item of the previous page, so the next page starts
+// strictly after it regardless of inserts or deletes in between.
+type Cursor struct {
+	SortBy string `json:"s,omitempty"`
+	Order  string `json:"o,omitempty"`
+	Key    string `json:"k,omitempty"`
+	ID     int64  `json:"i"`
+}
+
+// NewCursor returns the opaque cursor pointing just after t for opts
+func NewCursor(t model.Todo, opts ListOptions) string {
+	c := Cursor{SortBy: opts.SortBy, Order: opts.SortOrder, Key: SortKey(t, opts.SortBy), ID: t.ID}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses opts.Cursor and checks that it was issued for the same
+// sort field and order, since a keyset position is meaningless otherwise.
+func DecodeCursor(opts ListOptions) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.SortBy != opts.SortBy || c.Order != opts.SortOrder {
+		return c, ErrInvalidCursor
+	}
+	if _, err := c.Todo(); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Todo rebuilds the sort-relevant fields of the item the cursor points at
+func (c Cursor) Todo() (model.Todo, error) {
+	t := model.Todo{ID: c.ID}
+	switch c.SortBy {
+	case "due_date", "created_at", "updated_at":
+		if c.Key == "" {
+			break
+		}
+		d, err := time.Parse(time.RFC3339Nano, c.Key)
+		if err != nil {
+			return t, err
+		}
+		switch c.SortBy {
+		case "due_date":
+			t.DueDate = d
+		case "created_at":
+			t.CreatedAt = d
+		case "updated_at":
+			t.UpdatedAt = d
+		}
+	case "status":
+		t.Status = model.Status(c.Key)
+	case "name":
+		t.Name = c.Key
+	case "priority":
+		p, err := strconv.Atoi(c.Key)
+		if err != nil {
+			return t, err
+		}
+		t.Priority = p
+	}
+	return t, nil
+}
+
+// SortKey returns the string form of t's sortBy field stored in cursors
+func SortKey(t model.Todo, sortBy string) string {
+	switch sortBy {
+	case "due_date":
+		return timeKey(t.DueDate)
+	case "created_at":
+		return timeKey(t.CreatedAt)
+	case "updated_at":
+		return timeKey(t.UpdatedAt)
+	case "status":
+		return string(t.Status)
+	case "name":
+		return t.Name
+	case "priority":
+		return strconv.Itoa(t.Priority)
+	}
+	return ""
+}
+
+func timeKey(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
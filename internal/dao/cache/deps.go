@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"sort"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// AddDependency records that todoID is blocked by blockedBy. Adding an
+// existing dependency is a no-op.
+func (s *InMemoryStore) AddDependency(ctx context.Context, todoID, blockedBy int64) error {
+	defer s.lock()()
+	if !s.live(todoID) || !s.live(blockedBy) {
+		return ErrNotFound
+	}
+	d := model.Dependency{TodoID: todoID, BlockedBy: blockedBy}
+	s.saveDependency(d)
+	s.deps[d] = true
+	return nil
+}
+
+// RemoveDependency deletes the dependency, or returns ErrNotFound
+func (s *InMemoryStore) RemoveDependency(ctx context.Context, todoID, blockedBy int64) error {
+	defer s.lock()()
+	d := model.Dependency{TodoID: todoID, BlockedBy: blockedBy}
+	if !s.deps[d] {
+		return ErrNotFound
+	}
+	s.saveDependency(d)
+	delete(s.deps, d)
+	return nil
+}
+
+// HasDependency reports whether todoID is recorded as blocked by blockedBy,
+// even while one of them is in the trash
+func (s *InMemoryStore) HasDependency(todoID, blockedBy int64) bool {
+	defer s.rlock()()
+	return s.deps[model.Dependency{TodoID: todoID, BlockedBy: blockedBy}]
+}
+
+// Blockers returns the ids todoID is blocked by, ascending. Todos in the
+// trash are left out.
+func (s *InMemoryStore) Blockers(ctx context.Context, todoID int64) ([]int64, error) {
+	defer s.rlock()()
+	var out []int64
+	for d := range s.deps {
+		if d.TodoID == todoID && s.live(d.BlockedBy) {
+			out = append(out, d.BlockedBy)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// Dependents returns the ids blocked by todoID, ascending. Todos in the
+// trash are left out.
+func (s *InMemoryStore) Dependents(ctx context.Context, todoID int64) ([]int64, error) {
+	defer s.rlock()()
+	var out []int64
+	for d := range s.deps {
+		if d.BlockedBy == todoID && s.live(d.TodoID) {
+			out = append(out, d.TodoID)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// dropDependencies removes every dependency involving id; callers hold mu
+func (s *InMemoryStore) dropDependencies(id int64) {
+	for d := range s.deps {
+		if d.TodoID == id || d.BlockedBy == id {
+			s.saveDependency(d)
+			delete(s.deps, d)
+		}
+	}
+}
+
+// live reports whether id exists and is not in the trash; callers hold mu
+func (s *InMemoryStore) live(id int64) bool {
+	t, ok := s.items[id]
+	return ok && t.DeletedAt == nil
+}
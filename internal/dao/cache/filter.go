@@ -1,38 +1,146 @@
 package cache
 
 import (
+	"cmp"
+	"slices"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/conbanwa/todo/internal/model"
 )
 
-// FilterAndSort filters the provided todos according to opts.Status and
-// sorts them according to opts.SortBy and opts.SortOrder.
+// FilterAndSort keeps the todos matching opts (see Match), sorts them
+// according to opts.SortBy and opts.SortOrder and applies opts.Cursor,
+// opts.Offset and opts.Limit. Ties are broken by ID so the order is fully
+// deterministic and matches the ORDER BY the SQLite store generates. An
+// undecodable cursor is ignored; stores validate it with DecodeCursor first.
 func FilterAndSort(in []model.Todo, opts ListOptions) []model.Todo {
+	now := time.Now()
 	out := make([]model.Todo, 0, len(in))
 	for _, v := range in {
-		if opts.Status != "" && v.Status != opts.Status {
-			continue
+		if matchAt(v, opts, now) {
+			out = append(out, v)
 		}
-		out = append(out, v)
 	}
 
-	cmp := func(i, j int) bool { return out[i].ID < out[j].ID }
-	switch opts.SortBy {
+	desc := opts.SortOrder == "desc"
+	sort.SliceStable(out, func(i, j int) bool {
+		if desc {
+			return Compare(out[j], out[i], opts.SortBy) < 0
+		}
+		return Compare(out[i], out[j], opts.SortBy) < 0
+	})
+
+	if opts.Cursor != "" {
+		if c, err := DecodeCursor(opts); err == nil {
+			out = afterCursor(out, c, desc)
+		}
+	}
+
+	return paginate(out, opts)
+}
+
+// afterCursor drops the leading items of a sorted slice up to and including
+// the position c points at
+func afterCursor(in []model.Todo, c Cursor, desc bool) []model.Todo {
+	at, _ := c.Todo()
+	i := sort.Search(len(in), func(i int) bool {
+		if desc {
+			return Compare(in[i], at, c.SortBy) < 0
+		}
+		return Compare(in[i], at, c.SortBy) > 0
+	})
+	return in[i:]
+}
+
+// Match reports whether t passes every filter in opts. Sorting and
+// pagination fields are ignored.
+func Match(t model.Todo, opts ListOptions) bool {
+	return matchAt(t, opts, time.Now())
+}
+
+func matchAt(t model.Todo, opts ListOptions, now time.Time) bool {
+	if (t.DeletedAt != nil) != opts.Deleted {
+		return false
+	}
+	if (opts.Status != "" || len(opts.Statuses) > 0) &&
+		t.Status != opts.Status && !slices.Contains(opts.Statuses, t.Status) {
+		return false
+	}
+	if opts.ParentID != nil && t.ParentID != *opts.ParentID {
+		return false
+	}
+	if !opts.UpdatedSince.IsZero() && t.UpdatedAt.Before(opts.UpdatedSince) {
+		return false
+	}
+	if len(opts.TagsAny) > 0 && !slices.ContainsFunc(opts.TagsAny, func(tag string) bool { return slices.Contains(t.Tags, tag) }) {
+		return false
+	}
+	for _, tag := range opts.TagsAll {
+		if !slices.Contains(t.Tags, tag) {
+			return false
+		}
+	}
+	if opts.PriorityMin != nil && t.Priority < *opts.PriorityMin {
+		return false
+	}
+	if opts.PriorityMax != nil && t.Priority > *opts.PriorityMax {
+		return false
+	}
+	if !opts.DueAfter.IsZero() && (t.DueDate.IsZero() || t.DueDate.Before(opts.DueAfter)) {
+		return false
+	}
+	if !opts.DueBefore.IsZero() && (t.DueDate.IsZero() || !t.DueDate.Before(opts.DueBefore)) {
+		return false
+	}
+	if opts.Overdue && (t.DueDate.IsZero() || !t.DueDate.Before(now) || t.Status == model.Completed) {
+		return false
+	}
+	if opts.Query != "" {
+		q := strings.ToLower(opts.Query)
+		if !strings.Contains(strings.ToLower(t.Name), q) && !strings.Contains(strings.ToLower(t.Description), q) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare orders a and b by the sortBy field (due_date, status, name,
+// priority, created_at, updated_at; anything else means id), falling back
+// to ID on ties.
+func Compare(a, b model.Todo, sortBy string) int {
+	var c int
+	switch sortBy {
 	case "due_date":
-		cmp = func(i, j int) bool { return out[i].DueDate.Before(out[j].DueDate) }
+		c = a.DueDate.Compare(b.DueDate)
 	case "status":
-		cmp = func(i, j int) bool { return out[i].Status < out[j].Status }
+		c = cmp.Compare(a.Status, b.Status)
 	case "name":
-		cmp = func(i, j int) bool { return out[i].Name < out[j].Name }
+		c = cmp.Compare(a.Name, b.Name)
+	case "priority":
+		c = cmp.Compare(a.Priority, b.Priority)
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	if c != 0 {
+		return c
 	}
+	return cmp.Compare(a.ID, b.ID)
+}
 
-	sort.SliceStable(out, func(i, j int) bool {
-		if opts.SortOrder == "desc" {
-			return !cmp(i, j)
+// paginate applies opts.Offset and opts.Limit to an already sorted slice
+func paginate(in []model.Todo, opts ListOptions) []model.Todo {
+	if opts.Offset > 0 {
+		if opts.Offset >= len(in) {
+			return in[:0]
 		}
-		return cmp(i, j)
-	})
-
-	return out
+		in = in[opts.Offset:]
+	}
+	if opts.Limit > 0 && opts.Limit < len(in) {
+		in = in[:opts.Limit]
+	}
+	return in
 }
@@ -37,3 +37,74 @@ func TestFilterAndSort_StatusAndSort(t *testing.T) {
 		t.Fatalf("unexpected name desc: %v", []string{got[0].Name, got[1].Name, got[2].Name})
 	}
 }
+
+func TestFilterAndSort_TieBreakAndPagination(t *testing.T) {
+	items := []model.Todo{
+		{ID: 3, Name: "same", Priority: 1},
+		{ID: 1, Name: "same", Priority: 2},
+		{ID: 2, Name: "other", Priority: 1},
+	}
+
+	// ties on name are broken by id, reversed for desc
+	got := FilterAndSort(items, ListOptions{SortBy: "name"})
+	if got[0].ID != 2 || got[1].ID != 1 || got[2].ID != 3 {
+		t.Fatalf("unexpected name asc: %v", []int64{got[0].ID, got[1].ID, got[2].ID})
+	}
+	got = FilterAndSort(items, ListOptions{SortBy: "name", SortOrder: "desc"})
+	if got[0].ID != 3 || got[1].ID != 1 || got[2].ID != 2 {
+		t.Fatalf("unexpected name desc: %v", []int64{got[0].ID, got[1].ID, got[2].ID})
+	}
+
+	// limit and offset apply after sorting
+	got = FilterAndSort(items, ListOptions{SortBy: "priority", Limit: 2})
+	if len(got) != 2 || got[0].ID != 2 || got[1].ID != 3 {
+		t.Fatalf("unexpected priority page 1: %v", got)
+	}
+	got = FilterAndSort(items, ListOptions{SortBy: "priority", Limit: 2, Offset: 2})
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Fatalf("unexpected priority page 2: %v", got)
+	}
+	if got = FilterAndSort(items, ListOptions{Offset: 5}); len(got) != 0 {
+		t.Fatalf("expected empty page past the end, got %v", got)
+	}
+}
+
+func TestMatch_RichFilters(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	todo := model.Todo{Name: "Deploy API", Description: "Ship it", DueDate: past, Status: model.InProgress, Priority: 4, Tags: []string{"ops", "backend"}}
+
+	two, four, five := 2, 4, 5
+	cases := []struct {
+		name string
+		opts ListOptions
+		want bool
+	}{
+		{"no filters", ListOptions{}, true},
+		{"statuses hit", ListOptions{Statuses: []model.Status{model.Completed, model.InProgress}}, true},
+		{"statuses miss", ListOptions{Statuses: []model.Status{model.Completed}}, false},
+		{"tags any", ListOptions{TagsAny: []string{"docs", "ops"}}, true},
+		{"tags any miss", ListOptions{TagsAny: []string{"docs"}}, false},
+		{"tags all", ListOptions{TagsAll: []string{"ops", "backend"}}, true},
+		{"tags all miss", ListOptions{TagsAll: []string{"ops", "docs"}}, false},
+		{"priority range", ListOptions{PriorityMin: &two, PriorityMax: &four}, true},
+		{"priority min miss", ListOptions{PriorityMin: &five}, false},
+		{"due before", ListOptions{DueBefore: time.Now()}, true},
+		{"due after miss", ListOptions{DueAfter: time.Now()}, false},
+		{"overdue", ListOptions{Overdue: true}, true},
+		{"query description", ListOptions{Query: "SHIP"}, true},
+		{"query miss", ListOptions{Query: "docs"}, false},
+	}
+	for _, c := range cases {
+		if got := Match(todo, c.opts); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+
+	todo.Status = model.Completed
+	if Match(todo, ListOptions{Overdue: true}) {
+		t.Error("completed todos are never overdue")
+	}
+	if Match(model.Todo{Name: "x"}, ListOptions{DueBefore: time.Now()}) {
+		t.Error("todos without due date should not match a due range")
+	}
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// SearchResult is one ranked full-text match
+type SearchResult struct {
+	Todo    model.Todo `json:"todo"`
+	Score   float64    `json:"score"`   // higher is more relevant
+	Snippet string     `json:"snippet"` // matching text, terms wrapped in <mark></mark>
+}
+
+// Tokenize splits s into lowercase letter/digit runs, mirroring the FTS5
+// unicode61 tokenizer closely enough for both stores to agree on matches.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Field weights for ranking: a hit in the name counts more than one in the
+// tags, which counts more than one in the description. db.SQLiteStore passes
+// the same weights to bm25().
+const (
+	NameWeight        = 3.0
+	DescriptionWeight = 1.0
+	TagsWeight        = 2.0
+)
+
+// searchIndex is a simple inverted index: term -> todo id -> weighted term
+// frequency
+type searchIndex map[string]map[int64]float64
+
+func todoTerms(t *model.Todo) map[string]float64 {
+	terms := make(map[string]float64)
+	for _, term := range Tokenize(t.Name) {
+		terms[term] += NameWeight
+	}
+	for _, term := range Tokenize(t.Description) {
+		terms[term] += DescriptionWeight
+	}
+	for _, tag := range t.Tags {
+		for _, term := range Tokenize(tag) {
+			terms[term] += TagsWeight
+		}
+	}
+	return terms
+}
+
+func (ix searchIndex) add(t *model.Todo) {
+	for term, tf := range todoTerms(t) {
+		if ix[term] == nil {
+			ix[term] = make(map[int64]float64)
+		}
+		ix[term][t.ID] = tf
+	}
+}
+
+func (ix searchIndex) remove(t *model.Todo) {
+	for term := range todoTerms(t) {
+		delete(ix[term], t.ID)
+		if len(ix[term]) == 0 {
+			delete(ix, term)
+		}
+	}
+}
+
+// search returns ids matching every query token as a prefix, scored with a
+// tf-idf sum, best first
+func (ix searchIndex) search(tokens []string, total int) []SearchResult {
+	scores := make(map[int64]float64)
+	for i, tok := range tokens {
+		hits := make(map[int64]float64)
+		for term, postings := range ix {
+			if !strings.HasPrefix(term, tok) {
+				continue
+			}
+			idf := math.Log(1 + float64(total)/float64(len(postings)))
+			for id, tf := range postings {
+				hits[id] += tf * idf
+			}
+		}
+		// implicit AND: keep only ids that matched all previous tokens
+		for id, score := range hits {
+			if _, ok := scores[id]; ok || i == 0 {
+				scores[id] += score
+			}
+		}
+		for id := range scores {
+			if _, ok := hits[id]; !ok {
+				delete(scores, id)
+			}
+		}
+	}
+
+	out := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		out = append(out, SearchResult{Todo: model.Todo{ID: id}, Score: score})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Todo.ID < out[j].Todo.ID
+	})
+	return out
+}
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// snippetWords is how many words of context a snippet keeps, like the
+// token count passed to FTS5 snippet()
+const snippetWords = 10
+
+// Snippet returns the part of t's best matching field around the first hit,
+// with every word that starts with a query token wrapped in <mark></mark>
+func Snippet(t model.Todo, tokens []string) string {
+	for _, text := range []string{t.Name, t.Description, strings.Join(t.Tags, " ")} {
+		if s, ok := snippet(text, tokens); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func snippet(text string, tokens []string) (string, bool) {
+	words := wordPattern.FindAllStringIndex(text, -1)
+	first := -1
+	marked := make([]bool, len(words))
+	for i, w := range words {
+		word := strings.ToLower(text[w[0]:w[1]])
+		for _, tok := range tokens {
+			if strings.HasPrefix(word, tok) {
+				marked[i] = true
+				if first < 0 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	start := first - snippetWords/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetWords
+	if end > len(words) {
+		end = len(words)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := words[start][0]
+	for i := start; i < end; i++ {
+		w := words[i]
+		b.WriteString(text[pos:w[0]])
+		if marked[i] {
+			b.WriteString("<mark>" + text[w[0]:w[1]] + "</mark>")
+		} else {
+			b.WriteString(text[w[0]:w[1]])
+		}
+		pos = w[1]
+	}
+	if end < len(words) {
+		b.WriteString("…")
+	} else {
+		b.WriteString(text[pos:])
+	}
+	return b.String(), true
+}
+
+// Search ranks todos matching every word of query (as a prefix) in name,
+// description or tags. A limit <= 0 returns every match.
+func (s *InMemoryStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	defer s.rlock()()
+	res := s.index.search(tokens, len(s.items))
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	for i := range res {
+		res[i].Todo = *s.items[res[i].Todo.ID]
+		res[i].Snippet = Snippet(res[i].Todo, tokens)
+	}
+	return res, nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestInMemoryStore_Search(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStore()
+	deploy, _ := s.Create(ctx, &model.Todo{Name: "Deploy release", Description: "roll out to production", Tags: []string{"ops"}})
+	docs, _ := s.Create(ctx, &model.Todo{Name: "Write docs", Description: "document the deploy process"})
+	_, _ = s.Create(ctx, &model.Todo{Name: "Groceries", Tags: []string{"home"}})
+
+	res, err := s.Search(ctx, "deploy", 0)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(res) != 2 || res[0].Todo.ID != deploy || res[1].Todo.ID != docs {
+		t.Fatalf("expected deploy then docs, got %+v", res)
+	}
+	if res[0].Snippet != "<mark>Deploy</mark> release" {
+		t.Fatalf("unexpected snippet %q", res[0].Snippet)
+	}
+	if res[1].Snippet != "document the <mark>deploy</mark> process" {
+		t.Fatalf("unexpected snippet %q", res[1].Snippet)
+	}
+
+	// every word must match, as a prefix
+	if res, _ := s.Search(ctx, "depl prod", 0); len(res) != 1 || res[0].Todo.ID != deploy {
+		t.Fatalf("expected only deploy for prefix AND query, got %+v", res)
+	}
+	// tags are indexed too
+	if res, _ := s.Search(ctx, "home", 0); len(res) != 1 || res[0].Snippet != "<mark>home</mark>" {
+		t.Fatalf("expected tag match, got %+v", res)
+	}
+	if res, _ := s.Search(ctx, "deploy", 1); len(res) != 1 {
+		t.Fatalf("expected limit to apply, got %d results", len(res))
+	}
+
+	// the index follows updates and deletes
+	got, _ := s.Get(ctx, docs)
+	got.Description = "explain the release process"
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if res, _ := s.Search(ctx, "deploy", 0); len(res) != 1 {
+		t.Fatalf("expected stale terms to be dropped, got %+v", res)
+	}
+	if err := s.Delete(ctx, deploy, time.Now()); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if res, _ := s.Search(ctx, "deploy", 0); len(res) != 0 {
+		t.Fatalf("expected no results after delete, got %+v", res)
+	}
+	if res, _ := s.Search(ctx, "  !? ", 0); len(res) != 0 {
+		t.Fatalf("expected no results for empty query, got %+v", res)
+	}
+}
+
+func TestSnippet_Window(t *testing.T) {
+	todo := model.Todo{Name: "x", Description: "one two three four five six seven eight nine ten eleven twelve thirteen"}
+	got := Snippet(todo, []string{"nine"})
+	want := "…four five six seven eight <mark>nine</mark> ten eleven twelve thirteen"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"sort"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// Snapshot is the complete state of an InMemoryStore, trash included
+type Snapshot struct {
+	NextID       int64              `json:"next_id"`
+	Todos        []model.Todo       `json:"todos"`
+	Dependencies []model.Dependency `json:"dependencies"`
+	Audit        []model.AuditEntry `json:"audit"`
+}
+
+// Snapshot copies the current state, with todos and dependencies sorted
+func (s *InMemoryStore) Snapshot() Snapshot {
+	defer s.rlock()()
+	snap := Snapshot{
+		NextID:       s.next,
+		Todos:        make([]model.Todo, 0, len(s.items)),
+		Dependencies: make([]model.Dependency, 0, len(s.deps)),
+		Audit:        append([]model.AuditEntry{}, s.audit...),
+	}
+	for _, t := range s.items {
+		snap.Todos = append(snap.Todos, *t)
+	}
+	sort.Slice(snap.Todos, func(i, j int) bool { return snap.Todos[i].ID < snap.Todos[j].ID })
+	for d := range s.deps {
+		snap.Dependencies = append(snap.Dependencies, d)
+	}
+	sort.Slice(snap.Dependencies, func(i, j int) bool {
+		a, b := snap.Dependencies[i], snap.Dependencies[j]
+		return a.TodoID < b.TodoID || (a.TodoID == b.TodoID && a.BlockedBy < b.BlockedBy)
+	})
+	return snap
+}
+
+// NewInMemoryStoreFrom returns a store holding the state of snap
+func NewInMemoryStoreFrom(snap Snapshot) *InMemoryStore {
+	s := NewInMemoryStore()
+	for _, t := range snap.Todos {
+		s.Put(t)
+	}
+	for _, d := range snap.Dependencies {
+		s.deps[d] = true
+	}
+	s.audit = append(s.audit, snap.Audit...)
+	if snap.NextID > s.next {
+		s.next = snap.NextID
+	}
+	return s
+}
+
+// Put stores t exactly as given, replacing the todo with the same ID. Unlike
+// Create and Update it assigns no ID, version or timestamps, so it can
+// replay recorded state.
+func (s *InMemoryStore) Put(t model.Todo) {
+	defer s.lock()()
+	s.saveTodo(t.ID)
+	if cur, ok := s.items[t.ID]; ok && cur.DeletedAt == nil {
+		s.index.remove(cur)
+	}
+	s.items[t.ID] = &t
+	if t.DeletedAt == nil {
+		s.index.add(&t)
+	}
+	if t.ID >= s.next {
+		s.next = t.ID + 1
+	}
+}
+
+// PutAudit appends e as given. Entries must be put in ID order.
+func (s *InMemoryStore) PutAudit(e model.AuditEntry) {
+	defer s.lock()()
+	s.audit = append(s.audit, e)
+}
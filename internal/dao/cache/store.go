@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// Store is the persistence interface behind api.Service, implemented by
+// InMemoryStore and the SQLite and event log stores. Every method takes the
+// context of the request it serves; stores doing I/O give up when it is done.
+type Store interface {
+	Create(ctx context.Context, t *model.Todo) (int64, error)
+	Get(ctx context.Context, id int64) (*model.Todo, error)
+	Update(ctx context.Context, t *model.Todo) error
+	// Delete moves a todo to the trash with at as its deleted_at; the
+	// todos of one cascade share it, see Service.Restore
+	Delete(ctx context.Context, id int64, at time.Time) error
+	Restore(ctx context.Context, id int64) (*model.Todo, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	List(ctx context.Context, opts ListOptions) ([]model.Todo, error)
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+
+	AddDependency(ctx context.Context, todoID, blockedBy int64) error
+	RemoveDependency(ctx context.Context, todoID, blockedBy int64) error
+	Blockers(ctx context.Context, todoID int64) ([]int64, error)
+	Dependents(ctx context.Context, todoID int64) ([]int64, error)
+
+	AddAudit(ctx context.Context, e *model.AuditEntry) error
+	ListAudit(ctx context.Context, opts AuditOptions) ([]model.AuditEntry, error)
+
+	// WithTx runs fn on a Store whose reads and writes form one
+	// transaction: it commits when fn returns nil and rolls back otherwise.
+	// Calling WithTx on that Store joins the running transaction. The Store
+	// must not be used once fn returned.
+	WithTx(ctx context.Context, fn func(Store) error) error
+}
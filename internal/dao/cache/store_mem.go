@@ -1,78 +1,181 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/conbanwa/todo/internal/model"
 )
 
 var ErrNotFound = errors.New("api not found")
 
+// ErrConflict is returned by Update when the caller's Version is stale
+var ErrConflict = errors.New("api version conflict")
+
 type ListOptions struct {
 	Status    model.Status
-	SortBy    string // due_date, status, name
+	SortBy    string // due_date, status, name, priority, created_at, updated_at
 	SortOrder string // asc, desc
+	Limit     int    // maximum number of items, 0 means no limit
+	Offset    int    // number of items to skip after sorting
+	Cursor    string // opaque position from a previous page, see NewCursor
+
+	// UpdatedSince keeps only todos updated at or after this time
+	UpdatedSince time.Time
+
+	Statuses    []model.Status // any of these statuses, combined with Status
+	TagsAny     []string       // at least one of these tags
+	TagsAll     []string       // every one of these tags
+	PriorityMin *int           // inclusive lower priority bound
+	PriorityMax *int           // inclusive upper priority bound
+	DueAfter    time.Time      // due at or after, excludes todos without due date
+	DueBefore   time.Time      // due strictly before, excludes todos without due date
+	Overdue     bool           // due in the past and not completed
+	Query       string         // case-insensitive substring of name or description
+	ParentID    *int64         // direct children of this todo; 0 selects top-level todos
+	Deleted     bool           // list the trash instead of live todos
 }
 
 type InMemoryStore struct {
+	*memState
+	undo *undoLog // set on the store a transaction runs on, see WithTx
+}
+
+// memState is the data of an InMemoryStore, shared with the stores its
+// transactions run on
+type memState struct {
 	mu    sync.RWMutex
 	next  int64
 	items map[int64]*model.Todo
+	index searchIndex
+	deps  map[model.Dependency]bool
+	audit []model.AuditEntry // ordered by ID
 }
 
 func NewInMemoryStore() *InMemoryStore {
-	return &InMemoryStore{items: make(map[int64]*model.Todo), next: 1}
+	return &InMemoryStore{memState: &memState{
+		items: make(map[int64]*model.Todo),
+		index: make(searchIndex),
+		deps:  make(map[model.Dependency]bool),
+		next:  1,
+	}}
 }
 
-func (s *InMemoryStore) Create(t *model.Todo) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *InMemoryStore) Create(ctx context.Context, t *model.Todo) (int64, error) {
+	defer s.lock()()
 	t.ID = s.next
+	s.saveTodo(t.ID)
 	s.next++
 	if t.Status == "" {
 		t.Status = model.NotStarted
 	}
+	t.Version = 1
+	t.CreatedAt = time.Now().UTC()
+	t.UpdatedAt = t.CreatedAt
 	// copy
 	c := *t
 	s.items[t.ID] = &c
+	s.index.add(&c)
 	return t.ID, nil
 }
 
-func (s *InMemoryStore) Get(id int64) (*model.Todo, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if v, ok := s.items[id]; ok {
+func (s *InMemoryStore) Get(ctx context.Context, id int64) (*model.Todo, error) {
+	defer s.rlock()()
+	if v, ok := s.items[id]; ok && v.DeletedAt == nil {
 		c := *v
 		return &c, nil
 	}
 	return nil, ErrNotFound
 }
 
-func (s *InMemoryStore) Update(t *model.Todo) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.items[t.ID]; !ok {
+func (s *InMemoryStore) Update(ctx context.Context, t *model.Todo) error {
+	defer s.lock()()
+	cur, ok := s.items[t.ID]
+	if !ok || cur.DeletedAt != nil {
 		return ErrNotFound
 	}
+	// a zero Version means an unconditional update
+	if t.Version != 0 && t.Version != cur.Version {
+		return ErrConflict
+	}
+	s.saveTodo(t.ID)
+	t.Version = cur.Version + 1
+	t.CreatedAt = cur.CreatedAt
+	t.UpdatedAt = time.Now().UTC()
+	// only Delete moves a todo to the trash
+	t.DeletedAt = cur.DeletedAt
 	c := *t
+	s.index.remove(cur)
 	s.items[t.ID] = &c
+	s.index.add(&c)
 	return nil
 }
 
-func (s *InMemoryStore) Delete(id int64) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.items[id]; !ok {
+// Delete moves a todo to the trash. Trashed todos are hidden from Get,
+// Update, List and Search until restored or purged; their dependencies are
+// kept so Restore brings them back.
+func (s *InMemoryStore) Delete(ctx context.Context, id int64, at time.Time) error {
+	defer s.lock()()
+	cur, ok := s.items[id]
+	if !ok || cur.DeletedAt != nil {
 		return ErrNotFound
 	}
-	delete(s.items, id)
+	s.saveTodo(id)
+	s.index.remove(cur)
+	c := *cur
+	deleted := at.UTC()
+	c.DeletedAt = &deleted
+	c.UpdatedAt = time.Now().UTC()
+	c.Version++
+	s.items[id] = &c
 	return nil
 }
 
-func (s *InMemoryStore) List(opts ListOptions) ([]model.Todo, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// Restore takes a todo out of the trash, or returns ErrNotFound if it is
+// not there
+func (s *InMemoryStore) Restore(ctx context.Context, id int64) (*model.Todo, error) {
+	defer s.lock()()
+	cur, ok := s.items[id]
+	if !ok || cur.DeletedAt == nil {
+		return nil, ErrNotFound
+	}
+	s.saveTodo(id)
+	c := *cur
+	c.DeletedAt = nil
+	c.UpdatedAt = time.Now().UTC()
+	c.Version++
+	s.items[id] = &c
+	s.index.add(&c)
+	out := c
+	return &out, nil
+}
+
+// Purge permanently removes the todos deleted before the given time together
+// with their dependencies and returns how many were removed
+func (s *InMemoryStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock()()
+	var n int64
+	for id, t := range s.items {
+		if t.DeletedAt != nil && t.DeletedAt.Before(before) {
+			s.saveTodo(id)
+			s.dropDependencies(id)
+			delete(s.items, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *InMemoryStore) List(ctx context.Context, opts ListOptions) ([]model.Todo, error) {
+	if opts.Cursor != "" {
+		if _, err := DecodeCursor(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	defer s.rlock()()
 	// copy items into a slice
 	out := make([]model.Todo, 0, len(s.items))
 	for _, v := range s.items {
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -8,14 +10,15 @@ import (
 )
 
 func TestInMemoryStore_CreateGetUpdateDelete_List(t *testing.T) {
+	ctx := context.Background()
 	s := NewInMemoryStore()
 
-	id, err := s.Create(&model.Todo{Name: "task1", DueDate: time.Now().Add(24 * time.Hour)})
+	id, err := s.Create(ctx, &model.Todo{Name: "task1", DueDate: time.Now().Add(24 * time.Hour)})
 	if err != nil {
 		t.Fatalf("create failed: %v", err)
 	}
 
-	got, err := s.Get(id)
+	got, err := s.Get(ctx, id)
 	if err != nil {
 		t.Fatalf("get failed: %v", err)
 	}
@@ -24,19 +27,20 @@ func TestInMemoryStore_CreateGetUpdateDelete_List(t *testing.T) {
 	}
 
 	got.Description = "updated"
-	if err := s.Update(got); err != nil {
+	if err := s.Update(ctx, got); err != nil {
 		t.Fatalf("update failed: %v", err)
 	}
 
-	if err := s.Delete(id); err != nil {
+	if err := s.Delete(ctx, id, time.Now()); err != nil {
 		t.Fatalf("delete failed: %v", err)
 	}
 
 	// list
-	_, _ = s.List(ListOptions{})
+	_, _ = s.List(ctx, ListOptions{})
 }
 
 func TestInMemoryStore_ListOptions_SortAndFilter(t *testing.T) {
+	ctx := context.Background()
 	s := NewInMemoryStore()
 
 	// deterministic times
@@ -44,12 +48,12 @@ func TestInMemoryStore_ListOptions_SortAndFilter(t *testing.T) {
 	t2 := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
 	t3 := time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)
 
-	_, _ = s.Create(&model.Todo{Name: "alpha", DueDate: t2, Status: model.InProgress})
-	_, _ = s.Create(&model.Todo{Name: "bravo", DueDate: t1, Status: model.NotStarted})
-	_, _ = s.Create(&model.Todo{Name: "charlie", DueDate: t3, Status: model.Completed})
+	_, _ = s.Create(ctx, &model.Todo{Name: "alpha", DueDate: t2, Status: model.InProgress})
+	_, _ = s.Create(ctx, &model.Todo{Name: "bravo", DueDate: t1, Status: model.NotStarted})
+	_, _ = s.Create(ctx, &model.Todo{Name: "charlie", DueDate: t3, Status: model.Completed})
 
 	// filter by status
-	list, err := s.List(ListOptions{Status: model.NotStarted})
+	list, err := s.List(ctx, ListOptions{Status: model.NotStarted})
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
@@ -58,26 +62,259 @@ func TestInMemoryStore_ListOptions_SortAndFilter(t *testing.T) {
 	}
 
 	// sort by due_date asc
-	list, _ = s.List(ListOptions{SortBy: "due_date", SortOrder: "asc"})
+	list, _ = s.List(ctx, ListOptions{SortBy: "due_date", SortOrder: "asc"})
 	if len(list) != 3 || list[0].Name != "bravo" || list[1].Name != "alpha" || list[2].Name != "charlie" {
 		t.Fatalf("unexpected due_date asc order: %v", []string{list[0].Name, list[1].Name, list[2].Name})
 	}
 
 	// sort by due_date desc
-	list, _ = s.List(ListOptions{SortBy: "due_date", SortOrder: "desc"})
+	list, _ = s.List(ctx, ListOptions{SortBy: "due_date", SortOrder: "desc"})
 	if list[0].Name != "charlie" || list[2].Name != "bravo" {
 		t.Fatalf("unexpected due_date desc order: %v", []string{list[0].Name, list[1].Name, list[2].Name})
 	}
 
 	// sort by name asc
-	list, _ = s.List(ListOptions{SortBy: "name", SortOrder: "asc"})
+	list, _ = s.List(ctx, ListOptions{SortBy: "name", SortOrder: "asc"})
 	if list[0].Name != "alpha" || list[1].Name != "bravo" || list[2].Name != "charlie" {
 		t.Fatalf("unexpected name asc order: %v", []string{list[0].Name, list[1].Name, list[2].Name})
 	}
 
 	// sort by status asc
-	list, _ = s.List(ListOptions{SortBy: "status", SortOrder: "asc"})
+	list, _ = s.List(ctx, ListOptions{SortBy: "status", SortOrder: "asc"})
 	if len(list) != 3 {
 		t.Fatalf("expected 3 items for status sort, got %d", len(list))
 	}
 }
+
+func TestInMemoryStore_CursorPagination(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStore()
+	for _, name := range []string{"delta", "alpha", "charlie", "alpha", "bravo"} {
+		_, _ = s.Create(ctx, &model.Todo{Name: name})
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		opts := ListOptions{SortBy: "name", SortOrder: order}
+		want, _ := s.List(ctx, opts)
+
+		var got []model.Todo
+		opts.Limit = 2
+		for {
+			page, err := s.List(ctx, opts)
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			got = append(got, page...)
+			if len(page) < opts.Limit {
+				break
+			}
+			opts.Cursor = NewCursor(page[len(page)-1], opts)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %d items across pages, got %d", order, len(want), len(got))
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID {
+				t.Fatalf("%s: page walk diverged at %d", order, i)
+			}
+		}
+	}
+
+	// a cursor issued for another sort order is rejected
+	c := NewCursor(model.Todo{ID: 1, Name: "alpha"}, ListOptions{SortBy: "name"})
+	if _, err := s.List(ctx, ListOptions{SortBy: "due_date", Cursor: c}); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+	if _, err := s.List(ctx, ListOptions{Cursor: "!!"}); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor for garbage, got %v", err)
+	}
+}
+
+func TestInMemoryStore_Update_Version(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStore()
+	todo := &model.Todo{Name: "task"}
+	id, _ := s.Create(ctx, todo)
+	if todo.Version != 1 {
+		t.Fatalf("expected version 1 after create, got %d", todo.Version)
+	}
+
+	// matching version succeeds and bumps the version
+	if err := s.Update(ctx, &model.Todo{ID: id, Name: "v2", Version: 1}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	got, _ := s.Get(ctx, id)
+	if got.Version != 2 {
+		t.Fatalf("expected version 2, got %d", got.Version)
+	}
+
+	// stale version is rejected and nothing changes
+	if err := s.Update(ctx, &model.Todo{ID: id, Name: "stale", Version: 1}); err != ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	got, _ = s.Get(ctx, id)
+	if got.Name != "v2" {
+		t.Fatalf("stale update should not apply, got %q", got.Name)
+	}
+
+	// zero version is unconditional
+	if err := s.Update(ctx, &model.Todo{ID: id, Name: "blind"}); err != nil {
+		t.Fatalf("unconditional update failed: %v", err)
+	}
+	got, _ = s.Get(ctx, id)
+	if got.Version != 3 {
+		t.Fatalf("expected version 3, got %d", got.Version)
+	}
+
+	// an update cannot move the todo to the trash
+	now := time.Now()
+	if err := s.Update(ctx, &model.Todo{ID: id, Name: "trashed?", DeletedAt: &now}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if got, err := s.Get(ctx, id); err != nil || got.DeletedAt != nil {
+		t.Fatalf("expected the todo still live, got %+v, %v", got, err)
+	}
+}
+
+func TestInMemoryStore_Timestamps(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStore()
+	todo := &model.Todo{Name: "task"}
+	id, _ := s.Create(ctx, todo)
+	if todo.CreatedAt.IsZero() || !todo.UpdatedAt.Equal(todo.CreatedAt) {
+		t.Fatalf("unexpected timestamps after create: %v / %v", todo.CreatedAt, todo.UpdatedAt)
+	}
+	_, _ = s.Create(ctx, &model.Todo{Name: "untouched"})
+
+	since := time.Now()
+	if err := s.Update(ctx, &model.Todo{ID: id, Name: "changed"}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	got, _ := s.Get(ctx, id)
+	if !got.CreatedAt.Equal(todo.CreatedAt) || got.UpdatedAt.Before(since) {
+		t.Fatalf("unexpected timestamps after update: %v / %v", got.CreatedAt, got.UpdatedAt)
+	}
+
+	list, _ := s.List(ctx, ListOptions{UpdatedSince: since})
+	if len(list) != 1 || list[0].ID != id {
+		t.Fatalf("expected only the updated todo, got %v", list)
+	}
+	list, _ = s.List(ctx, ListOptions{SortBy: "updated_at", SortOrder: "desc"})
+	if list[0].ID != id {
+		t.Fatalf("expected most recently updated first, got %v", list)
+	}
+}
+
+func TestInMemoryStore_SoftDelete(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStore()
+	a, _ := s.Create(ctx, &model.Todo{Name: "write release notes"})
+	b, _ := s.Create(ctx, &model.Todo{Name: "publish release"})
+	s.AddDependency(ctx, b, a)
+
+	if err := s.Delete(ctx, a, time.Now()); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := s.Get(ctx, a); err != ErrNotFound {
+		t.Fatalf("expected a trashed todo to be hidden from Get, got %v", err)
+	}
+	if list, _ := s.List(ctx, ListOptions{}); len(list) != 1 || list[0].ID != b {
+		t.Fatalf("expected only the live todo listed, got %+v", list)
+	}
+	if results, _ := s.Search(ctx, "release", 0); len(results) != 1 {
+		t.Fatalf("expected search to skip the trash, got %+v", results)
+	}
+	if ids, _ := s.Blockers(ctx, b); len(ids) != 0 {
+		t.Fatalf("expected a trashed blocker to be ignored, got %v", ids)
+	}
+	if trash, _ := s.List(ctx, ListOptions{Deleted: true}); len(trash) != 1 || trash[0].DeletedAt == nil {
+		t.Fatalf("unexpected trash %+v", trash)
+	}
+
+	restored, err := s.Restore(ctx, a)
+	if err != nil || restored.DeletedAt != nil || restored.Version != 3 {
+		t.Fatalf("unexpected restore %+v, err %v", restored, err)
+	}
+	if results, _ := s.Search(ctx, "notes", 0); len(results) != 1 {
+		t.Fatalf("expected the restored todo to be searchable, got %+v", results)
+	}
+	if ids, _ := s.Blockers(ctx, b); len(ids) != 1 {
+		t.Fatalf("expected the dependency to come back, got %v", ids)
+	}
+
+	s.Delete(ctx, a, time.Now())
+	if n, _ := s.Purge(ctx, time.Now().Add(-time.Hour)); n != 0 {
+		t.Fatalf("expected nothing purged, got %d", n)
+	}
+	if n, _ := s.Purge(ctx, time.Now().Add(time.Second)); n != 1 {
+		t.Fatalf("expected one todo purged, got %d", n)
+	}
+	if _, err := s.Restore(ctx, a); err != ErrNotFound {
+		t.Fatalf("expected a purged todo to be gone, got %v", err)
+	}
+}
+
+func TestInMemoryStore_WithTx(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStore()
+	a, _ := s.Create(ctx, &model.Todo{Name: "draft agenda"})
+	b, _ := s.Create(ctx, &model.Todo{Name: "book room"})
+
+	created := &model.Todo{Name: "send invites"}
+	err := s.WithTx(ctx, func(tx Store) error {
+		if _, err := tx.Create(ctx, created); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, &model.Todo{ID: a, Name: "final agenda", Version: 1}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, b, time.Now())
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if list, _ := s.List(ctx, ListOptions{}); len(list) != 2 || created.ID != 3 {
+		t.Fatalf("expected two live todos, got %+v", list)
+	}
+
+	// a failure at the end undoes everything before it
+	boom := errors.New("boom")
+	err = s.WithTx(ctx, func(tx Store) error {
+		tx.Create(ctx, &model.Todo{Name: "order lunch"})
+		tx.Update(ctx, &model.Todo{ID: created.ID, Name: "send reminders"})
+		tx.Delete(ctx, a, time.Now())
+		tx.Restore(ctx, b)
+		tx.AddDependency(ctx, created.ID, b)
+		tx.AddAudit(ctx, &model.AuditEntry{TodoID: a, Action: model.AuditDelete})
+		// the transaction sees its own changes
+		if _, err := tx.Get(ctx, a); err != ErrNotFound {
+			t.Errorf("expected the delete visible inside the transaction, got %v", err)
+		}
+		return boom
+	})
+	if err != boom {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+	if got, _ := s.Get(ctx, a); got == nil || got.Name != "final agenda" {
+		t.Errorf("expected the delete rolled back, got %+v", got)
+	}
+	if got, _ := s.Get(ctx, created.ID); got.Name != "send invites" || got.Version != 1 {
+		t.Errorf("expected the update rolled back, got %+v", got)
+	}
+	if _, err := s.Get(ctx, b); err != ErrNotFound {
+		t.Errorf("expected the restore rolled back, got %v", err)
+	}
+	if results, _ := s.Search(ctx, "lunch", 0); len(results) != 0 {
+		t.Errorf("expected the create rolled back, got %+v", results)
+	}
+	if s.HasDependency(created.ID, b) {
+		t.Error("expected the dependency rolled back")
+	}
+	if entries, _ := s.ListAudit(ctx, AuditOptions{}); len(entries) != 0 {
+		t.Errorf("expected the audit entry rolled back, got %+v", entries)
+	}
+	if id, _ := s.Create(ctx, &model.Todo{Name: "next"}); id != 4 {
+		t.Errorf("expected the id of the rolled back create to be reused, got %d", id)
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// undoLog records what a transaction changed, so it can be rolled back
+type undoLog struct {
+	next  int64
+	audit int                       // audit entries before the transaction
+	todos map[int64]*model.Todo     // todos before their first change, nil when created
+	deps  map[model.Dependency]bool // dependencies before their first change
+}
+
+// WithTx runs fn under the write lock. Reads and writes inside fn see each
+// other; when fn fails every change it made is undone. A transaction is not
+// started once ctx is done.
+func (s *InMemoryStore) WithTx(ctx context.Context, fn func(Store) error) error {
+	return s.Transact(func(tx *InMemoryStore) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// Transact is WithTx for callers that need the transaction as an
+// InMemoryStore
+func (s *InMemoryStore) Transact(fn func(tx *InMemoryStore) error) error {
+	if s.undo != nil {
+		return fn(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &InMemoryStore{memState: s.memState, undo: &undoLog{
+		next:  s.next,
+		audit: len(s.audit),
+		todos: make(map[int64]*model.Todo),
+		deps:  make(map[model.Dependency]bool),
+	}}
+	done := false
+	defer func() {
+		// also undo a transaction left by a panic
+		if !done {
+			tx.rollback()
+		}
+	}()
+	err := fn(tx)
+	done = err == nil
+	return err
+}
+
+// rollback puts back the state recorded in the undo log; callers hold mu
+func (s *InMemoryStore) rollback() {
+	for id, old := range s.undo.todos {
+		if cur, ok := s.items[id]; ok && cur.DeletedAt == nil {
+			s.index.remove(cur)
+		}
+		if old == nil {
+			delete(s.items, id)
+			continue
+		}
+		s.items[id] = old
+		if old.DeletedAt == nil {
+			s.index.add(old)
+		}
+	}
+	for d, had := range s.undo.deps {
+		if had {
+			s.deps[d] = true
+		} else {
+			delete(s.deps, d)
+		}
+	}
+	s.audit = s.audit[:s.undo.audit]
+	s.next = s.undo.next
+}
+
+// saveTodo records id before a transaction first changes it
+func (s *InMemoryStore) saveTodo(id int64) {
+	if s.undo == nil {
+		return
+	}
+	if _, ok := s.undo.todos[id]; !ok {
+		s.undo.todos[id] = s.items[id]
+	}
+}
+
+// saveDependency records d before a transaction first changes it
+func (s *InMemoryStore) saveDependency(d model.Dependency) {
+	if s.undo == nil {
+		return
+	}
+	if _, ok := s.undo.deps[d]; !ok {
+		s.undo.deps[d] = s.deps[d]
+	}
+}
+
+// lock takes the write lock and returns its unlock. The store of a
+// transaction already holds it.
+func (s *InMemoryStore) lock() func() {
+	if s.undo != nil {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock takes the read lock and returns its unlock
+func (s *InMemoryStore) rlock() func() {
+	if s.undo != nil {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
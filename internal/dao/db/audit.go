@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// AddAudit appends e to the todo_audit table, setting its ID and CreatedAt
+func (s *SQLiteStore) AddAudit(ctx context.Context, e *model.AuditEntry) error {
+	changes := e.Changes
+	if changes == nil {
+		changes = []model.FieldChange{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal changes: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	query := `
+	INSERT INTO todo_audit (todo_id, action, actor, request_id, changes, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.conn().ExecContext(ctx, query, e.TodoID, string(e.Action), e.Actor, e.RequestID, string(changesJSON), formatTime(now))
+	if err != nil {
+		return fmt.Errorf("failed to add audit entry: %w", err)
+	}
+	if e.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	e.CreatedAt = now
+	return nil
+}
+
+// ListAudit returns the audit entries matching opts, oldest first
+func (s *SQLiteStore) ListAudit(ctx context.Context, opts cache.AuditOptions) ([]model.AuditEntry, error) {
+	conditions := []string{"id > ?"}
+	args := []interface{}{opts.AfterID}
+	if opts.TodoID != 0 {
+		conditions = append(conditions, "todo_id = ?")
+		args = append(args, opts.TodoID)
+	}
+	if opts.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, opts.Actor)
+	}
+	if opts.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, string(opts.Action))
+	}
+	if opts.RequestID != "" {
+		conditions = append(conditions, "request_id = ?")
+		args = append(args, opts.RequestID)
+	}
+	if !opts.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, formatTime(opts.Since))
+	}
+	if !opts.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, formatTime(opts.Until))
+	}
+
+	query := `SELECT id, todo_id, action, actor, request_id, changes, created_at FROM todo_audit
+	WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY id`
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var e model.AuditEntry
+		var action, changes, createdAt string
+		var actor, requestID sql.NullString
+		if err := rows.Scan(&e.ID, &e.TodoID, &action, &actor, &requestID, &changes, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		e.Action = model.AuditAction(action)
+		e.Actor = actor.String
+		e.RequestID = requestID.String
+		if err := json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal changes: %w", err)
+		}
+		if e.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+)
+
+// AddDependency records that todoID is blocked by blockedBy. Adding an
+// existing dependency is a no-op.
+func (s *SQLiteStore) AddDependency(ctx context.Context, todoID, blockedBy int64) error {
+	return s.transact(ctx, func(tx *SQLiteStore) error { return tx.addDependency(ctx, todoID, blockedBy) })
+}
+
+// addDependency inserts the dependency and, when nothing was inserted,
+// checks in the same transaction whether a todo was missing
+func (s *SQLiteStore) addDependency(ctx context.Context, todoID, blockedBy int64) error {
+	query := `
+	INSERT OR IGNORE INTO todo_dependencies (todo_id, blocked_by, created_at)
+	SELECT ?, ?, ?
+	WHERE EXISTS (SELECT 1 FROM todos WHERE id = ? AND deleted_at IS NULL)
+		AND EXISTS (SELECT 1 FROM todos WHERE id = ? AND deleted_at IS NULL)
+	`
+	result, err := s.conn().ExecContext(ctx, query, todoID, blockedBy, formatTime(time.Now()), todoID, blockedBy)
+	if err != nil {
+		return fmt.Errorf("failed to add dependency: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// either a todo is missing or the dependency already exists
+		var exists int
+		err := s.conn().QueryRowContext(ctx, `SELECT COUNT(*) FROM todos WHERE id IN (?, ?) AND deleted_at IS NULL`, todoID, blockedBy).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to add dependency: %w", err)
+		}
+		if (todoID == blockedBy && exists < 1) || (todoID != blockedBy && exists < 2) {
+			return cache.ErrNotFound
+		}
+	}
+	return nil
+}
+
+// RemoveDependency deletes the dependency, or returns ErrNotFound
+func (s *SQLiteStore) RemoveDependency(ctx context.Context, todoID, blockedBy int64) error {
+	result, err := s.conn().ExecContext(ctx, `DELETE FROM todo_dependencies WHERE todo_id = ? AND blocked_by = ?`, todoID, blockedBy)
+	if err != nil {
+		return fmt.Errorf("failed to remove dependency: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return cache.ErrNotFound
+	}
+	return nil
+}
+
+// Blockers returns the ids todoID is blocked by, ascending. Todos in the
+// trash are left out.
+func (s *SQLiteStore) Blockers(ctx context.Context, todoID int64) ([]int64, error) {
+	return s.dependencyIDs(ctx, `
+	SELECT d.blocked_by FROM todo_dependencies d JOIN todos t ON t.id = d.blocked_by
+	WHERE d.todo_id = ? AND t.deleted_at IS NULL
+	ORDER BY d.blocked_by
+	`, todoID)
+}
+
+// Dependents returns the ids blocked by todoID, ascending. Todos in the
+// trash are left out.
+func (s *SQLiteStore) Dependents(ctx context.Context, todoID int64) ([]int64, error) {
+	return s.dependencyIDs(ctx, `
+	SELECT d.todo_id FROM todo_dependencies d JOIN todos t ON t.id = d.todo_id
+	WHERE d.blocked_by = ? AND t.deleted_at IS NULL
+	ORDER BY d.todo_id
+	`, todoID)
+}
+
+func (s *SQLiteStore) dependencyIDs(ctx context.Context, query string, id int64) ([]int64, error) {
+	rows, err := s.conn().QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dependencies: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("failed to scan dependency: %w", err)
+		}
+		ids = append(ids, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return ids, nil
+}
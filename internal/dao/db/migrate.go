@@ -0,0 +1,362 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// migration is a single numbered schema change. Up and Down may contain
+// several statements; each runs in its own transaction together with the
+// schema_migrations bookkeeping so a failed step leaves no partial state.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrations lists every schema change in version order. Never edit or
+// reorder an entry once released; append a new one instead.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create_todos",
+		Up: `
+		CREATE TABLE IF NOT EXISTS todos (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			description TEXT,
+			due_date TEXT,
+			status TEXT NOT NULL DEFAULT 'not_started',
+			priority INTEGER DEFAULT 0,
+			tags TEXT,
+			created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_todos_status ON todos(status);
+		CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_todos_due_date;
+		DROP INDEX IF EXISTS idx_todos_status;
+		DROP TABLE IF EXISTS todos;
+		`,
+	},
+	{
+		// due dates used to be stored with their original offset, which
+		// breaks lexical ordering; rewrite them in timeLayout (UTC, ms)
+		Version: 2,
+		Name:    "normalize_due_date",
+		Up: `
+		UPDATE todos
+		SET due_date = strftime('%Y-%m-%dT%H:%M:%fZ', due_date)
+		WHERE due_date IS NOT NULL AND due_date != '' AND strftime('%Y-%m-%dT%H:%M:%fZ', due_date) IS NOT NULL;
+		`,
+		Down: `SELECT 1;`,
+	},
+	{
+		Version: 3,
+		Name:    "add_todos_version",
+		Up:      `ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+		Down:    `ALTER TABLE todos DROP COLUMN version;`,
+	},
+	{
+		// created_at/updated_at were written by CURRENT_TIMESTAMP; store
+		// them in timeLayout like due_date so they sort and filter as text
+		Version: 4,
+		Name:    "normalize_timestamps",
+		Up: `
+		UPDATE todos SET
+			created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', created_at), created_at),
+			updated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%fZ', updated_at), updated_at);
+		CREATE INDEX IF NOT EXISTS idx_todos_updated_at ON todos(updated_at);
+		`,
+		Down: `DROP INDEX IF EXISTS idx_todos_updated_at;`,
+	},
+	{
+		// full-text index over name, description and tags (space-joined),
+		// kept in sync with todos by triggers
+		Version: 5,
+		Name:    "create_todos_fts",
+		Up: `
+		CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5(name, description, tags, tokenize = 'unicode61');
+		CREATE TRIGGER IF NOT EXISTS todos_fts_insert AFTER INSERT ON todos BEGIN
+			INSERT INTO todos_fts (rowid, name, description, tags)
+			VALUES (new.id, new.name, COALESCE(new.description, ''),
+				COALESCE((SELECT group_concat(value, ' ') FROM json_each(CASE WHEN json_valid(new.tags) THEN new.tags ELSE '[]' END)), ''));
+		END;
+		CREATE TRIGGER IF NOT EXISTS todos_fts_update AFTER UPDATE OF name, description, tags ON todos BEGIN
+			DELETE FROM todos_fts WHERE rowid = old.id;
+			INSERT INTO todos_fts (rowid, name, description, tags)
+			VALUES (new.id, new.name, COALESCE(new.description, ''),
+				COALESCE((SELECT group_concat(value, ' ') FROM json_each(CASE WHEN json_valid(new.tags) THEN new.tags ELSE '[]' END)), ''));
+		END;
+		CREATE TRIGGER IF NOT EXISTS todos_fts_delete AFTER DELETE ON todos BEGIN
+			DELETE FROM todos_fts WHERE rowid = old.id;
+		END;
+		DELETE FROM todos_fts;
+		INSERT INTO todos_fts (rowid, name, description, tags)
+		SELECT id, name, COALESCE(description, ''),
+			COALESCE((SELECT group_concat(value, ' ') FROM json_each(CASE WHEN json_valid(todos.tags) THEN todos.tags ELSE '[]' END)), '')
+		FROM todos;
+		`,
+		Down: `
+		DROP TRIGGER IF EXISTS todos_fts_delete;
+		DROP TRIGGER IF EXISTS todos_fts_update;
+		DROP TRIGGER IF EXISTS todos_fts_insert;
+		DROP TABLE IF EXISTS todos_fts;
+		`,
+	},
+	{
+		// subtasks: parent_id links a todo to its parent, progress caches
+		// the completion percentage rolled up from its children
+		Version: 6,
+		Name:    "add_todos_hierarchy",
+		Up: `
+		ALTER TABLE todos ADD COLUMN parent_id INTEGER;
+		ALTER TABLE todos ADD COLUMN progress INTEGER NOT NULL DEFAULT 0;
+		UPDATE todos SET progress = 100 WHERE status = 'completed';
+		CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_todos_parent_id;
+		ALTER TABLE todos DROP COLUMN progress;
+		ALTER TABLE todos DROP COLUMN parent_id;
+		`,
+	},
+	{
+		// "todo_id is blocked by blocked_by" edges between todos
+		Version: 7,
+		Name:    "create_todo_dependencies",
+		Up: `
+		CREATE TABLE IF NOT EXISTS todo_dependencies (
+			todo_id INTEGER NOT NULL,
+			blocked_by INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			PRIMARY KEY (todo_id, blocked_by)
+		);
+		CREATE INDEX IF NOT EXISTS idx_todo_dependencies_blocked_by ON todo_dependencies(blocked_by);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_todo_dependencies_blocked_by;
+		DROP TABLE IF EXISTS todo_dependencies;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add_todos_recurrence",
+		Up:      `ALTER TABLE todos ADD COLUMN recurrence TEXT;`,
+		Down:    `ALTER TABLE todos DROP COLUMN recurrence;`,
+	},
+	{
+		// soft delete: rows with deleted_at set are in the trash until purged
+		Version: 9,
+		Name:    "add_todos_deleted_at",
+		Up: `
+		ALTER TABLE todos ADD COLUMN deleted_at TEXT;
+		CREATE INDEX IF NOT EXISTS idx_todos_deleted_at ON todos(deleted_at);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_todos_deleted_at;
+		ALTER TABLE todos DROP COLUMN deleted_at;
+		`,
+	},
+	{
+		// one row per change made through the service, with a JSON field diff
+		Version: 10,
+		Name:    "create_todo_audit",
+		Up: `
+		CREATE TABLE IF NOT EXISTS todo_audit (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			todo_id INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			actor TEXT,
+			request_id TEXT,
+			changes TEXT NOT NULL DEFAULT '[]',
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_todo_audit_todo_id ON todo_audit(todo_id);
+		CREATE INDEX IF NOT EXISTS idx_todo_audit_created_at ON todo_audit(created_at);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_todo_audit_created_at;
+		DROP INDEX IF EXISTS idx_todo_audit_todo_id;
+		DROP TABLE IF EXISTS todo_audit;
+		`,
+	},
+	{
+		// the UID and resource name a CalDAV client created a todo with
+		Version: 11,
+		Name:    "add_todos_caldav",
+		Up: `
+		ALTER TABLE todos ADD COLUMN uid TEXT;
+		ALTER TABLE todos ADD COLUMN caldav_name TEXT;
+		`,
+		Down: `
+		ALTER TABLE todos DROP COLUMN caldav_name;
+		ALTER TABLE todos DROP COLUMN uid;
+		`,
+	},
+}
+
+// MigrationStatus describes whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// ensureMigrationsTable creates the schema_migrations bookkeeping table
+func (s *SQLiteStore) ensureMigrationsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)
+	`
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the applied versions mapped to their apply time
+func (s *SQLiteStore) appliedMigrations() (map[int]time.Time, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		at, _ := time.Parse(time.RFC3339, appliedAt)
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Migrate applies every pending migration
+func (s *SQLiteStore) Migrate() error {
+	_, err := s.MigrateUp(0)
+	return err
+}
+
+// MigrateUp applies up to steps pending migrations in ascending order.
+// A steps value <= 0 applies all of them. It returns the number applied.
+func (s *SQLiteStore) MigrateUp(steps int) (int, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range sortedMigrations() {
+		if steps > 0 && count >= steps {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := s.runMigration(m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().UTC().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d (%s) up failed: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrateDown reverts up to steps applied migrations, newest first.
+// A steps value <= 0 reverts one. It returns the number reverted.
+func (s *SQLiteStore) MigrateDown(steps int) (int, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	ordered := sortedMigrations()
+	count := 0
+	for i := len(ordered) - 1; i >= 0 && count < steps; i-- {
+		m := ordered[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := s.runMigration(m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d (%s) down failed: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrationStatus reports every known migration and whether it is applied
+func (s *SQLiteStore) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []MigrationStatus
+	for _, m := range sortedMigrations() {
+		at, ok := applied[m.Version]
+		out = append(out, MigrationStatus{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return out, nil
+}
+
+// runMigration executes script and the bookkeeping step in one transaction
+func (s *SQLiteStore) runMigration(script string, record func(*sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sortedMigrations returns the migrations ordered by version
+func sortedMigrations() []migration {
+	out := make([]migration, len(migrations))
+	copy(out, migrations)
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
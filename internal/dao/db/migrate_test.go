@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrate_StatusUpDown tests applying and reverting migrations
+func TestMigrate_StatusUpDown(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "migrate.db")
+
+	store, err := OpenSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer store.Close()
+
+	statuses, err := store.MigrationStatus()
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if len(statuses) != len(migrations) {
+		t.Fatalf("expected %d migrations, got %d", len(migrations), len(statuses))
+	}
+	for _, st := range statuses {
+		if st.Applied {
+			t.Fatalf("expected migration %d to be pending on a fresh database", st.Version)
+		}
+	}
+
+	n, err := store.MigrateUp(0)
+	if err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	if n != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got %d", len(migrations), n)
+	}
+
+	// applying again is a no-op
+	n, err = store.MigrateUp(0)
+	if err != nil || n != 0 {
+		t.Fatalf("expected no-op second up, got n=%d err=%v", n, err)
+	}
+
+	statuses, _ = store.MigrationStatus()
+	for _, st := range statuses {
+		if !st.Applied || st.AppliedAt.IsZero() {
+			t.Fatalf("expected migration %d to be applied with a timestamp", st.Version)
+		}
+	}
+
+	// revert everything, newest first
+	n, err = store.MigrateDown(len(migrations))
+	if err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	if n != len(migrations) {
+		t.Fatalf("expected %d migrations reverted, got %d", len(migrations), n)
+	}
+
+	var count int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='todos'").Scan(&count); err != nil {
+		t.Fatalf("failed to query schema: %v", err)
+	}
+	if count != 0 {
+		t.Fatal("expected todos table to be dropped after full down migration")
+	}
+}
+
+// TestMigrate_ExistingDatabase tests that a database created before
+// migrations existed is adopted without losing data
+func TestMigrate_ExistingDatabase(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	legacy, err := OpenSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := legacy.db.Exec(migrations[0].Up); err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+	if _, err := legacy.db.Exec(`INSERT INTO todos (name, description, status, tags) VALUES ('legacy', '', 'not_started', '[]')`); err != nil {
+		t.Fatalf("failed to insert legacy row: %v", err)
+	}
+	legacy.Close()
+
+	store, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open legacy database: %v", err)
+	}
+	defer store.Close()
+
+	got, err := store.Get(ctx, 1)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got.Name != "legacy" {
+		t.Errorf("expected legacy row to survive migration, got %q", got.Name)
+	}
+}
+
+// TestMigrate_NormalizeDueDate tests that offset due dates are rewritten in UTC
+func TestMigrate_NormalizeDueDate(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	legacy, err := OpenSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := legacy.MigrateUp(1); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	if _, err := legacy.db.Exec(`INSERT INTO todos (name, description, due_date, status, tags) VALUES ('legacy', '', '2026-01-02T08:00:00+08:00', 'not_started', '[]')`); err != nil {
+		t.Fatalf("failed to insert legacy row: %v", err)
+	}
+	if err := legacy.Migrate(); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	defer legacy.Close()
+
+	var stored string
+	if err := legacy.db.QueryRow(`SELECT due_date FROM todos WHERE id = 1`).Scan(&stored); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if stored != "2026-01-02T00:00:00.000Z" {
+		t.Errorf("expected normalized due_date, got %q", stored)
+	}
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"path/filepath"
@@ -11,17 +13,50 @@ import (
 	"github.com/conbanwa/todo/internal/dao/cache"
 	"github.com/conbanwa/todo/internal/dao/cache/api"
 	"github.com/conbanwa/todo/internal/model"
+	sqlite "github.com/glebarez/go-sqlite"
 	_ "github.com/glebarez/sqlite"
 )
 
+// unicode_lower is lower() folding like strings.ToLower, so the substring
+// filter matches what cache.Match does; SQLite's lower() only folds ASCII
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("unicode_lower", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch v := args[0].(type) {
+		case string:
+			return strings.ToLower(v), nil
+		case []byte:
+			return strings.ToLower(string(v)), nil
+		}
+		return args[0], nil
+	})
+}
+
 // SQLiteStore implements the Store interface using SQLite database
 type SQLiteStore struct {
 	db *sql.DB
+	tx *sql.Tx // set on the store a WithTx function runs on
 }
 
-// NewSQLiteStore creates a new SQLite store instance
+// NewSQLiteStore creates a new SQLite store instance and applies any pending
+// schema migrations.
 // If dbPath is empty, it defaults to "todos.db" in the current directory
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	store, err := OpenSQLiteStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.Migrate(); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// OpenSQLiteStore opens the database without touching the schema. It is used
+// by the migrate command, which needs to inspect or revert migrations itself.
+func OpenSQLiteStore(dbPath string) (*SQLiteStore, error) {
 	if dbPath == "" {
 		dbPath = "todos.db"
 	}
@@ -33,66 +68,68 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 		// os.MkdirAll(dir, 0755)
 	}
 
-	// Use WAL mode for better concurrency
-	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL", dbPath)
+	// Use WAL mode for better concurrency. Transactions take the write lock
+	// when they begin, so a read followed by a write cannot be overtaken by
+	// another writer; concurrent ones wait for it instead of failing.
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_txlock=immediate&_pragma=busy_timeout(5000)", dbPath)
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	store := &SQLiteStore{db: db}
+	return &SQLiteStore{db: db}, nil
+}
 
-	if err := store.initSchema(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+// Close closes the database connection
+func (s *SQLiteStore) Close() error {
+	if s.db != nil {
+		return s.db.Close()
 	}
+	return nil
+}
 
-	return store, nil
+// execer runs statements on the database or inside a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
-// initSchema creates the todos table if it doesn't exist
-func (s *SQLiteStore) initSchema() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS todos (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		description TEXT,
-		due_date TEXT,
-		status TEXT NOT NULL DEFAULT 'not_started',
-		priority INTEGER DEFAULT 0,
-		tags TEXT,
-		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
-	)
-	`
-	_, err := s.db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("failed to create todos table: %w", err)
+// conn returns the transaction the store runs in, or the database
+func (s *SQLiteStore) conn() execer {
+	if s.tx != nil {
+		return s.tx
 	}
+	return s.db
+}
 
-	// Create index for common queries
-	indexQuery := `
-	CREATE INDEX IF NOT EXISTS idx_todos_status ON todos(status);
-	CREATE INDEX IF NOT EXISTS idx_todos_due_date ON todos(due_date);
-	`
-	_, err = s.db.Exec(indexQuery)
+// WithTx runs fn in a database transaction, committed when fn returns nil
+func (s *SQLiteStore) WithTx(ctx context.Context, fn func(cache.Store) error) error {
+	return s.transact(ctx, func(tx *SQLiteStore) error { return fn(tx) })
+}
+
+// transact is WithTx for the store's own multi-statement writes
+func (s *SQLiteStore) transact(ctx context.Context, fn func(tx *SQLiteStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create indexes: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
-}
-
-// Close closes the database connection
-func (s *SQLiteStore) Close() error {
-	if s.db != nil {
-		return s.db.Close()
+	if err := fn(&SQLiteStore{db: s.db, tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
 // Create inserts a new api into the database
-func (s *SQLiteStore) Create(t *model.Todo) (int64, error) {
+func (s *SQLiteStore) Create(ctx context.Context, t *model.Todo) (int64, error) {
 	if t.Name == "" {
 		return 0, api.ErrInvalid("name is required")
 	}
@@ -107,16 +144,14 @@ func (s *SQLiteStore) Create(t *model.Todo) (int64, error) {
 		return 0, fmt.Errorf("failed to marshal tags: %w", err)
 	}
 
-	var dueDateStr sql.NullString
-	if !t.DueDate.IsZero() {
-		dueDateStr = sql.NullString{String: t.DueDate.Format(time.RFC3339), Valid: true}
-	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
 
 	query := `
-	INSERT INTO todos (name, description, due_date, status, priority, tags)
-	VALUES (?, ?, ?, ?, ?, ?)
+	INSERT INTO todos (name, description, due_date, status, priority, tags, parent_id, progress, recurrence, uid, caldav_name, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := s.db.Exec(query, t.Name, t.Description, dueDateStr, string(t.Status), t.Priority, string(tagsJSON))
+	result, err := s.conn().ExecContext(ctx, query, t.Name, t.Description, formatTime(t.DueDate), string(t.Status), t.Priority, string(tagsJSON),
+		nullID(t.ParentID), t.Progress, t.Recurrence, t.UID, t.CalDAVName, formatTime(now), formatTime(now))
 	if err != nil {
 		return 0, fmt.Errorf("failed to create api: %w", err)
 	}
@@ -125,105 +160,85 @@ func (s *SQLiteStore) Create(t *model.Todo) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("failed to get last insert id: %w", err)
 	}
+	t.Version = 1
+	t.CreatedAt = now
+	t.UpdatedAt = now
 
 	return id, nil
 }
 
 // Get retrieves a api by ID
-func (s *SQLiteStore) Get(id int64) (*model.Todo, error) {
-	query := `
-	SELECT id, name, description, due_date, status, priority, tags
-	FROM todos
-	WHERE id = ?
-	`
-	row := s.db.QueryRow(query, id)
-
-	var t model.Todo
-	var dueDateStr sql.NullString
-	var tagsJSON string
-	var statusStr string
-
-	err := row.Scan(&t.ID, &t.Name, &t.Description, &dueDateStr, &statusStr, &t.Priority, &tagsJSON)
+func (s *SQLiteStore) Get(ctx context.Context, id int64) (*model.Todo, error) {
+	query := `SELECT ` + todoColumns + ` FROM todos WHERE id = ? AND deleted_at IS NULL`
+	t, err := scanTodo(s.conn().QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, cache.ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to get api: %w", err)
 	}
-
-	// Parse due_date
-	if dueDateStr.Valid && dueDateStr.String != "" {
-		dueDate, err := time.Parse(time.RFC3339, dueDateStr.String)
-		if err != nil {
-			// Try alternative format
-			dueDate, err = time.Parse("2006-01-02 15:04:05", dueDateStr.String)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse due_date: %w", err)
-			}
-		}
-		t.DueDate = dueDate
-	}
-
-	t.Status = model.Status(statusStr)
-
-	// Parse tags JSON
-	if tagsJSON != "" {
-		if err := json.Unmarshal([]byte(tagsJSON), &t.Tags); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal tags: %w", err)
-		}
-	}
-	// Ensure tags is never nil (always at least an empty slice)
-	if t.Tags == nil {
-		t.Tags = []string{}
-	}
-
 	return &t, nil
 }
 
-// Update updates an existing api
-func (s *SQLiteStore) Update(t *model.Todo) error {
+// Update updates an existing api. When t.Version is non-zero the row is only
+// written if its stored version still matches, otherwise ErrConflict is
+// returned. On success t.Version holds the new version.
+func (s *SQLiteStore) Update(ctx context.Context, t *model.Todo) error {
 	if t.ID == 0 {
 		return api.ErrInvalid("id is required")
 	}
+	return s.transact(ctx, func(tx *SQLiteStore) error { return tx.update(ctx, t) })
+}
 
-	// Check if api exists
-	_, err := s.Get(t.ID)
-	if err != nil {
-		return err
-	}
-
+// update writes t; it runs in a transaction so a missing row can be told
+// apart from a stale version
+func (s *SQLiteStore) update(ctx context.Context, t *model.Todo) error {
 	// Serialize tags as JSON
 	tagsJSON, err := json.Marshal(t.Tags)
 	if err != nil {
 		return fmt.Errorf("failed to marshal tags: %w", err)
 	}
 
-	var dueDateStr sql.NullString
-	if !t.DueDate.IsZero() {
-		dueDateStr = sql.NullString{String: t.DueDate.Format(time.RFC3339), Valid: true}
-	}
-
 	if t.Status == "" {
 		t.Status = model.NotStarted
 	}
 
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
 	query := `
 	UPDATE todos
-	SET name = ?, description = ?, due_date = ?, status = ?, priority = ?, tags = ?, updated_at = CURRENT_TIMESTAMP
-	WHERE id = ?
+	SET name = ?, description = ?, due_date = ?, status = ?, priority = ?, tags = ?,
+		parent_id = ?, progress = ?, recurrence = ?, uid = ?, caldav_name = ?, version = version + 1, updated_at = ?
+	WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
+	RETURNING version, created_at
 	`
-	_, err = s.db.Exec(query, t.Name, t.Description, dueDateStr, string(t.Status), t.Priority, string(tagsJSON), t.ID)
+	var version int64
+	var createdAt string
+	err = s.conn().QueryRowContext(ctx, query, t.Name, t.Description, formatTime(t.DueDate), string(t.Status), t.Priority, string(tagsJSON),
+		nullID(t.ParentID), t.Progress, t.Recurrence, t.UID, t.CalDAVName, formatTime(now), t.ID, t.Version, t.Version).Scan(&version, &createdAt)
+	if err == sql.ErrNoRows {
+		// Either the row is gone or its version moved on
+		if _, err := s.Get(ctx, t.ID); err != nil {
+			return err
+		}
+		return cache.ErrConflict
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update api: %w", err)
 	}
+	t.Version = version
+	t.CreatedAt, _ = parseTime(createdAt)
+	t.UpdatedAt = now
 
 	return nil
 }
 
-// Delete removes a api from the database
-func (s *SQLiteStore) Delete(id int64) error {
-	query := `DELETE FROM todos WHERE id = ?`
-	result, err := s.db.Exec(query, id)
+// Delete moves a api to the trash by setting deleted_at. Trashed todos are
+// hidden from Get, Update, List and Search until restored or purged; their
+// dependencies are kept so Restore brings them back.
+func (s *SQLiteStore) Delete(ctx context.Context, id int64, at time.Time) error {
+	query := `UPDATE todos SET deleted_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL`
+	result, err := s.conn().ExecContext(ctx, query, formatTime(at), formatTime(time.Now().UTC()), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete api: %w", err)
 	}
@@ -240,83 +255,394 @@ func (s *SQLiteStore) Delete(id int64) error {
 	return nil
 }
 
-// List retrieves all todos with optional filtering and sorting
-func (s *SQLiteStore) List(opts cache.ListOptions) ([]model.Todo, error) {
-	var conditions []string
-	var args []interface{}
+// Restore takes a api out of the trash, or returns ErrNotFound if it is not
+// there
+func (s *SQLiteStore) Restore(ctx context.Context, id int64) (*model.Todo, error) {
+	query := `UPDATE todos SET deleted_at = NULL, updated_at = ?, version = version + 1
+	WHERE id = ? AND deleted_at IS NOT NULL
+	RETURNING ` + todoColumns
+	t, err := scanTodo(s.conn().QueryRowContext(ctx, query, formatTime(time.Now().UTC()), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, cache.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to restore api: %w", err)
+	}
+	return &t, nil
+}
 
-	// Apply status filter if specified
-	if string(opts.Status) != "" {
-		conditions = append(conditions, "status = ?")
-		args = append(args, string(opts.Status))
+// Purge permanently removes the todos deleted before the given time together
+// with their dependencies and returns how many were removed
+func (s *SQLiteStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := s.transact(ctx, func(tx *SQLiteStore) error {
+		cutoff := formatTime(before)
+		_, err := tx.conn().ExecContext(ctx, `
+		DELETE FROM todo_dependencies
+		WHERE todo_id IN (SELECT id FROM todos WHERE deleted_at < ?)
+			OR blocked_by IN (SELECT id FROM todos WHERE deleted_at < ?)
+		`, cutoff, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to purge dependencies: %w", err)
+		}
+		result, err := tx.conn().ExecContext(ctx, `DELETE FROM todos WHERE deleted_at < ?`, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to purge todos: %w", err)
+		}
+		if n, err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return n, nil
+}
 
-	// Build WHERE clause
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+// List retrieves todos with filtering, sorting and pagination done in SQL.
+// The ORDER BY mirrors cache.Compare so results match the in-memory store.
+func (s *SQLiteStore) List(ctx context.Context, opts cache.ListOptions) ([]model.Todo, error) {
+	conditions, args := filterConditions(opts, time.Now())
+
+	// Resume strictly after the cursor position, in ORDER BY key order
+	if opts.Cursor != "" {
+		c, err := cache.DecodeCursor(opts)
+		if err != nil {
+			return nil, err
+		}
+		cond, cargs := cursorCondition(c, opts.SortOrder == "desc")
+		conditions = append(conditions, cond)
+		args = append(args, cargs...)
 	}
 
-	// Always order by id for consistent results, then FilterAndSort will handle final sorting
-	query := fmt.Sprintf(`
-	SELECT id, name, description, due_date, status, priority, tags
-	FROM todos
-	%s
-	ORDER BY id ASC
-	`, whereClause)
+	// Build WHERE clause
+	whereClause := "WHERE " + strings.Join(conditions, " AND ")
+
+	query := fmt.Sprintf(`SELECT %s FROM todos %s ORDER BY %s`, todoColumns, whereClause, orderClause(opts))
+
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	} else if opts.Offset > 0 {
+		query += " LIMIT -1"
+	}
+	if opts.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, opts.Offset)
+	}
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.conn().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list todos: %w", err)
 	}
 	defer rows.Close()
 
-	var todos []model.Todo
+	todos := make([]model.Todo, 0, opts.Limit)
 	for rows.Next() {
-		var t model.Todo
-		var dueDateStr sql.NullString
-		var tagsJSON string
-		var statusStr string
-
-		err := rows.Scan(&t.ID, &t.Name, &t.Description, &dueDateStr, &statusStr, &t.Priority, &tagsJSON)
+		t, err := scanTodo(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan api: %w", err)
 		}
+		todos = append(todos, t)
+	}
 
-		// Parse due_date
-		if dueDateStr.Valid && dueDateStr.String != "" {
-			dueDate, err := time.Parse(time.RFC3339, dueDateStr.String)
-			if err != nil {
-				// Try alternative format
-				dueDate, err = time.Parse("2006-01-02 15:04:05", dueDateStr.String)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse due_date: %w", err)
-				}
-			}
-			t.DueDate = dueDate
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return todos, nil
+}
+
+// Search ranks todos against the todos_fts index. Every word of query must
+// match the start of a word in name, description or tags; results come best
+// first with a highlighted snippet. A limit <= 0 returns every match.
+func (s *SQLiteStore) Search(ctx context.Context, query string, limit int) ([]cache.SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return []cache.SearchResult{}, nil
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	q := `
+	SELECT ` + qualifiedColumns("todos") + `,
+		snippet(todos_fts, -1, '<mark>', '</mark>', '…', 10) AS snippet,
+		bm25(todos_fts, ?, ?, ?) AS rank
+	FROM todos_fts JOIN todos ON todos.id = todos_fts.rowid
+	WHERE todos_fts MATCH ? AND todos.deleted_at IS NULL
+	ORDER BY rank, todos.id
+	LIMIT ?
+	`
+	rows, err := s.conn().QueryContext(ctx, q, cache.NameWeight, cache.DescriptionWeight, cache.TagsWeight, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+	defer rows.Close()
+
+	results := []cache.SearchResult{}
+	for rows.Next() {
+		var r cache.SearchResult
+		var rank float64
+		if r.Todo, err = scanTodo(rows, &r.Snippet, &rank); err != nil {
+			return nil, fmt.Errorf("failed to scan api: %w", err)
 		}
+		// bm25 is lower-is-better; flip it so Score agrees with the in-memory store
+		r.Score = -rank
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
 
-		t.Status = model.Status(statusStr)
+	return results, nil
+}
 
-		// Parse tags JSON
-		if tagsJSON != "" {
-			if err := json.Unmarshal([]byte(tagsJSON), &t.Tags); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal tags: %w", err)
-			}
+// ftsQuery turns free text into an FTS5 query of quoted prefix terms, so
+// user input can never be parsed as FTS5 syntax
+func ftsQuery(query string) string {
+	tokens := cache.Tokenize(query)
+	for i, tok := range tokens {
+		tokens[i] = `"` + tok + `"*`
+	}
+	return strings.Join(tokens, " ")
+}
+
+// filterConditions translates the filters in opts into WHERE conditions
+// with the same semantics as cache.Match
+func filterConditions(opts cache.ListOptions, now time.Time) ([]string, []interface{}) {
+	conditions := []string{"deleted_at IS NULL"}
+	if opts.Deleted {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+	var args []interface{}
+
+	// Apply status filter if specified
+	statuses := opts.Statuses
+	if opts.Status != "" {
+		statuses = append([]model.Status{opts.Status}, statuses...)
+	}
+	if len(statuses) > 0 {
+		conditions = append(conditions, "status IN ("+placeholders(len(statuses))+")")
+		for _, st := range statuses {
+			args = append(args, string(st))
 		}
-		// Ensure tags is never nil (always at least an empty slice)
-		if t.Tags == nil {
-			t.Tags = []string{}
+	}
+
+	if opts.ParentID != nil {
+		conditions = append(conditions, "COALESCE(parent_id, 0) = ?")
+		args = append(args, *opts.ParentID)
+	}
+
+	if !opts.UpdatedSince.IsZero() {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, formatTime(opts.UpdatedSince))
+	}
+
+	// tags are a JSON array; json_each expands it for membership tests
+	if len(opts.TagsAny) > 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(todos.tags) WHERE json_each.value IN ("+placeholders(len(opts.TagsAny))+"))")
+		for _, tag := range opts.TagsAny {
+			args = append(args, tag)
 		}
+	}
+	for _, tag := range opts.TagsAll {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(todos.tags) WHERE json_each.value = ?)")
+		args = append(args, tag)
+	}
 
-		todos = append(todos, t)
+	if opts.PriorityMin != nil {
+		conditions = append(conditions, "COALESCE(priority, 0) >= ?")
+		args = append(args, *opts.PriorityMin)
+	}
+	if opts.PriorityMax != nil {
+		conditions = append(conditions, "COALESCE(priority, 0) <= ?")
+		args = append(args, *opts.PriorityMax)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+	if !opts.DueAfter.IsZero() {
+		conditions = append(conditions, "due_date >= ?")
+		args = append(args, formatTime(opts.DueAfter))
+	}
+	if !opts.DueBefore.IsZero() {
+		conditions = append(conditions, "due_date < ?")
+		args = append(args, formatTime(opts.DueBefore))
+	}
+	if opts.Overdue {
+		conditions = append(conditions, "due_date < ? AND status != ?")
+		args = append(args, formatTime(now), string(model.Completed))
+	}
+
+	if opts.Query != "" {
+		q := strings.ToLower(opts.Query)
+		conditions = append(conditions, "(instr(unicode_lower(name), ?) > 0 OR instr(unicode_lower(COALESCE(description, '')), ?) > 0)")
+		args = append(args, q, q)
+	}
+
+	return conditions, args
+}
+
+// placeholders returns n comma-separated bind parameters
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sortColumns maps ListOptions.SortBy to the SQL expression for the same key
+// cache.Compare uses. NULL due dates sort first, like a zero time.Time.
+var sortColumns = map[string]string{
+	"due_date":   "COALESCE(due_date, '')",
+	"status":     "status",
+	"name":       "name",
+	"priority":   "COALESCE(priority, 0)",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// orderClause builds the ORDER BY expression list, always ending with id
+func orderClause(opts cache.ListOptions) string {
+	dir := "ASC"
+	if opts.SortOrder == "desc" {
+		dir = "DESC"
+	}
+	if col, ok := sortColumns[opts.SortBy]; ok {
+		return col + " " + dir + ", id " + dir
+	}
+	return "id " + dir
+}
+
+// cursorCondition builds the keyset predicate selecting rows after c
+func cursorCondition(c cache.Cursor, desc bool) (string, []interface{}) {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	col, ok := sortColumns[c.SortBy]
+	if !ok {
+		return "id " + op + " ?", []interface{}{c.ID}
+	}
+
+	at, _ := c.Todo()
+	var key interface{}
+	switch c.SortBy {
+	case "due_date":
+		key = formatTime(at.DueDate).String
+	case "created_at":
+		key = formatTime(at.CreatedAt).String
+	case "updated_at":
+		key = formatTime(at.UpdatedAt).String
+	case "priority":
+		key = at.Priority
+	default:
+		key = cache.SortKey(at, c.SortBy)
+	}
+	return fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", col, op, col, op), []interface{}{key, key, c.ID}
+}
+
+// todoColumns is the column list scanTodo expects, in order
+const todoColumns = `id, name, description, due_date, status, priority, tags, parent_id, progress, recurrence, uid, caldav_name, version, created_at, updated_at, deleted_at`
+
+// qualifiedColumns returns todoColumns prefixed with table, for joins
+func qualifiedColumns(table string) string {
+	cols := strings.Split(todoColumns, ", ")
+	for i, c := range cols {
+		cols[i] = table + "." + c
+	}
+	return strings.Join(cols, ", ")
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTodo reads one row selected with todoColumns, followed by any extra
+// columns which are scanned into extra
+func scanTodo(row rowScanner, extra ...interface{}) (model.Todo, error) {
+	var t model.Todo
+	var description sql.NullString
+	var dueDateStr sql.NullString
+	var tagsJSON sql.NullString
+	var parentID sql.NullInt64
+	var recurrence, uid, caldavName sql.NullString
+	var statusStr string
+	var createdAt, updatedAt string
+	var deletedAt sql.NullString
+
+	dest := []interface{}{&t.ID, &t.Name, &description, &dueDateStr, &statusStr, &t.Priority, &tagsJSON, &parentID, &t.Progress, &recurrence, &uid, &caldavName, &t.Version, &createdAt, &updatedAt, &deletedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return t, err
+	}
+
+	if t.CreatedAt, err = parseTime(createdAt); err != nil {
+		return t, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	if t.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return t, fmt.Errorf("failed to parse updated_at: %w", err)
+	}
+	if deletedAt.Valid {
+		at, err := parseTime(deletedAt.String)
+		if err != nil {
+			return t, fmt.Errorf("failed to parse deleted_at: %w", err)
+		}
+		t.DeletedAt = &at
+	}
+
+	t.Description = description.String
+	t.ParentID = parentID.Int64
+	t.Recurrence = recurrence.String
+	t.UID = uid.String
+	t.CalDAVName = caldavName.String
+	t.Status = model.Status(statusStr)
+
+	// Parse due_date
+	if dueDateStr.Valid && dueDateStr.String != "" {
+		dueDate, err := parseTime(dueDateStr.String)
+		if err != nil {
+			return t, fmt.Errorf("failed to parse due_date: %w", err)
+		}
+		t.DueDate = dueDate
+	}
+
+	// Parse tags JSON
+	if tagsJSON.String != "" {
+		if err := json.Unmarshal([]byte(tagsJSON.String), &t.Tags); err != nil {
+			return t, fmt.Errorf("failed to unmarshal tags: %w", err)
+		}
+	}
+	// Ensure tags is never nil (always at least an empty slice)
+	if t.Tags == nil {
+		t.Tags = []string{}
 	}
 
-	// Apply FilterAndSort for consistent behavior with in-memory store
-	// This handles any remaining filtering and ensures sorting is consistent
-	return cache.FilterAndSort(todos, opts), nil
+	return t, nil
+}
+
+// nullID stores a zero id reference as NULL
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// timeLayout is the storage format for timestamp columns: always UTC with
+// fixed-width milliseconds, so lexical order equals chronological order and
+// ORDER BY / range filters can use the TEXT indexes directly.
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+// formatTime converts t to its stored form; the zero time is stored as NULL
+func formatTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(timeLayout), Valid: true}
+}
+
+// parseTime parses a stored timestamp, accepting the legacy SQLite format
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		// Try alternative format
+		t, err = time.Parse("2006-01-02 15:04:05", s)
+	}
+	return t, err
 }
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -33,6 +35,7 @@ func setupTestDB(t *testing.T) (*SQLiteStore, func()) {
 
 // TestSQLiteStore_CreateGetUpdateDelete_List tests basic CRUD operations
 func TestSQLiteStore_CreateGetUpdateDelete_List(t *testing.T) {
+	ctx := context.Background()
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
 
@@ -46,7 +49,7 @@ func TestSQLiteStore_CreateGetUpdateDelete_List(t *testing.T) {
 		Tags:        []string{"work", "urgent"},
 	}
 
-	id, err := store.Create(todo)
+	id, err := store.Create(ctx, todo)
 	if err != nil {
 		t.Fatalf("create failed: %v", err)
 	}
@@ -55,7 +58,7 @@ func TestSQLiteStore_CreateGetUpdateDelete_List(t *testing.T) {
 	}
 
 	// Get
-	got, err := store.Get(id)
+	got, err := store.Get(ctx, id)
 	if err != nil {
 		t.Fatalf("get failed: %v", err)
 	}
@@ -87,12 +90,12 @@ func TestSQLiteStore_CreateGetUpdateDelete_List(t *testing.T) {
 	// Update
 	got.Description = "updated"
 	got.Status = todo2.InProgress
-	if err := store.Update(got); err != nil {
+	if err := store.Update(ctx, got); err != nil {
 		t.Fatalf("update failed: %v", err)
 	}
 
 	// Verify update
-	updated, err := store.Get(id)
+	updated, err := store.Get(ctx, id)
 	if err != nil {
 		t.Fatalf("get after update failed: %v", err)
 	}
@@ -104,18 +107,18 @@ func TestSQLiteStore_CreateGetUpdateDelete_List(t *testing.T) {
 	}
 
 	// Delete
-	if err := store.Delete(id); err != nil {
+	if err := store.Delete(ctx, id, time.Now()); err != nil {
 		t.Fatalf("delete failed: %v", err)
 	}
 
 	// Verify deletion
-	_, err = store.Get(id)
+	_, err = store.Get(ctx, id)
 	if err != cache.ErrNotFound {
 		t.Errorf("expected ErrNotFound after delete, got %v", err)
 	}
 
 	// List (should be empty)
-	list, err := store.List(cache.ListOptions{})
+	list, err := store.List(ctx, cache.ListOptions{})
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
@@ -126,6 +129,7 @@ func TestSQLiteStore_CreateGetUpdateDelete_List(t *testing.T) {
 
 // TestSQLiteStore_ListOptions_SortAndFilter tests filtering and sorting
 func TestSQLiteStore_ListOptions_SortAndFilter(t *testing.T) {
+	ctx := context.Background()
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
 
@@ -134,12 +138,12 @@ func TestSQLiteStore_ListOptions_SortAndFilter(t *testing.T) {
 	t2 := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
 	t3 := time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)
 
-	_, _ = store.Create(&todo2.Todo{Name: "alpha", DueDate: t2, Status: todo2.InProgress})
-	id2, _ := store.Create(&todo2.Todo{Name: "bravo", DueDate: t1, Status: todo2.NotStarted})
-	_, _ = store.Create(&todo2.Todo{Name: "charlie", DueDate: t3, Status: todo2.Completed})
+	_, _ = store.Create(ctx, &todo2.Todo{Name: "alpha", DueDate: t2, Status: todo2.InProgress})
+	id2, _ := store.Create(ctx, &todo2.Todo{Name: "bravo", DueDate: t1, Status: todo2.NotStarted})
+	_, _ = store.Create(ctx, &todo2.Todo{Name: "charlie", DueDate: t3, Status: todo2.Completed})
 
 	// filter by status
-	list, err := store.List(cache.ListOptions{Status: todo2.NotStarted})
+	list, err := store.List(ctx, cache.ListOptions{Status: todo2.NotStarted})
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
@@ -151,7 +155,7 @@ func TestSQLiteStore_ListOptions_SortAndFilter(t *testing.T) {
 	}
 
 	// sort by due_date asc
-	list, err = store.List(cache.ListOptions{SortBy: "due_date", SortOrder: "asc"})
+	list, err = store.List(ctx, cache.ListOptions{SortBy: "due_date", SortOrder: "asc"})
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
@@ -163,7 +167,7 @@ func TestSQLiteStore_ListOptions_SortAndFilter(t *testing.T) {
 	}
 
 	// sort by due_date desc
-	list, err = store.List(cache.ListOptions{SortBy: "due_date", SortOrder: "desc"})
+	list, err = store.List(ctx, cache.ListOptions{SortBy: "due_date", SortOrder: "desc"})
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
@@ -172,7 +176,7 @@ func TestSQLiteStore_ListOptions_SortAndFilter(t *testing.T) {
 	}
 
 	// sort by name asc
-	list, err = store.List(cache.ListOptions{SortBy: "name", SortOrder: "asc"})
+	list, err = store.List(ctx, cache.ListOptions{SortBy: "name", SortOrder: "asc"})
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
@@ -181,7 +185,7 @@ func TestSQLiteStore_ListOptions_SortAndFilter(t *testing.T) {
 	}
 
 	// sort by status asc
-	list, err = store.List(cache.ListOptions{SortBy: "status", SortOrder: "asc"})
+	list, err = store.List(ctx, cache.ListOptions{SortBy: "status", SortOrder: "asc"})
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
@@ -196,17 +200,18 @@ func TestSQLiteStore_ListOptions_SortAndFilter(t *testing.T) {
 
 // TestSQLiteStore_Create_EdgeCases tests edge cases for Create
 func TestSQLiteStore_Create_EdgeCases(t *testing.T) {
+	ctx := context.Background()
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
 
 	t.Run("creates api with default status when empty", func(t *testing.T) {
 		todo := &todo2.Todo{Name: "Test Todo"}
-		id, err := store.Create(todo)
+		id, err := store.Create(ctx, todo)
 		if err != nil {
 			t.Fatalf("create failed: %v", err)
 		}
 
-		got, err := store.Get(id)
+		got, err := store.Get(ctx, id)
 		if err != nil {
 			t.Fatalf("get failed: %v", err)
 		}
@@ -218,12 +223,12 @@ func TestSQLiteStore_Create_EdgeCases(t *testing.T) {
 
 	t.Run("creates api without due date", func(t *testing.T) {
 		todo := &todo2.Todo{Name: "No Due Date"}
-		id, err := store.Create(todo)
+		id, err := store.Create(ctx, todo)
 		if err != nil {
 			t.Fatalf("create failed: %v", err)
 		}
 
-		got, err := store.Get(id)
+		got, err := store.Get(ctx, id)
 		if err != nil {
 			t.Fatalf("get failed: %v", err)
 		}
@@ -235,12 +240,12 @@ func TestSQLiteStore_Create_EdgeCases(t *testing.T) {
 
 	t.Run("creates api with empty tags", func(t *testing.T) {
 		todo := &todo2.Todo{Name: "Empty Tags", Tags: []string{}}
-		id, err := store.Create(todo)
+		id, err := store.Create(ctx, todo)
 		if err != nil {
 			t.Fatalf("create failed: %v", err)
 		}
 
-		got, err := store.Get(id)
+		got, err := store.Get(ctx, id)
 		if err != nil {
 			t.Fatalf("get failed: %v", err)
 		}
@@ -252,12 +257,12 @@ func TestSQLiteStore_Create_EdgeCases(t *testing.T) {
 
 	t.Run("creates api with nil tags", func(t *testing.T) {
 		todo := &todo2.Todo{Name: "Nil Tags", Tags: nil}
-		id, err := store.Create(todo)
+		id, err := store.Create(ctx, todo)
 		if err != nil {
 			t.Fatalf("create failed: %v", err)
 		}
 
-		got, err := store.Get(id)
+		got, err := store.Get(ctx, id)
 		if err != nil {
 			t.Fatalf("get failed: %v", err)
 		}
@@ -269,17 +274,17 @@ func TestSQLiteStore_Create_EdgeCases(t *testing.T) {
 	})
 
 	t.Run("creates multiple todos with sequential IDs", func(t *testing.T) {
-		id1, err := store.Create(&todo2.Todo{Name: "Todo 1"})
+		id1, err := store.Create(ctx, &todo2.Todo{Name: "Todo 1"})
 		if err != nil {
 			t.Fatalf("create 1 failed: %v", err)
 		}
 
-		id2, err := store.Create(&todo2.Todo{Name: "Todo 2"})
+		id2, err := store.Create(ctx, &todo2.Todo{Name: "Todo 2"})
 		if err != nil {
 			t.Fatalf("create 2 failed: %v", err)
 		}
 
-		id3, err := store.Create(&todo2.Todo{Name: "Todo 3"})
+		id3, err := store.Create(ctx, &todo2.Todo{Name: "Todo 3"})
 		if err != nil {
 			t.Fatalf("create 3 failed: %v", err)
 		}
@@ -295,11 +300,12 @@ func TestSQLiteStore_Create_EdgeCases(t *testing.T) {
 
 // TestSQLiteStore_Get_EdgeCases tests edge cases for Get
 func TestSQLiteStore_Get_EdgeCases(t *testing.T) {
+	ctx := context.Background()
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
 
 	t.Run("returns ErrNotFound for non-existent api", func(t *testing.T) {
-		_, err := store.Get(999)
+		_, err := store.Get(ctx, 999)
 		if err != cache.ErrNotFound {
 			t.Errorf("expected ErrNotFound, got %v", err)
 		}
@@ -312,12 +318,12 @@ func TestSQLiteStore_Get_EdgeCases(t *testing.T) {
 			Tags: tags,
 		}
 
-		id, err := store.Create(todo)
+		id, err := store.Create(ctx, todo)
 		if err != nil {
 			t.Fatalf("create failed: %v", err)
 		}
 
-		got, err := store.Get(id)
+		got, err := store.Get(ctx, id)
 		if err != nil {
 			t.Fatalf("get failed: %v", err)
 		}
@@ -335,6 +341,7 @@ func TestSQLiteStore_Get_EdgeCases(t *testing.T) {
 
 // TestSQLiteStore_Update_EdgeCases tests edge cases for Update
 func TestSQLiteStore_Update_EdgeCases(t *testing.T) {
+	ctx := context.Background()
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
 
@@ -347,7 +354,7 @@ func TestSQLiteStore_Update_EdgeCases(t *testing.T) {
 			Tags:        []string{"old"},
 		}
 
-		id, err := store.Create(original)
+		id, err := store.Create(ctx, original)
 		if err != nil {
 			t.Fatalf("create failed: %v", err)
 		}
@@ -362,12 +369,12 @@ func TestSQLiteStore_Update_EdgeCases(t *testing.T) {
 			Tags:        []string{"new", "updated"},
 		}
 
-		err = store.Update(updated)
+		err = store.Update(ctx, updated)
 		if err != nil {
 			t.Fatalf("update failed: %v", err)
 		}
 
-		got, err := store.Get(id)
+		got, err := store.Get(ctx, id)
 		if err != nil {
 			t.Fatalf("get failed: %v", err)
 		}
@@ -394,7 +401,7 @@ func TestSQLiteStore_Update_EdgeCases(t *testing.T) {
 
 	t.Run("returns ErrNotFound for non-existent api", func(t *testing.T) {
 		todo := &todo2.Todo{ID: 999, Name: "Non-existent"}
-		err := store.Update(todo)
+		err := store.Update(ctx, todo)
 		if err != cache.ErrNotFound {
 			t.Errorf("expected ErrNotFound, got %v", err)
 		}
@@ -404,19 +411,19 @@ func TestSQLiteStore_Update_EdgeCases(t *testing.T) {
 		dueDate := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
 		todo := &todo2.Todo{Name: "With Date", DueDate: dueDate}
 
-		id, err := store.Create(todo)
+		id, err := store.Create(ctx, todo)
 		if err != nil {
 			t.Fatalf("create failed: %v", err)
 		}
 
 		// Update to remove due date
 		updated := &todo2.Todo{ID: id, Name: "Without Date", DueDate: time.Time{}}
-		err = store.Update(updated)
+		err = store.Update(ctx, updated)
 		if err != nil {
 			t.Fatalf("update failed: %v", err)
 		}
 
-		got, err := store.Get(id)
+		got, err := store.Get(ctx, id)
 		if err != nil {
 			t.Fatalf("get failed: %v", err)
 		}
@@ -430,36 +437,37 @@ func TestSQLiteStore_Update_EdgeCases(t *testing.T) {
 
 // TestSQLiteStore_Delete_EdgeCases tests edge cases for Delete
 func TestSQLiteStore_Delete_EdgeCases(t *testing.T) {
+	ctx := context.Background()
 	store, cleanup := setupTestDB(t)
 	defer cleanup()
 
 	t.Run("returns ErrNotFound for non-existent api", func(t *testing.T) {
-		err := store.Delete(999)
+		err := store.Delete(ctx, 999, time.Now())
 		if err != cache.ErrNotFound {
 			t.Errorf("expected ErrNotFound, got %v", err)
 		}
 	})
 
 	t.Run("can delete multiple todos", func(t *testing.T) {
-		id1, _ := store.Create(&todo2.Todo{Name: "Todo 1"})
-		id2, _ := store.Create(&todo2.Todo{Name: "Todo 2"})
-		id3, _ := store.Create(&todo2.Todo{Name: "Todo 3"})
+		id1, _ := store.Create(ctx, &todo2.Todo{Name: "Todo 1"})
+		id2, _ := store.Create(ctx, &todo2.Todo{Name: "Todo 2"})
+		id3, _ := store.Create(ctx, &todo2.Todo{Name: "Todo 3"})
 
 		// Delete middle one
-		if err := store.Delete(id2); err != nil {
+		if err := store.Delete(ctx, id2, time.Now()); err != nil {
 			t.Fatalf("delete failed: %v", err)
 		}
 
 		// Verify others still exist
-		if _, err := store.Get(id1); err != nil {
+		if _, err := store.Get(ctx, id1); err != nil {
 			t.Errorf("api 1 should still exist: %v", err)
 		}
-		if _, err := store.Get(id3); err != nil {
+		if _, err := store.Get(ctx, id3); err != nil {
 			t.Errorf("api 3 should still exist: %v", err)
 		}
 
 		// Verify deleted one is gone
-		if _, err := store.Get(id2); err != cache.ErrNotFound {
+		if _, err := store.Get(ctx, id2); err != cache.ErrNotFound {
 			t.Errorf("api 2 should be deleted, got: %v", err)
 		}
 	})
@@ -467,6 +475,7 @@ func TestSQLiteStore_Delete_EdgeCases(t *testing.T) {
 
 // TestSQLiteStore_Persistence tests that data persists across store instances
 func TestSQLiteStore_Persistence(t *testing.T) {
+	ctx := context.Background()
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "persist_test.db")
 
@@ -476,10 +485,12 @@ func TestSQLiteStore_Persistence(t *testing.T) {
 		t.Fatalf("failed to create first store: %v", err)
 	}
 
-	id, err := store1.Create(&todo2.Todo{
+	id, err := store1.Create(ctx, &todo2.Todo{
 		Name:        "Persistent Todo",
 		Description: "This should persist",
 		Status:      todo2.Completed,
+		UID:         "abc@example.com",
+		CalDAVName:  "abc.ics",
 	})
 	if err != nil {
 		t.Fatalf("create failed: %v", err)
@@ -495,7 +506,7 @@ func TestSQLiteStore_Persistence(t *testing.T) {
 	defer store2.Close()
 
 	// Verify data persisted
-	got, err := store2.Get(id)
+	got, err := store2.Get(ctx, id)
 	if err != nil {
 		t.Fatalf("get failed after reopening: %v", err)
 	}
@@ -509,10 +520,14 @@ func TestSQLiteStore_Persistence(t *testing.T) {
 	if got.Status != todo2.Completed {
 		t.Errorf("expected status %q, got %q", todo2.Completed, got.Status)
 	}
+	if got.UID != "abc@example.com" || got.CalDAVName != "abc.ics" {
+		t.Errorf("expected the CalDAV identity kept, got %q and %q", got.UID, got.CalDAVName)
+	}
 }
 
 // TestSQLiteStore_Close tests the Close function
 func TestSQLiteStore_Close(t *testing.T) {
+	ctx := context.Background()
 	t.Run("closes database connection", func(t *testing.T) {
 		store, _ := setupTestDB(t)
 
@@ -522,7 +537,7 @@ func TestSQLiteStore_Close(t *testing.T) {
 		}
 
 		// Attempting to use closed store should fail
-		_, err = store.Create(&todo2.Todo{Name: "Should Fail"})
+		_, err = store.Create(ctx, &todo2.Todo{Name: "Should Fail"})
 		if err == nil {
 			t.Fatal("expected error when using closed store")
 		}
@@ -589,3 +604,591 @@ func TestNewSQLiteStore(t *testing.T) {
 		}
 	})
 }
+
+// TestSQLiteStore_List_MatchesInMemory tests that SQL filtering, sorting and
+// pagination return exactly what the in-memory store returns
+func TestSQLiteStore_List_MatchesInMemory(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	mem := cache.NewInMemoryStore()
+
+	plus8 := time.FixedZone("UTC+8", 8*60*60)
+	items := []todo2.Todo{
+		{Name: "delta", DueDate: time.Date(2026, 1, 2, 8, 0, 0, 0, plus8), Status: todo2.InProgress, Priority: 2},
+		{Name: "alpha", DueDate: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), Status: todo2.NotStarted, Priority: 5},
+		{Name: "charlie", Status: todo2.Completed, Priority: 2},
+		{Name: "bravo", DueDate: time.Date(2026, 1, 1, 20, 0, 0, 0, plus8), Status: todo2.NotStarted},
+		{Name: "alpha", DueDate: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), Status: todo2.InProgress, Priority: 1},
+		{Name: "Éclair", Description: "Café au lait", Status: todo2.NotStarted, Priority: 3},
+	}
+	for _, it := range items {
+		a, b := it, it
+		if _, err := store.Create(ctx, &a); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+		if _, err := mem.Create(ctx, &b); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+
+	var cases []cache.ListOptions
+	for _, sortBy := range []string{"", "id", "due_date", "status", "name", "priority", "created_at", "updated_at", "bogus"} {
+		for _, order := range []string{"asc", "desc"} {
+			cases = append(cases,
+				cache.ListOptions{SortBy: sortBy, SortOrder: order},
+				cache.ListOptions{SortBy: sortBy, SortOrder: order, Limit: 2},
+				cache.ListOptions{SortBy: sortBy, SortOrder: order, Limit: 2, Offset: 2},
+				cache.ListOptions{SortBy: sortBy, SortOrder: order, Offset: 4},
+				cache.ListOptions{SortBy: sortBy, SortOrder: order, Status: todo2.InProgress},
+			)
+		}
+	}
+	// case folding beyond ASCII
+	for _, q := range []string{"éclair", "ÉCLAIR", "CAFÉ", "ALPHA", "é"} {
+		cases = append(cases, cache.ListOptions{Query: q})
+	}
+
+	for _, opts := range cases {
+		got, err := store.List(ctx, opts)
+		if err != nil {
+			t.Fatalf("list %+v failed: %v", opts, err)
+		}
+		want, _ := mem.List(ctx, opts)
+		if len(got) != len(want) {
+			t.Fatalf("%+v: expected %d items, got %d", opts, len(want), len(got))
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID {
+				t.Fatalf("%+v: order mismatch at %d: sqlite %v, memory %v", opts, i, getIDs(got), getIDs(want))
+			}
+		}
+
+		// resuming after each item with a cursor matches in both stores
+		if opts.Limit != 0 || opts.Offset != 0 {
+			continue
+		}
+		all := got
+		for i, at := range want {
+			// each store issues cursors from its own rows, whose
+			// timestamps differ in precision
+			next, memNext := opts, opts
+			next.Cursor = cache.NewCursor(all[i], opts)
+			memNext.Cursor = cache.NewCursor(at, opts)
+			got, err := store.List(ctx, next)
+			if err != nil {
+				t.Fatalf("list with cursor failed: %v", err)
+			}
+			exp, _ := mem.List(ctx, memNext)
+			if len(got) != len(exp) {
+				t.Fatalf("%+v after %d: sqlite %v, memory %v", opts, at.ID, getIDs(got), getIDs(exp))
+			}
+			for i := range exp {
+				if got[i].ID != exp[i].ID {
+					t.Fatalf("%+v after %d: sqlite %v, memory %v", opts, at.ID, getIDs(got), getIDs(exp))
+				}
+			}
+		}
+	}
+}
+
+func getIDs(todos []todo2.Todo) []int64 {
+	ids := make([]int64, len(todos))
+	for i, t := range todos {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// TestSQLiteStore_Update_Version tests optimistic concurrency on Update
+func TestSQLiteStore_Update_Version(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	todo := &todo2.Todo{Name: "task"}
+	id, err := store.Create(ctx, todo)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if todo.Version != 1 {
+		t.Fatalf("expected version 1 after create, got %d", todo.Version)
+	}
+
+	update := &todo2.Todo{ID: id, Name: "v2", Version: 1}
+	if err := store.Update(ctx, update); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if update.Version != 2 {
+		t.Fatalf("expected version 2 written back, got %d", update.Version)
+	}
+
+	if err := store.Update(ctx, &todo2.Todo{ID: id, Name: "stale", Version: 1}); err != cache.ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	got, _ := store.Get(ctx, id)
+	if got.Name != "v2" || got.Version != 2 {
+		t.Fatalf("stale update should not apply, got %q v%d", got.Name, got.Version)
+	}
+
+	if err := store.Update(ctx, &todo2.Todo{ID: 999, Name: "missing", Version: 1}); err != cache.ErrNotFound {
+		t.Fatalf("expected ErrNotFound for missing row, got %v", err)
+	}
+}
+
+// TestSQLiteStore_Timestamps tests created_at/updated_at maintenance and
+// the updated_since filter
+func TestSQLiteStore_Timestamps(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	before := time.Now().Add(-time.Second)
+	todo := &todo2.Todo{Name: "task"}
+	id, err := store.Create(ctx, todo)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if todo.CreatedAt.Before(before) || !todo.UpdatedAt.Equal(todo.CreatedAt) {
+		t.Fatalf("unexpected timestamps after create: %v / %v", todo.CreatedAt, todo.UpdatedAt)
+	}
+
+	got, _ := store.Get(ctx, id)
+	if !got.CreatedAt.Equal(todo.CreatedAt) || !got.UpdatedAt.Equal(todo.UpdatedAt) {
+		t.Fatalf("stored timestamps differ: %v / %v", got.CreatedAt, got.UpdatedAt)
+	}
+
+	_, _ = store.Create(ctx, &todo2.Todo{Name: "untouched"})
+
+	time.Sleep(5 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	// a client-supplied created_at must not overwrite the stored one
+	update := &todo2.Todo{ID: id, Name: "changed", CreatedAt: time.Unix(0, 0)}
+	if err := store.Update(ctx, update); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	got, _ = store.Get(ctx, id)
+	if !got.CreatedAt.Equal(todo.CreatedAt) {
+		t.Errorf("created_at changed on update: %v", got.CreatedAt)
+	}
+	if !got.UpdatedAt.After(since) || !got.UpdatedAt.Equal(update.UpdatedAt) {
+		t.Errorf("expected updated_at after %v, got %v", since, got.UpdatedAt)
+	}
+
+	list, err := store.List(ctx, cache.ListOptions{UpdatedSince: since})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != id {
+		t.Fatalf("expected only the updated todo, got %v", getIDs(list))
+	}
+
+	list, _ = store.List(ctx, cache.ListOptions{SortBy: "updated_at", SortOrder: "desc"})
+	if len(list) != 2 || list[0].ID != id {
+		t.Fatalf("expected most recently updated first, got %v", getIDs(list))
+	}
+}
+
+// TestSQLiteStore_List_RichFilters tests that every ListOptions filter
+// selects the same todos as the in-memory store
+func TestSQLiteStore_List_RichFilters(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+	mem := cache.NewInMemoryStore()
+
+	past := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	future := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	items := []todo2.Todo{
+		{Name: "Deploy API", Description: "ship it", DueDate: past, Status: todo2.InProgress, Priority: 5, Tags: []string{"ops", "backend"}},
+		{Name: "Write docs", Description: "API reference", DueDate: future, Status: todo2.NotStarted, Priority: 1, Tags: []string{"docs"}},
+		{Name: "Fix login", DueDate: past, Status: todo2.Completed, Priority: 3, Tags: []string{"backend"}},
+		{Name: "Plan sprint", Status: todo2.NotStarted, Priority: 0},
+	}
+	for _, it := range items {
+		a, b := it, it
+		store.Create(ctx, &a)
+		mem.Create(ctx, &b)
+	}
+
+	one, three := 1, 3
+	cases := map[string]cache.ListOptions{
+		"statuses":      {Statuses: []todo2.Status{todo2.NotStarted, todo2.Completed}},
+		"status+list":   {Status: todo2.InProgress, Statuses: []todo2.Status{todo2.Completed}},
+		"tags any":      {TagsAny: []string{"docs", "ops"}},
+		"tags all":      {TagsAll: []string{"ops", "backend"}},
+		"priority min":  {PriorityMin: &three},
+		"priority span": {PriorityMin: &one, PriorityMax: &three},
+		"due after":     {DueAfter: time.Now()},
+		"due before":    {DueBefore: time.Now()},
+		"overdue":       {Overdue: true},
+		"query name":    {Query: "api"},
+		"query desc":    {Query: "SHIP"},
+		"combined":      {TagsAny: []string{"backend"}, Overdue: true, Query: "deploy"},
+	}
+
+	for name, opts := range cases {
+		got, err := store.List(ctx, opts)
+		if err != nil {
+			t.Fatalf("%s: list failed: %v", name, err)
+		}
+		want, _ := mem.List(ctx, opts)
+		if len(want) == 0 {
+			t.Fatalf("%s: fixture should match something", name)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: sqlite %v, memory %v", name, getIDs(got), getIDs(want))
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID {
+				t.Fatalf("%s: sqlite %v, memory %v", name, getIDs(got), getIDs(want))
+			}
+		}
+	}
+}
+
+func TestSQLiteStore_Search(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	deploy, _ := store.Create(ctx, &todo2.Todo{Name: "Deploy release", Description: "roll out to production", Tags: []string{"ops"}})
+	docs, _ := store.Create(ctx, &todo2.Todo{Name: "Write docs", Description: "document the deploy process"})
+	_, _ = store.Create(ctx, &todo2.Todo{Name: "Groceries", Tags: []string{"home"}})
+
+	res, err := store.Search(ctx, "deploy", 0)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(res) != 2 || res[0].Todo.ID != deploy || res[1].Todo.ID != docs {
+		t.Fatalf("expected deploy then docs, got %+v", res)
+	}
+	if res[0].Snippet != "<mark>Deploy</mark> release" {
+		t.Errorf("unexpected snippet %q", res[0].Snippet)
+	}
+	if res[0].Score <= res[1].Score {
+		t.Errorf("expected higher score first, got %v then %v", res[0].Score, res[1].Score)
+	}
+
+	if res, _ := store.Search(ctx, "depl prod", 0); len(res) != 1 || res[0].Todo.ID != deploy {
+		t.Errorf("expected only deploy for prefix AND query, got %+v", res)
+	}
+	if res, _ := store.Search(ctx, "home", 0); len(res) != 1 {
+		t.Errorf("expected tag match, got %+v", res)
+	}
+	// FTS5 syntax in user input is treated as plain words
+	if _, err := store.Search(ctx, `"deploy OR NEAR(* -`, 0); err != nil {
+		t.Errorf("expected query syntax to be escaped, got %v", err)
+	}
+
+	// triggers keep the index in sync
+	got, _ := store.Get(ctx, docs)
+	got.Description = "explain the release process"
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if res, _ := store.Search(ctx, "deploy", 0); len(res) != 1 {
+		t.Errorf("expected stale terms to be dropped, got %+v", res)
+	}
+	if err := store.Delete(ctx, deploy, time.Now()); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if res, _ := store.Search(ctx, "deploy", 0); len(res) != 0 {
+		t.Errorf("expected no results after delete, got %+v", res)
+	}
+}
+
+func TestSQLiteStore_ParentID(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	root := &todo2.Todo{Name: "root", Progress: 50}
+	rootID, _ := store.Create(ctx, root)
+	childID, _ := store.Create(ctx, &todo2.Todo{Name: "child", ParentID: rootID})
+	_, _ = store.Create(ctx, &todo2.Todo{Name: "other"})
+
+	got, err := store.Get(ctx, childID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got.ParentID != rootID {
+		t.Errorf("expected parent %d, got %d", rootID, got.ParentID)
+	}
+	if got, _ := store.Get(ctx, rootID); got.Progress != 50 || got.ParentID != 0 {
+		t.Errorf("expected top-level root at 50%%, got parent %d progress %d", got.ParentID, got.Progress)
+	}
+
+	top := int64(0)
+	list, err := store.List(ctx, cache.ListOptions{ParentID: &top})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("expected 2 top-level todos, got %d", len(list))
+	}
+	list, _ = store.List(ctx, cache.ListOptions{ParentID: &rootID})
+	if len(list) != 1 || list[0].ID != childID {
+		t.Errorf("expected only the child, got %v", getIDs(list))
+	}
+
+	got.ParentID = 0
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if got, _ := store.Get(ctx, childID); got.ParentID != 0 {
+		t.Errorf("expected child moved to top level, got parent %d", got.ParentID)
+	}
+}
+
+func TestSQLiteStore_Dependencies(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	a, _ := store.Create(ctx, &todo2.Todo{Name: "a"})
+	b, _ := store.Create(ctx, &todo2.Todo{Name: "b"})
+	c, _ := store.Create(ctx, &todo2.Todo{Name: "c"})
+
+	for _, d := range [][2]int64{{b, a}, {c, a}, {c, b}, {c, b}} {
+		if err := store.AddDependency(ctx, d[0], d[1]); err != nil {
+			t.Fatalf("add %v failed: %v", d, err)
+		}
+	}
+	if err := store.AddDependency(ctx, c, 999); err != cache.ErrNotFound {
+		t.Errorf("expected ErrNotFound for unknown blocker, got %v", err)
+	}
+
+	if ids, _ := store.Blockers(ctx, c); len(ids) != 2 || ids[0] != a || ids[1] != b {
+		t.Errorf("expected c blocked by a and b, got %v", ids)
+	}
+	if ids, _ := store.Dependents(ctx, a); len(ids) != 2 || ids[0] != b || ids[1] != c {
+		t.Errorf("expected a to block b and c, got %v", ids)
+	}
+
+	if err := store.RemoveDependency(ctx, c, b); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if err := store.RemoveDependency(ctx, c, b); err != cache.ErrNotFound {
+		t.Errorf("expected ErrNotFound removing twice, got %v", err)
+	}
+
+	if err := store.Delete(ctx, a, time.Now()); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if ids, _ := store.Blockers(ctx, c); len(ids) != 0 {
+		t.Errorf("expected dependencies on a deleted todo to be hidden, got %v", ids)
+	}
+}
+
+func TestSQLiteStore_SoftDelete(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	a, _ := store.Create(ctx, &todo2.Todo{Name: "write release notes"})
+	b, _ := store.Create(ctx, &todo2.Todo{Name: "publish release"})
+	if err := store.AddDependency(ctx, b, a); err != nil {
+		t.Fatalf("add dependency failed: %v", err)
+	}
+
+	if err := store.Delete(ctx, a, time.Now()); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, a, time.Now()); err != cache.ErrNotFound {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if _, err := store.Get(ctx, a); err != cache.ErrNotFound {
+		t.Errorf("expected a trashed todo to be hidden from Get, got %v", err)
+	}
+	if err := store.Update(ctx, &todo2.Todo{ID: a, Name: "x"}); err != cache.ErrNotFound {
+		t.Errorf("expected ErrNotFound updating a trashed todo, got %v", err)
+	}
+	if list, _ := store.List(ctx, cache.ListOptions{}); len(list) != 1 || list[0].ID != b {
+		t.Errorf("expected only the live todo listed, got %+v", list)
+	}
+	if results, _ := store.Search(ctx, "release", 0); len(results) != 1 || results[0].Todo.ID != b {
+		t.Errorf("expected search to skip the trash, got %+v", results)
+	}
+	if ids, _ := store.Blockers(ctx, b); len(ids) != 0 {
+		t.Errorf("expected a trashed blocker to be ignored, got %v", ids)
+	}
+
+	trash, err := store.List(ctx, cache.ListOptions{Deleted: true})
+	if err != nil || len(trash) != 1 || trash[0].ID != a || trash[0].DeletedAt == nil || trash[0].Version != 2 {
+		t.Fatalf("unexpected trash %+v, err %v", trash, err)
+	}
+
+	restored, err := store.Restore(ctx, a)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Version != 3 || restored.Name != "write release notes" {
+		t.Errorf("unexpected restored todo %+v", restored)
+	}
+	if _, err := store.Restore(ctx, a); err != cache.ErrNotFound {
+		t.Errorf("expected ErrNotFound restoring a live todo, got %v", err)
+	}
+	if ids, _ := store.Blockers(ctx, b); len(ids) != 1 || ids[0] != a {
+		t.Errorf("expected the dependency to come back with the todo, got %v", ids)
+	}
+
+	// only todos deleted before the cutoff are purged
+	store.Delete(ctx, a, time.Now())
+	if n, err := store.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("expected nothing purged, got %d, %v", n, err)
+	}
+	if n, err := store.Purge(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("expected one todo purged, got %d, %v", n, err)
+	}
+	if _, err := store.Restore(ctx, a); err != cache.ErrNotFound {
+		t.Errorf("expected a purged todo to be gone, got %v", err)
+	}
+	var deps int
+	store.db.QueryRow(`SELECT COUNT(*) FROM todo_dependencies`).Scan(&deps)
+	if deps != 0 {
+		t.Errorf("expected purged dependencies to go, %d left", deps)
+	}
+}
+
+func TestSQLiteStore_Audit(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	entries := []*todo2.AuditEntry{
+		{TodoID: 1, Action: todo2.AuditCreate, Actor: "alice", RequestID: "r1",
+			Changes: []todo2.FieldChange{{Field: "name", New: []byte(`"a"`)}}},
+		{TodoID: 1, Action: todo2.AuditUpdate, Actor: "bob", RequestID: "r2",
+			Changes: []todo2.FieldChange{{Field: "name", Old: []byte(`"a"`), New: []byte(`"b"`)}}},
+		{TodoID: 2, Action: todo2.AuditDelete},
+	}
+	for _, e := range entries {
+		if err := store.AddAudit(ctx, e); err != nil {
+			t.Fatalf("add audit failed: %v", err)
+		}
+	}
+	if entries[2].ID != 3 || entries[2].CreatedAt.IsZero() {
+		t.Fatalf("expected id and created_at to be set, got %+v", entries[2])
+	}
+
+	got, err := store.ListAudit(ctx, cache.AuditOptions{TodoID: 1})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("expected two entries for todo 1, got %+v, %v", got, err)
+	}
+	c := got[1].Changes[0]
+	if got[1].Actor != "bob" || c.Field != "name" || string(c.Old) != `"a"` || string(c.New) != `"b"` {
+		t.Errorf("unexpected entry %+v", got[1])
+	}
+	if string(got[0].Changes[0].Old) != "null" {
+		t.Errorf("expected a missing old value to read back as null, got %s", got[0].Changes[0].Old)
+	}
+	if got, _ := store.ListAudit(ctx, cache.AuditOptions{}); len(got) != 3 || got[2].Changes == nil {
+		t.Errorf("expected every entry with non-nil changes, got %+v", got)
+	}
+
+	filters := map[string]cache.AuditOptions{
+		"actor":      {Actor: "alice"},
+		"action":     {Action: todo2.AuditDelete},
+		"request_id": {RequestID: "r2"},
+		"after":      {AfterID: 2},
+		"limit":      {Limit: 1},
+	}
+	for name, opts := range filters {
+		if got, err := store.ListAudit(ctx, opts); err != nil || len(got) != 1 {
+			t.Errorf("%s: expected one entry, got %+v, %v", name, got, err)
+		}
+	}
+	if got, _ := store.ListAudit(ctx, cache.AuditOptions{Since: time.Now().Add(time.Hour)}); len(got) != 0 {
+		t.Errorf("expected no entries recorded in the future, got %+v", got)
+	}
+	if got, _ := store.ListAudit(ctx, cache.AuditOptions{Until: time.Now().Add(time.Hour)}); len(got) != 3 {
+		t.Errorf("expected every entry before the cutoff, got %+v", got)
+	}
+}
+
+func TestSQLiteStore_WithTx(t *testing.T) {
+	ctx := context.Background()
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	a, _ := store.Create(ctx, &todo2.Todo{Name: "draft agenda"})
+	b, _ := store.Create(ctx, &todo2.Todo{Name: "book room"})
+
+	var created int64
+	err := store.WithTx(ctx, func(tx cache.Store) error {
+		var err error
+		if created, err = tx.Create(ctx, &todo2.Todo{Name: "send invites"}); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, &todo2.Todo{ID: a, Name: "final agenda", Version: 1}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, b, time.Now())
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if list, _ := store.List(ctx, cache.ListOptions{}); len(list) != 2 || created != 3 {
+		t.Fatalf("expected two live todos, got %+v", list)
+	}
+
+	// a stale update at the end rolls the transaction back
+	err = store.WithTx(ctx, func(tx cache.Store) error {
+		if _, err := tx.Create(ctx, &todo2.Todo{Name: "order lunch"}); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, a, time.Now()); err != nil {
+			return err
+		}
+		if err := tx.AddAudit(ctx, &todo2.AuditEntry{TodoID: a, Action: todo2.AuditDelete}); err != nil {
+			return err
+		}
+		// the transaction sees its own writes, and joins nested ones
+		return tx.WithTx(ctx, func(nested cache.Store) error {
+			if _, err := nested.Get(ctx, a); err != cache.ErrNotFound {
+				t.Errorf("expected the delete visible inside the transaction, got %v", err)
+			}
+			return nested.Update(ctx, &todo2.Todo{ID: created, Name: "late", Version: 5})
+		})
+	})
+	if !errors.Is(err, cache.ErrConflict) {
+		t.Fatalf("expected the last write to fail with ErrConflict, got %v", err)
+	}
+	if got, err := store.Get(ctx, a); err != nil || got.Name != "final agenda" {
+		t.Errorf("expected the delete rolled back, got %+v, %v", got, err)
+	}
+	if list, _ := store.List(ctx, cache.ListOptions{}); len(list) != 2 {
+		t.Errorf("expected the create rolled back, got %+v", list)
+	}
+	if entries, _ := store.ListAudit(ctx, cache.AuditOptions{}); len(entries) != 0 {
+		t.Errorf("expected the audit entry rolled back, got %+v", entries)
+	}
+}
+
+func TestSQLiteStore_CanceledContext(t *testing.T) {
+	store, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.Create(ctx, &todo2.Todo{Name: "never written"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Create to fail with context.Canceled, got %v", err)
+	}
+	if _, err := store.List(ctx, cache.ListOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected List to fail with context.Canceled, got %v", err)
+	}
+	err := store.WithTx(ctx, func(tx cache.Store) error {
+		t.Error("expected no transaction to start")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected WithTx to fail with context.Canceled, got %v", err)
+	}
+	if list, _ := store.List(context.Background(), cache.ListOptions{}); len(list) != 0 {
+		t.Errorf("expected nothing written, got %+v", list)
+	}
+}
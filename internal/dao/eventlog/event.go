@@ -0,0 +1,131 @@
+// Package eventlog implements an event-sourced api.Store. Every change is
+// appended to a log file as an Event; the current state is a projection of
+// the log kept in a cache.InMemoryStore and periodically snapshotted so
+// startup does not replay the whole history.
+package eventlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// EventType names a kind of change
+type EventType string
+
+const (
+	TodoCreated       EventType = "TodoCreated"
+	TodoUpdated       EventType = "TodoUpdated"
+	TodoDeleted       EventType = "TodoDeleted"
+	TodoRestored      EventType = "TodoRestored"
+	TodosPurged       EventType = "TodosPurged"
+	DependencyAdded   EventType = "DependencyAdded"
+	DependencyRemoved EventType = "DependencyRemoved"
+	AuditRecorded     EventType = "AuditRecorded"
+	BatchApplied      EventType = "BatchApplied"
+)
+
+// Event is one entry of the log. Todo events carry the complete todo after
+// the change, so replaying them needs no logic beyond storing it.
+type Event struct {
+	Seq        int64             `json:"seq"`
+	Type       EventType         `json:"type"`
+	At         time.Time         `json:"at"`
+	Todo       *model.Todo       `json:"todo,omitempty"`
+	Dependency *model.Dependency `json:"dependency,omitempty"`
+	Audit      *model.AuditEntry `json:"audit,omitempty"`
+	Before     time.Time         `json:"before,omitzero"` // TodosPurged: deleted before this time
+	Batch      []Event           `json:"batch,omitempty"` // BatchApplied: the events of one transaction, applied together
+}
+
+// apply replays e onto view
+func apply(view *cache.InMemoryStore, e Event) error {
+	// the projection is in memory, there is nothing to cancel
+	ctx := context.Background()
+	switch e.Type {
+	case TodoCreated, TodoUpdated, TodoDeleted, TodoRestored:
+		if e.Todo == nil {
+			return fmt.Errorf("event %d: %s without todo", e.Seq, e.Type)
+		}
+		view.Put(*e.Todo)
+	case TodosPurged:
+		if _, err := view.Purge(ctx, e.Before); err != nil {
+			return err
+		}
+	case DependencyAdded, DependencyRemoved:
+		if e.Dependency == nil {
+			return fmt.Errorf("event %d: %s without dependency", e.Seq, e.Type)
+		}
+		d := *e.Dependency
+		if e.Type == DependencyAdded {
+			return view.AddDependency(ctx, d.TodoID, d.BlockedBy)
+		}
+		return view.RemoveDependency(ctx, d.TodoID, d.BlockedBy)
+	case AuditRecorded:
+		if e.Audit == nil {
+			return fmt.Errorf("event %d: %s without entry", e.Seq, e.Type)
+		}
+		view.PutAudit(*e.Audit)
+	case BatchApplied:
+		for _, sub := range e.Batch {
+			sub.Seq = e.Seq
+			if err := apply(view, sub); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("event %d: unknown type %q", e.Seq, e.Type)
+	}
+	return nil
+}
+
+// errTruncated reports an incomplete last line, left by a crash mid-append
+var errTruncated = errors.New("truncated event")
+
+// readEvents decodes the events of r in order, one per line, calling fn for
+// each. It returns the offset just past the last complete event, so a
+// truncated tail can be cut off. A line that does not decode is an append
+// that failed halfway and was never committed; it is skipped as long as the
+// next event took the sequence number it would have had, which shows that
+// no committed event was lost with it.
+func readEvents(r io.Reader, fn func(Event) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var offset, pos, seq int64
+	torn := int64(-1) // start of an undecodable line no event followed yet
+	for {
+		line, err := br.ReadBytes('\n')
+		start := pos
+		pos += int64(len(line))
+		if err == io.EOF {
+			if len(line) > 0 || torn >= 0 {
+				return offset, errTruncated
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			if torn < 0 {
+				torn = start
+			}
+			continue
+		}
+		if torn >= 0 && seq > 0 && e.Seq != seq+1 {
+			return offset, fmt.Errorf("event log is damaged at offset %d: event %d follows event %d", torn, e.Seq, seq)
+		}
+		torn = -1
+		if err := fn(e); err != nil {
+			return offset, err
+		}
+		seq, offset = e.Seq, pos
+	}
+}
@@ -0,0 +1,513 @@
+package eventlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// File names inside the store directory
+const (
+	logFile = "events.jsonl"
+	// segmentFile is a log closed by a snapshot, named after its last event
+	segmentFile = "events-%020d.jsonl"
+	// snapshotFile is named after the event it includes and that event's
+	// time in Unix nanoseconds
+	snapshotFile = "snapshot-%020d-%d.json"
+)
+
+// DefaultSnapshotEvery is how many events are appended between snapshots
+const DefaultSnapshotEvery = 1000
+
+// snapshot is the on-disk form of a snapshot: the projection after event Seq
+type snapshot struct {
+	Seq   int64          `json:"seq"`
+	At    time.Time      `json:"at"`
+	State cache.Snapshot `json:"state"`
+}
+
+// EventStore implements api.Store on top of an append-only event log. Reads
+// are served by the in-memory projection; writes are validated against it,
+// appended to the log and then applied, so the log is always the source of
+// truth.
+type EventStore struct {
+	mu            sync.Mutex // serializes writes so log order is apply order
+	dir           string
+	log           *os.File
+	size          int64     // bytes of complete events in log
+	seq           int64     // last appended event
+	lastAt        time.Time // time of event seq
+	nextID        int64
+	nextAuditID   int64
+	snapshotSeq   int64 // event the newest snapshot includes
+	snapshotEvery int
+	sync          bool
+	view          *cache.InMemoryStore
+}
+
+// Option configures an EventStore
+type Option func(*EventStore)
+
+// WithSnapshotEvery sets how many events are appended between snapshots; 0
+// disables snapshots
+func WithSnapshotEvery(n int) Option {
+	return func(s *EventStore) { s.snapshotEvery = n }
+}
+
+// WithSync sets whether each event is flushed to disk before its write
+// returns, the default. Without it a crash of the process still loses
+// nothing, but a power loss can lose the writes the OS had not flushed yet.
+func WithSync(sync bool) Option {
+	return func(s *EventStore) { s.sync = sync }
+}
+
+// NewEventStore opens the event log in dir, creating it if needed, and
+// rebuilds the projection from the newest snapshot and the events after it
+func NewEventStore(dir string, opts ...Option) (*EventStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create event store directory: %w", err)
+	}
+	s := &EventStore{dir: dir, snapshotEvery: DefaultSnapshotEvery, sync: true, view: cache.NewInMemoryStore()}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.nextID, s.nextAuditID = 1, 1
+	snaps, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(snaps) > 0 {
+		snap, err := readSnapshot(snaps[len(snaps)-1].path)
+		if err != nil {
+			return nil, err
+		}
+		s.view = cache.NewInMemoryStoreFrom(snap.State)
+		s.seq, s.snapshotSeq, s.lastAt = snap.Seq, snap.Seq, snap.At
+		s.nextID = snap.State.NextID
+		s.nextAuditID = int64(len(snap.State.Audit)) + 1
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	offset, err := readEvents(f, func(e Event) error {
+		if e.Seq <= s.seq {
+			return nil // already in the snapshot
+		}
+		s.seq, s.lastAt = e.Seq, e.At
+		return s.applyLocked(e)
+	})
+	if errors.Is(err, errTruncated) {
+		// a crash cut the last append short; that change never happened
+		err = f.Truncate(offset)
+	}
+	if err == nil {
+		s.size, err = f.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to replay event log: %w", err)
+	}
+	s.log = f
+	return s, nil
+}
+
+// Close closes the event log
+func (s *EventStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
+
+// WithTx runs fn on a transaction of the projection. Its writes are
+// validated and applied there and their events collected; once fn returns
+// nil they are appended as one event, a BatchApplied when there are several,
+// so replay applies all of them or, after a crash mid-append, none.
+func (s *EventStore) WithTx(ctx context.Context, fn func(cache.Store) error) error {
+	return s.transact(ctx, func(tx *txStore) error { return fn(tx) })
+}
+
+// transact is WithTx for the store's own writes
+func (s *EventStore) transact(ctx context.Context, fn func(tx *txStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return errors.New("event store is closed")
+	}
+	// the request may have given up while waiting for the lock
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := s.view.Transact(func(view *cache.InMemoryStore) error {
+		tx := &txStore{view: view, nextID: s.nextID, nextAuditID: s.nextAuditID}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		// a failed append rolls the projection back with the transaction
+		return s.append(tx)
+	})
+	if err != nil {
+		return err
+	}
+	if s.snapshotEvery > 0 && s.seq-s.snapshotSeq >= int64(s.snapshotEvery) {
+		return s.snapshot()
+	}
+	return nil
+}
+
+// append writes the events of tx to the log, which already holds them
+// applied, and flushes it unless sync is off; callers hold mu
+func (s *EventStore) append(tx *txStore) error {
+	if len(tx.events) == 0 {
+		return nil
+	}
+	e := tx.events[0]
+	if len(tx.events) > 1 {
+		e = Event{Type: BatchApplied, At: time.Now().UTC(), Batch: tx.events}
+	}
+	e.Seq = s.seq + 1
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	b = append(b, '\n')
+	_, err = s.log.Write(b)
+	if err == nil && s.sync {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// cut off whatever reached the file so the next event starts on a
+		// line of its own; if even that fails, stop writing until a restart
+		// recovers the log
+		if terr := s.log.Truncate(s.size); terr != nil {
+			s.log.Close()
+			s.log = nil
+		} else {
+			s.log.Seek(s.size, io.SeekStart)
+		}
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+	s.size += int64(len(b))
+	s.seq, s.lastAt = e.Seq, e.At
+	s.nextID, s.nextAuditID = tx.nextID, tx.nextAuditID
+	return nil
+}
+
+// applyLocked applies e to the projection and advances the ID counters;
+// callers hold mu
+func (s *EventStore) applyLocked(e Event) error {
+	s.track(e)
+	return apply(s.view, e)
+}
+
+// track advances the ID counters past the IDs e assigns
+func (s *EventStore) track(e Event) {
+	if e.Todo != nil && e.Todo.ID >= s.nextID {
+		s.nextID = e.Todo.ID + 1
+	}
+	if e.Audit != nil && e.Audit.ID >= s.nextAuditID {
+		s.nextAuditID = e.Audit.ID + 1
+	}
+	for _, sub := range e.Batch {
+		s.track(sub)
+	}
+}
+
+// snapshot writes the projection next to the log and rotates the log, so
+// startup only reads the events after it; callers hold mu. Older snapshots
+// and logs stay for Events and AsOf.
+func (s *EventStore) snapshot() error {
+	b, err := json.Marshal(snapshot{Seq: s.seq, At: s.lastAt, State: s.view.Snapshot()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf(snapshotFile, s.seq, s.lastAt.UnixNano()))
+	if err := s.writeFile(name, b); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	s.snapshotSeq = s.seq
+	return s.rotate()
+}
+
+// writeFile replaces name atomically, so a crash leaves no partial file
+func (s *EventStore) writeFile(name string, b []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil && s.sync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// rotate moves the log, which ends at the newest snapshot, aside as a
+// segment and starts an empty one; callers hold mu. A crash in between is
+// harmless: startup skips the events the snapshot already holds.
+func (s *EventStore) rotate() error {
+	path := filepath.Join(s.dir, logFile)
+	segment := filepath.Join(s.dir, fmt.Sprintf(segmentFile, s.seq))
+	if err := os.Rename(path, segment); err != nil {
+		return fmt.Errorf("failed to rotate event log: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		// keep appending to the old log, where startup still looks
+		return errors.Join(fmt.Errorf("failed to rotate event log: %w", err), os.Rename(segment, path))
+	}
+	s.log.Close()
+	s.log, s.size = f, 0
+	return nil
+}
+
+// snapshotInfo is a snapshot file as named on disk
+type snapshotInfo struct {
+	path string
+	seq  int64
+	at   time.Time
+}
+
+// listSnapshots returns the snapshots in dir, oldest first
+func listSnapshots(dir string) ([]snapshotInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "snapshot-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var snaps []snapshotInfo
+	for _, p := range paths {
+		var seq, nanos int64
+		if _, err := fmt.Sscanf(filepath.Base(p), snapshotFile, &seq, &nanos); err != nil {
+			return nil, fmt.Errorf("unexpected snapshot file %s", p)
+		}
+		snaps = append(snaps, snapshotInfo{path: p, seq: seq, at: time.Unix(0, nanos).UTC()})
+	}
+	// the sequence numbers are zero-padded, so the names sort in order
+	return snaps, nil
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return &snap, nil
+}
+
+// Events returns the logged events with a sequence number greater than
+// after, oldest first
+func (s *EventStore) Events(after int64) ([]Event, error) {
+	var events []Event
+	err := s.replay(after, func(e Event) bool {
+		events = append(events, e)
+		return true
+	})
+	return events, err
+}
+
+// AsOf rebuilds the state as it was at the given moment from the newest
+// snapshot taken by then and the events after it
+func (s *EventStore) AsOf(at time.Time) (api.Store, error) {
+	snaps, err := listSnapshots(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	view := cache.NewInMemoryStore()
+	var from int64
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if snaps[i].at.After(at) {
+			continue
+		}
+		snap, err := readSnapshot(snaps[i].path)
+		if err != nil {
+			return nil, err
+		}
+		view, from = cache.NewInMemoryStoreFrom(snap.State), snap.Seq
+		break
+	}
+
+	var applyErr error
+	err = s.replay(from, func(e Event) bool {
+		if e.At.After(at) {
+			return false
+		}
+		applyErr = apply(view, e)
+		return applyErr == nil
+	})
+	if err == nil {
+		err = applyErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// replay reads the events after sequence number after, oldest first, until
+// fn returns false
+func (s *EventStore) replay(after int64, fn func(Event) bool) error {
+	files, err := s.openLogs(after)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	stop := errors.New("stop")
+	for _, f := range files {
+		_, err := readEvents(f, func(e Event) error {
+			if e.Seq <= after {
+				return nil
+			}
+			if !fn(e) {
+				return stop
+			}
+			return nil
+		})
+		if err == stop {
+			return nil
+		}
+		// a truncated tail is an append in progress
+		if err != nil && !errors.Is(err, errTruncated) {
+			return err
+		}
+	}
+	return nil
+}
+
+// openLogs opens the segments holding events after sequence number after
+// and the current log, oldest first. It holds mu so a rotation cannot move
+// events between listing and opening; open files read on across later ones.
+func (s *EventStore) openLogs(after int64) ([]*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	segments, err := filepath.Glob(filepath.Join(s.dir, "events-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range segments {
+		var last int64
+		if _, err := fmt.Sscanf(filepath.Base(p), segmentFile, &last); err != nil {
+			return nil, fmt.Errorf("unexpected event log segment %s", p)
+		}
+		if last > after {
+			paths = append(paths, p)
+		}
+	}
+	paths = append(paths, filepath.Join(s.dir, logFile))
+
+	var files []*os.File
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, fmt.Errorf("failed to open event log: %w", err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func (s *EventStore) Create(ctx context.Context, t *model.Todo) (id int64, err error) {
+	err = s.transact(ctx, func(tx *txStore) (err error) {
+		id, err = tx.Create(ctx, t)
+		return err
+	})
+	return id, err
+}
+
+func (s *EventStore) Get(ctx context.Context, id int64) (*model.Todo, error) {
+	return s.view.Get(ctx, id)
+}
+
+func (s *EventStore) Update(ctx context.Context, t *model.Todo) error {
+	return s.transact(ctx, func(tx *txStore) error { return tx.Update(ctx, t) })
+}
+
+func (s *EventStore) Delete(ctx context.Context, id int64, at time.Time) error {
+	return s.transact(ctx, func(tx *txStore) error { return tx.Delete(ctx, id, at) })
+}
+
+func (s *EventStore) Restore(ctx context.Context, id int64) (t *model.Todo, err error) {
+	err = s.transact(ctx, func(tx *txStore) (err error) {
+		t, err = tx.Restore(ctx, id)
+		return err
+	})
+	return t, err
+}
+
+func (s *EventStore) Purge(ctx context.Context, before time.Time) (n int64, err error) {
+	err = s.transact(ctx, func(tx *txStore) (err error) {
+		n, err = tx.Purge(ctx, before)
+		return err
+	})
+	return n, err
+}
+
+func (s *EventStore) List(ctx context.Context, opts cache.ListOptions) ([]model.Todo, error) {
+	return s.view.List(ctx, opts)
+}
+
+func (s *EventStore) Search(ctx context.Context, query string, limit int) ([]cache.SearchResult, error) {
+	return s.view.Search(ctx, query, limit)
+}
+
+func (s *EventStore) AddDependency(ctx context.Context, todoID, blockedBy int64) error {
+	return s.transact(ctx, func(tx *txStore) error { return tx.AddDependency(ctx, todoID, blockedBy) })
+}
+
+func (s *EventStore) RemoveDependency(ctx context.Context, todoID, blockedBy int64) error {
+	return s.transact(ctx, func(tx *txStore) error { return tx.RemoveDependency(ctx, todoID, blockedBy) })
+}
+
+func (s *EventStore) Blockers(ctx context.Context, todoID int64) ([]int64, error) {
+	return s.view.Blockers(ctx, todoID)
+}
+
+func (s *EventStore) Dependents(ctx context.Context, todoID int64) ([]int64, error) {
+	return s.view.Dependents(ctx, todoID)
+}
+
+func (s *EventStore) AddAudit(ctx context.Context, e *model.AuditEntry) error {
+	return s.transact(ctx, func(tx *txStore) error { return tx.AddAudit(ctx, e) })
+}
+
+func (s *EventStore) ListAudit(ctx context.Context, opts cache.AuditOptions) ([]model.AuditEntry, error) {
+	return s.view.ListAudit(ctx, opts)
+}
@@ -0,0 +1,405 @@
+package eventlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+var _ api.Store = (*EventStore)(nil)
+var _ api.TimeTraveler = (*EventStore)(nil)
+
+func openTestStore(t *testing.T, dir string, opts ...Option) *EventStore {
+	t.Helper()
+	s, err := NewEventStore(dir, opts...)
+	if err != nil {
+		t.Fatalf("open event store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestEventStore_CRUD(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t, t.TempDir())
+
+	todo := &model.Todo{Name: "a", Tags: []string{"x"}}
+	id, err := s.Create(ctx, todo)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if id != 1 || todo.Version != 1 || todo.Status != model.NotStarted || todo.CreatedAt.IsZero() {
+		t.Fatalf("unexpected created todo %+v", todo)
+	}
+	if _, err := s.Create(ctx, &model.Todo{}); err == nil {
+		t.Fatal("expected error for missing name")
+	}
+
+	todo.Name = "a2"
+	if err := s.Update(ctx, todo); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if todo.Version != 2 {
+		t.Fatalf("expected version 2, got %d", todo.Version)
+	}
+	stale := &model.Todo{ID: id, Name: "stale", Version: 1}
+	if err := s.Update(ctx, stale); err != cache.ErrConflict {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	if err := s.Delete(ctx, id, time.Now()); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Get(ctx, id); err != cache.ErrNotFound {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	restored, err := s.Restore(ctx, id)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored.Name != "a2" || restored.DeletedAt != nil {
+		t.Fatalf("unexpected restored todo %+v", restored)
+	}
+	if err := s.Delete(ctx, id, time.Now()); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	n, err := s.Purge(ctx, time.Now().Add(time.Second))
+	if err != nil || n != 1 {
+		t.Fatalf("purge: n=%d err=%v", n, err)
+	}
+	if _, err := s.Restore(ctx, id); err != cache.ErrNotFound {
+		t.Fatalf("expected ErrNotFound after purge, got %v", err)
+	}
+}
+
+func TestEventStore_ReopenRebuildsState(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+
+	a := &model.Todo{Name: "a", Priority: 2}
+	b := &model.Todo{Name: "b"}
+	c := &model.Todo{Name: "c"}
+	for _, todo := range []*model.Todo{a, b, c} {
+		if _, err := s.Create(ctx, todo); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	if err := s.AddDependency(ctx, a.ID, b.ID); err != nil {
+		t.Fatalf("add dependency: %v", err)
+	}
+	if err := s.Delete(ctx, c.ID, time.Now()); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := s.AddAudit(ctx, &model.AuditEntry{TodoID: a.ID, Action: model.AuditCreate, Actor: "alice"}); err != nil {
+		t.Fatalf("add audit: %v", err)
+	}
+	want := s.view.Snapshot()
+	s.Close()
+
+	s2 := openTestStore(t, dir)
+	if got := s2.view.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reopened state differs:\n got %+v\nwant %+v", got, want)
+	}
+	id, err := s2.Create(ctx, &model.Todo{Name: "d"})
+	if err != nil {
+		t.Fatalf("create after reopen: %v", err)
+	}
+	if id != 4 {
+		t.Fatalf("expected id 4 after reopen, got %d", id)
+	}
+	e := &model.AuditEntry{TodoID: id, Action: model.AuditCreate}
+	if err := s2.AddAudit(ctx, e); err != nil || e.ID != 2 {
+		t.Fatalf("expected audit id 2, got %d (err %v)", e.ID, err)
+	}
+}
+
+func TestEventStore_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, WithSnapshotEvery(2))
+
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := s.Create(ctx, &model.Todo{Name: name}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	if snaps, err := listSnapshots(dir); err != nil || len(snaps) != 1 || snaps[0].seq != 2 {
+		t.Fatalf("expected one snapshot at event 2, got %+v (err %v)", snaps, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf(segmentFile, 2))); err != nil {
+		t.Fatalf("expected the log up to the snapshot moved aside: %v", err)
+	}
+	s.Close()
+
+	// startup reads the snapshot and the one event logged after it
+	var current []int64
+	f, err := os.Open(filepath.Join(dir, logFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readEvents(f, func(e Event) error { current = append(current, e.Seq); return nil })
+	f.Close()
+	if !reflect.DeepEqual(current, []int64{3}) {
+		t.Fatalf("expected only event 3 in the current log, got %v", current)
+	}
+	s2 := openTestStore(t, dir, WithSnapshotEvery(2))
+	if s2.snapshotSeq != 2 || s2.seq != 3 {
+		t.Fatalf("expected snapshot at 2 and seq 3, got %d and %d", s2.snapshotSeq, s2.seq)
+	}
+	items, err := s2.List(ctx, cache.ListOptions{})
+	if err != nil || len(items) != 3 {
+		t.Fatalf("expected 3 todos after reopen, got %d (err %v)", len(items), err)
+	}
+	// the history is still complete
+	if events, err := s2.Events(0); err != nil || len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d (err %v)", len(events), err)
+	}
+}
+
+func TestEventStore_AsOfStartsFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, WithSnapshotEvery(2))
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := s.Create(ctx, &model.Todo{Name: name}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	mid := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := s.Create(ctx, &model.Todo{Name: "c"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// without the events before the snapshot, only the snapshot can answer
+	if err := os.Remove(filepath.Join(dir, fmt.Sprintf(segmentFile, 2))); err != nil {
+		t.Fatal(err)
+	}
+	past, err := s.AsOf(mid)
+	if err != nil {
+		t.Fatalf("as of: %v", err)
+	}
+	if items, _ := past.List(ctx, cache.ListOptions{}); len(items) != 2 {
+		t.Fatalf("expected 2 todos at the snapshot, got %+v", items)
+	}
+	now, err := s.AsOf(time.Now())
+	if err != nil {
+		t.Fatalf("as of: %v", err)
+	}
+	if items, _ := now.List(ctx, cache.ListOptions{}); len(items) != 3 {
+		t.Fatalf("expected 3 todos now, got %+v", items)
+	}
+}
+
+func TestEventStore_AsOf(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t, t.TempDir())
+
+	todo := &model.Todo{Name: "before"}
+	if _, err := s.Create(ctx, todo); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	mid := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	todo.Name = "after"
+	if err := s.Update(ctx, todo); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := s.Create(ctx, &model.Todo{Name: "later"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	past, err := s.AsOf(mid)
+	if err != nil {
+		t.Fatalf("as of: %v", err)
+	}
+	items, err := past.List(ctx, cache.ListOptions{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "before" || items[0].Version != 1 {
+		t.Fatalf("unexpected past state %+v", items)
+	}
+
+	before, err := s.AsOf(mid.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("as of: %v", err)
+	}
+	if items, _ := before.List(ctx, cache.ListOptions{}); len(items) != 0 {
+		t.Fatalf("expected no todos before the first event, got %d", len(items))
+	}
+}
+
+func TestEventStore_TruncatedTail(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	if _, err := s.Create(ctx, &model.Todo{Name: "a"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	s.Close()
+
+	// simulate a crash halfway through appending the second event
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":2,"type":"TodoCreated","todo":{"id":2,`)
+	f.Close()
+
+	s2 := openTestStore(t, dir)
+	items, err := s2.List(ctx, cache.ListOptions{})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected 1 todo, got %d (err %v)", len(items), err)
+	}
+	id, err := s2.Create(ctx, &model.Todo{Name: "b"})
+	if err != nil || id != 2 {
+		t.Fatalf("expected id 2, got %d (err %v)", id, err)
+	}
+	s2.Close()
+
+	s3 := openTestStore(t, dir)
+	if items, _ := s3.List(ctx, cache.ListOptions{}); len(items) != 2 {
+		t.Fatalf("expected 2 todos after the cut tail was overwritten, got %d", len(items))
+	}
+}
+
+func TestEventStore_TornLine(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, WithSync(false))
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := s.Create(ctx, &model.Todo{Name: name}); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	s.Close()
+	b, err := os.ReadFile(filepath.Join(dir, logFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	torn := `{"seq":2,"type":"TodoCreated","todo":{"id":2,` + "\n"
+
+	// an append that failed halfway, followed by the event that took its
+	// sequence number
+	os.WriteFile(filepath.Join(dir, logFile), []byte(lines[0]+torn+lines[1]+lines[2]), 0o644)
+	s2 := openTestStore(t, dir)
+	if items, err := s2.List(ctx, cache.ListOptions{}); err != nil || len(items) != 3 {
+		t.Fatalf("expected 3 todos past the torn line, got %d (err %v)", len(items), err)
+	}
+	s2.Close()
+
+	// a torn line hiding a committed event must not be skipped
+	os.WriteFile(filepath.Join(dir, logFile), []byte(lines[0]+torn+lines[2]), 0o644)
+	if _, err := NewEventStore(dir); err == nil || !strings.Contains(err.Error(), "damaged") {
+		t.Fatalf("expected the lost event reported, got %v", err)
+	}
+}
+
+func TestEventStore_Events(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t, t.TempDir())
+	todo := &model.Todo{Name: "a"}
+	if _, err := s.Create(ctx, todo); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := s.Update(ctx, todo); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := s.Delete(ctx, todo.ID, time.Now()); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	events, err := s.Events(1)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if want := []EventType{TodoUpdated, TodoDeleted}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("expected %v, got %v", want, types)
+	}
+	if events[0].Seq != 2 || events[0].Todo.Version != 2 {
+		t.Fatalf("unexpected event %+v", events[0])
+	}
+}
+
+func TestEventStore_WithTx(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	a := &model.Todo{Name: "a"}
+	if _, err := s.Create(ctx, a); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	err := s.WithTx(ctx, func(tx cache.Store) error {
+		if _, err := tx.Create(ctx, &model.Todo{Name: "b"}); err != nil {
+			return err
+		}
+		return tx.Update(ctx, &model.Todo{ID: 99, Name: "missing"})
+	})
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected the update to fail, got %v", err)
+	}
+	if events, _ := s.Events(0); len(events) != 1 {
+		t.Fatalf("expected nothing logged for a failed transaction, got %d events", len(events))
+	}
+	if _, err := s.Get(ctx, 2); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected the create rolled back, got %v", err)
+	}
+
+	created := &model.Todo{Name: "b"}
+	err = s.WithTx(ctx, func(tx cache.Store) error {
+		if _, err := tx.Create(ctx, created); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, &model.Todo{ID: created.ID, Name: "b2", Version: 1}); err != nil {
+			return err
+		}
+		if err := tx.AddAudit(ctx, &model.AuditEntry{TodoID: a.ID, Action: model.AuditDelete}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, a.ID, time.Now())
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	if created.ID != 2 || created.Version != 1 {
+		t.Fatalf("expected the created todo filled in, got %+v", created)
+	}
+	events, _ := s.Events(1)
+	if len(events) != 1 || events[0].Type != BatchApplied || len(events[0].Batch) != 4 {
+		t.Fatalf("expected one batch event, got %+v", events)
+	}
+	want := s.view.Snapshot()
+	s.Close()
+
+	s2 := openTestStore(t, dir)
+	if got := s2.view.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reopened state differs:\n got %+v\nwant %+v", got, want)
+	}
+	if got, err := s2.Get(ctx, 2); err != nil || got.Name != "b2" || got.Version != 2 {
+		t.Fatalf("unexpected todo after reopen %+v, %v", got, err)
+	}
+	if id, err := s2.Create(ctx, &model.Todo{Name: "c"}); err != nil || id != 3 {
+		t.Fatalf("expected id 3 after reopen, got %d (err %v)", id, err)
+	}
+}
@@ -0,0 +1,196 @@
+package eventlog
+
+import (
+	"context"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// txStore is the store an EventStore transaction runs on. Writes are
+// validated against the transaction's projection, applied to it and kept
+// as events until the transaction is appended to the log.
+type txStore struct {
+	view        *cache.InMemoryStore
+	nextID      int64
+	nextAuditID int64
+	events      []Event
+}
+
+// record applies e and keeps it for the log
+func (tx *txStore) record(e Event) error {
+	e.At = time.Now().UTC()
+	if err := apply(tx.view, e); err != nil {
+		return err
+	}
+	tx.events = append(tx.events, e)
+	return nil
+}
+
+// WithTx joins the running transaction
+func (tx *txStore) WithTx(ctx context.Context, fn func(cache.Store) error) error { return fn(tx) }
+
+// Create assigns the next ID and records a TodoCreated event
+func (tx *txStore) Create(ctx context.Context, t *model.Todo) (int64, error) {
+	if t.Name == "" {
+		return 0, api.ErrInvalid("name is required")
+	}
+	c := *t
+	c.ID = tx.nextID
+	if c.Status == "" {
+		c.Status = model.NotStarted
+	}
+	c.Version = 1
+	c.CreatedAt = time.Now().UTC()
+	c.UpdatedAt = c.CreatedAt
+	c.DeletedAt = nil
+	if err := tx.record(Event{Type: TodoCreated, Todo: &c}); err != nil {
+		return 0, err
+	}
+	tx.nextID++
+	*t = c
+	return c.ID, nil
+}
+
+func (tx *txStore) Get(ctx context.Context, id int64) (*model.Todo, error) {
+	return tx.view.Get(ctx, id)
+}
+
+// Update records a TodoUpdated event. A non-zero t.Version must match the
+// current version, otherwise ErrConflict is returned.
+func (tx *txStore) Update(ctx context.Context, t *model.Todo) error {
+	if t.ID == 0 {
+		return api.ErrInvalid("id is required")
+	}
+	cur, err := tx.view.Get(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	if t.Version != 0 && t.Version != cur.Version {
+		return cache.ErrConflict
+	}
+	c := *t
+	if c.Status == "" {
+		c.Status = model.NotStarted
+	}
+	c.Version = cur.Version + 1
+	c.CreatedAt = cur.CreatedAt
+	c.UpdatedAt = time.Now().UTC()
+	c.DeletedAt = nil
+	if err := tx.record(Event{Type: TodoUpdated, Todo: &c}); err != nil {
+		return err
+	}
+	*t = c
+	return nil
+}
+
+// Delete moves a todo to the trash with a TodoDeleted event
+func (tx *txStore) Delete(ctx context.Context, id int64, at time.Time) error {
+	c, err := tx.view.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	deleted := at.UTC()
+	c.DeletedAt = &deleted
+	c.UpdatedAt = time.Now().UTC()
+	c.Version++
+	return tx.record(Event{Type: TodoDeleted, Todo: c})
+}
+
+// Restore takes a todo out of the trash with a TodoRestored event
+func (tx *txStore) Restore(ctx context.Context, id int64) (*model.Todo, error) {
+	trash, err := tx.view.List(ctx, cache.ListOptions{Deleted: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range trash {
+		if c.ID != id {
+			continue
+		}
+		c.DeletedAt = nil
+		c.UpdatedAt = time.Now().UTC()
+		c.Version++
+		if err := tx.record(Event{Type: TodoRestored, Todo: &c}); err != nil {
+			return nil, err
+		}
+		return &c, nil
+	}
+	return nil, cache.ErrNotFound
+}
+
+// Purge records a TodosPurged event when any todo was deleted before the
+// given time
+func (tx *txStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	trash, err := tx.view.List(ctx, cache.ListOptions{Deleted: true})
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, t := range trash {
+		if t.DeletedAt.Before(before) {
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, tx.record(Event{Type: TodosPurged, Before: before.UTC()})
+}
+
+func (tx *txStore) List(ctx context.Context, opts cache.ListOptions) ([]model.Todo, error) {
+	return tx.view.List(ctx, opts)
+}
+
+func (tx *txStore) Search(ctx context.Context, query string, limit int) ([]cache.SearchResult, error) {
+	return tx.view.Search(ctx, query, limit)
+}
+
+// AddDependency records a DependencyAdded event unless the dependency
+// already exists
+func (tx *txStore) AddDependency(ctx context.Context, todoID, blockedBy int64) error {
+	for _, id := range []int64{todoID, blockedBy} {
+		if _, err := tx.view.Get(ctx, id); err != nil {
+			return err
+		}
+	}
+	if tx.view.HasDependency(todoID, blockedBy) {
+		return nil
+	}
+	return tx.record(Event{Type: DependencyAdded, Dependency: &model.Dependency{TodoID: todoID, BlockedBy: blockedBy}})
+}
+
+// RemoveDependency records a DependencyRemoved event, or returns
+// ErrNotFound
+func (tx *txStore) RemoveDependency(ctx context.Context, todoID, blockedBy int64) error {
+	if !tx.view.HasDependency(todoID, blockedBy) {
+		return cache.ErrNotFound
+	}
+	return tx.record(Event{Type: DependencyRemoved, Dependency: &model.Dependency{TodoID: todoID, BlockedBy: blockedBy}})
+}
+
+func (tx *txStore) Blockers(ctx context.Context, todoID int64) ([]int64, error) {
+	return tx.view.Blockers(ctx, todoID)
+}
+
+func (tx *txStore) Dependents(ctx context.Context, todoID int64) ([]int64, error) {
+	return tx.view.Dependents(ctx, todoID)
+}
+
+// AddAudit records an AuditRecorded event, setting e's ID and CreatedAt
+func (tx *txStore) AddAudit(ctx context.Context, e *model.AuditEntry) error {
+	c := *e
+	c.ID = tx.nextAuditID
+	c.CreatedAt = time.Now().UTC()
+	if err := tx.record(Event{Type: AuditRecorded, Audit: &c}); err != nil {
+		return err
+	}
+	tx.nextAuditID++
+	*e = c
+	return nil
+}
+
+func (tx *txStore) ListAudit(ctx context.Context, opts cache.AuditOptions) ([]model.AuditEntry, error) {
+	return tx.view.ListAudit(ctx, opts)
+}
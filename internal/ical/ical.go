@@ -0,0 +1,429 @@
+// Package ical reads and writes todos as RFC 5545 iCalendar components.
+// Todos become VTODO components, or VEVENT components spanning the day they
+// are due for calendar apps that do not show tasks:
+//
+//	Name        SUMMARY
+//	Description DESCRIPTION
+//	DueDate     DUE (VTODO), DTSTART and DTEND (VEVENT)
+//	Status      STATUS (VTODO) and X-TODO-STATUS when STATUS cannot hold it
+//	Priority    PRIORITY, 1 the most important
+//	Tags        CATEGORIES
+//	Progress    PERCENT-COMPLETE (VTODO)
+//	ParentID    RELATED-TO;RELTYPE=PARENT
+//	Recurrence  RRULE
+//
+// A todo's UID is the one a CalDAV client gave it, or else "todo-<id>",
+// see UID.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// Component is the kind of calendar component todos are written as
+type Component string
+
+const (
+	VTodo  Component = "VTODO"
+	VEvent Component = "VEVENT"
+)
+
+const (
+	dateTimeLayout = "20060102T150405Z"
+	dateLayout     = "20060102"
+)
+
+// statuses maps todo statuses to VTODO statuses. Other statuses are written
+// as NEEDS-ACTION with an X-TODO-STATUS property.
+var statuses = map[model.Status]string{
+	model.NotStarted: "NEEDS-ACTION",
+	model.InProgress: "IN-PROCESS",
+	model.Completed:  "COMPLETED",
+}
+
+// Item is a todo read from a calendar together with its UID and the kind
+// of component it was read from
+type Item struct {
+	UID       string
+	Component Component
+	Todo      model.Todo
+}
+
+// UID is the UID of the todo with the given ID
+func UID(id int64) string { return "todo-" + strconv.FormatInt(id, 10) }
+
+// ParseUID returns the todo ID of a UID made by UID
+func ParseUID(uid string) (int64, bool) {
+	v, ok := strings.CutPrefix(uid, "todo-")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// Encode writes todos to w as one VCALENDAR of c components
+func Encode(w io.Writer, todos []model.Todo, c Component) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.begin()
+	for _, t := range todos {
+		e.component(t, c)
+	}
+	e.end()
+	return e.flush()
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) begin() {
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", "-//conbanwa//todo//EN")
+	e.line("CALSCALE", "GREGORIAN")
+}
+
+func (e *encoder) end() { e.line("END", "VCALENDAR") }
+
+func (e *encoder) component(t model.Todo, c Component) {
+	e.line("BEGIN", string(c))
+	uid := t.UID
+	if uid == "" {
+		uid = UID(t.ID)
+	}
+	e.line("UID", uid)
+	stamp := t.UpdatedAt
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	e.line("DTSTAMP", formatTime(stamp))
+	if !t.CreatedAt.IsZero() {
+		e.line("CREATED", formatTime(t.CreatedAt))
+	}
+	if !t.UpdatedAt.IsZero() {
+		e.line("LAST-MODIFIED", formatTime(t.UpdatedAt))
+	}
+	if t.Version > 0 {
+		e.line("SEQUENCE", strconv.FormatInt(t.Version-1, 10))
+	}
+	e.line("SUMMARY", escape(t.Name))
+	if t.Description != "" {
+		e.line("DESCRIPTION", escape(t.Description))
+	}
+	if !t.DueDate.IsZero() {
+		if c == VEvent {
+			day := t.DueDate.UTC()
+			e.line("DTSTART;VALUE=DATE", day.Format(dateLayout))
+			e.line("DTEND;VALUE=DATE", day.AddDate(0, 0, 1).Format(dateLayout))
+		} else {
+			e.line("DUE", formatTime(t.DueDate))
+		}
+	}
+	status, known := statuses[t.Status]
+	if c == VTodo && t.Status != "" {
+		if !known {
+			status = statuses[model.NotStarted]
+		}
+		e.line("STATUS", status)
+	}
+	if t.Status != "" && (c == VEvent || !known) {
+		e.line("X-TODO-STATUS", escape(string(t.Status)))
+	}
+	if t.Priority > 0 {
+		e.line("PRIORITY", strconv.Itoa(min(t.Priority, 9)))
+	}
+	if len(t.Tags) > 0 {
+		tags := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			tags[i] = escape(tag)
+		}
+		e.line("CATEGORIES", strings.Join(tags, ","))
+	}
+	if c == VTodo {
+		e.line("PERCENT-COMPLETE", strconv.Itoa(t.Progress))
+	}
+	if t.ParentID != 0 {
+		e.line("RELATED-TO;RELTYPE=PARENT", UID(t.ParentID))
+	}
+	if t.Recurrence != "" {
+		e.line("RRULE", t.Recurrence)
+	}
+	e.line("END", string(c))
+}
+
+// line writes a content line, folded after 75 octets as RFC 5545 asks
+func (e *encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+	s := name + ":" + value
+	for len(s) > 75 {
+		cut := 75
+		// do not split a UTF-8 sequence
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		e.write(s[:cut] + "\r\n ")
+		s = s[cut:]
+	}
+	e.write(s + "\r\n")
+}
+
+func (e *encoder) write(s string) {
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+func (e *encoder) flush() error {
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+func formatTime(t time.Time) string { return t.UTC().Format(dateTimeLayout) }
+
+// escape escapes a TEXT value
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// Decode reads the VTODO and VEVENT components of the calendars in r
+func Decode(r io.Reader) ([]Item, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	var cur *Item
+	var status model.Status // X-TODO-STATUS of cur
+	for n, l := range lines {
+		p, err := parseLine(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		switch {
+		case p.name == "BEGIN" && (p.value == string(VTodo) || p.value == string(VEvent)) && cur == nil:
+			cur, status = &Item{Component: Component(p.value)}, ""
+		case p.name == "END" && cur != nil && p.value == string(cur.Component):
+			// STATUS wins unless it is the NEEDS-ACTION standing in for
+			// another status, so clients can complete such todos
+			if status != "" && (cur.Todo.Status == "" || cur.Todo.Status == model.NotStarted) {
+				cur.Todo.Status = status
+			}
+			items = append(items, *cur)
+			cur = nil
+		case cur != nil && p.name == "X-TODO-STATUS":
+			status = model.Status(unescape(p.value))
+		case cur != nil:
+			if err := cur.set(p); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+		}
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("%s %q is not closed", cur.Component, cur.UID)
+	}
+	return items, nil
+}
+
+// set reads one property of a component into the item
+func (it *Item) set(p property) error {
+	t := &it.Todo
+	switch p.name {
+	case "UID":
+		it.UID = p.value
+	case "SUMMARY":
+		t.Name = unescape(p.value)
+	case "DESCRIPTION":
+		t.Description = unescape(p.value)
+	case "DUE", "DTSTART":
+		// events are due on the day they start
+		if p.name == "DTSTART" && it.Component != VEvent {
+			return nil
+		}
+		d, err := parseTime(p)
+		if err != nil {
+			return err
+		}
+		t.DueDate = d
+	case "STATUS":
+		for s, v := range statuses {
+			if strings.EqualFold(v, p.value) {
+				t.Status = s
+			}
+		}
+	case "PRIORITY":
+		n, err := strconv.Atoi(p.value)
+		if err != nil || n < 0 || n > 9 {
+			return fmt.Errorf("invalid PRIORITY %q", p.value)
+		}
+		t.Priority = n
+	case "CATEGORIES":
+		for _, tag := range splitText(p.value) {
+			if tag != "" {
+				t.Tags = append(t.Tags, tag)
+			}
+		}
+	case "PERCENT-COMPLETE":
+		n, err := strconv.Atoi(p.value)
+		if err != nil || n < 0 || n > 100 {
+			return fmt.Errorf("invalid PERCENT-COMPLETE %q", p.value)
+		}
+		t.Progress = n
+	case "RELATED-TO":
+		if rel := p.params["RELTYPE"]; rel == "" || strings.EqualFold(rel, "PARENT") {
+			t.ParentID, _ = ParseUID(p.value)
+		}
+	case "RRULE":
+		t.Recurrence = p.value
+	}
+	return nil
+}
+
+// property is one content line: NAME;PARAM=VALUE:value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseLine splits an unfolded content line. Parameter values may be
+// quoted; names are upper-cased.
+func parseLine(l string) (property, error) {
+	p := property{params: make(map[string]string)}
+	i := strings.IndexAny(l, ";:")
+	if i < 0 {
+		return p, fmt.Errorf("invalid content line %q", l)
+	}
+	p.name = strings.ToUpper(l[:i])
+	rest := l[i:]
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return p, fmt.Errorf("invalid parameter in %q", l)
+		}
+		key := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return p, fmt.Errorf("unterminated parameter in %q", l)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return p, fmt.Errorf("invalid content line %q", l)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		p.params[key] = value
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return p, fmt.Errorf("invalid content line %q", l)
+	}
+	p.value = rest[1:]
+	if p.name == "BEGIN" || p.name == "END" {
+		p.value = strings.ToUpper(p.value)
+	}
+	return p, nil
+}
+
+// unfold reads the content lines of r, joining folded lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if l == "" {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, sc.Err()
+}
+
+// parseTime reads a DATE or DATE-TIME value. Floating times and unknown
+// TZIDs are taken as UTC.
+func parseTime(p property) (time.Time, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len(dateLayout) {
+		d, err := time.Parse(dateLayout, p.value)
+		if err != nil {
+			return d, fmt.Errorf("invalid %s %q", p.name, p.value)
+		}
+		return d, nil
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		d, err := time.Parse(dateTimeLayout, p.value)
+		if err != nil {
+			return d, fmt.Errorf("invalid %s %q", p.name, p.value)
+		}
+		return d, nil
+	}
+	loc := time.UTC
+	if tz := p.params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	d, err := time.ParseInLocation("20060102T150405", p.value, loc)
+	if err != nil {
+		return d, fmt.Errorf("invalid %s %q", p.name, p.value)
+	}
+	return d.UTC(), nil
+}
+
+// unescape undoes escape
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// splitText splits a list of TEXT values at unescaped commas
+func splitText(s string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			out = append(out, unescape(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(out, unescape(s[start:]))
+}
@@ -0,0 +1,177 @@
+package ical
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestEncode(t *testing.T) {
+	at := time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)
+	todo := model.Todo{
+		ID:          3,
+		Name:        "Ship release, finally",
+		Description: "tag; build\nannounce",
+		DueDate:     time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC),
+		Status:      model.InProgress,
+		Priority:    2,
+		Tags:        []string{"work", "a,b"},
+		ParentID:    1,
+		Progress:    50,
+		Recurrence:  "FREQ=WEEKLY;BYDAY=MO",
+		Version:     4,
+		CreatedAt:   at,
+		UpdatedAt:   at,
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, []model.Todo{todo}, VTodo); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//conbanwa//todo//EN",
+		"CALSCALE:GREGORIAN",
+		"BEGIN:VTODO",
+		"UID:todo-3",
+		"DTSTAMP:20240401T093000Z",
+		"CREATED:20240401T093000Z",
+		"LAST-MODIFIED:20240401T093000Z",
+		"SEQUENCE:3",
+		`SUMMARY:Ship release\, finally`,
+		`DESCRIPTION:tag\; build\nannounce`,
+		"DUE:20240501T170000Z",
+		"STATUS:IN-PROCESS",
+		"PRIORITY:2",
+		`CATEGORIES:work,a\,b`,
+		"PERCENT-COMPLETE:50",
+		"RELATED-TO;RELTYPE=PARENT:todo-1",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	if buf.String() != want {
+		t.Errorf("Encode() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	todo.Status = "review"
+	Encode(&buf, []model.Todo{todo}, VEvent)
+	for _, line := range []string{"BEGIN:VEVENT", "DTSTART;VALUE=DATE:20240501", "DTEND;VALUE=DATE:20240502", "X-TODO-STATUS:review"} {
+		if !strings.Contains(buf.String(), line+"\r\n") {
+			t.Errorf("expected %q in the event, got\n%s", line, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "STATUS:NEEDS-ACTION") || strings.Contains(buf.String(), "DUE:") {
+		t.Errorf("expected no VTODO properties in the event, got\n%s", buf.String())
+	}
+}
+
+func TestEncode_Folding(t *testing.T) {
+	var buf bytes.Buffer
+	Encode(&buf, []model.Todo{{ID: 1, Name: strings.Repeat("ü", 60)}}, VTodo)
+	for _, l := range strings.Split(buf.String(), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line longer than 75 octets: %q", l)
+		}
+	}
+	items, err := Decode(&buf)
+	if err != nil || len(items) != 1 || items[0].Todo.Name != strings.Repeat("ü", 60) {
+		t.Errorf("expected the folded name back, got %+v, %v", items, err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	in := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VTODO",
+		"UID:abc@example.com",
+		`SUMMARY:Call mom\, soon`,
+		`DESCRIPTION:line one\nline`,
+		"  two",
+		"DUE;TZID=Europe/Berlin:20240501T090000",
+		"STATUS:COMPLETED",
+		"PRIORITY:1",
+		"CATEGORIES:family,phone",
+		"RELATED-TO:todo-7",
+		"END:VTODO",
+		"BEGIN:VEVENT",
+		"UID:todo-4",
+		"SUMMARY:Dentist",
+		"DTSTART;VALUE=DATE:20240502",
+		"X-TODO-STATUS:review",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"UID:todo-5",
+		"SUMMARY:Reviewed",
+		"X-TODO-STATUS:review",
+		"STATUS:COMPLETED",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+	items, err := Decode(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	want := []Item{
+		{UID: "abc@example.com", Component: VTodo, Todo: model.Todo{
+			Name:        "Call mom, soon",
+			Description: "line one\nline two",
+			DueDate:     time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC),
+			Status:      model.Completed,
+			Priority:    1,
+			Tags:        []string{"family", "phone"},
+			ParentID:    7,
+		}},
+		{UID: "todo-4", Component: VEvent, Todo: model.Todo{Name: "Dentist", DueDate: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), Status: "review"}},
+		// a client completed a todo of a custom status
+		{UID: "todo-5", Component: VTodo, Todo: model.Todo{Name: "Reviewed", Status: model.Completed}},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("Decode() = %+v, want %+v", items, want)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"BEGIN:VTODO\nSUMMARY:x\n",
+		"BEGIN:VTODO\nDUE:tomorrow\nEND:VTODO\n",
+		"BEGIN:VTODO\nPRIORITY:high\nEND:VTODO\n",
+		"BEGIN:VTODO\nno colon here\nEND:VTODO\n",
+	} {
+		if _, err := Decode(strings.NewReader(in)); err == nil {
+			t.Errorf("Decode(%q) should fail", in)
+		}
+	}
+}
+
+func TestEncode_ClientUID(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, []model.Todo{{ID: 3, UID: "abc@example.com", Name: "a"}}, VTodo); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\r\nUID:abc@example.com\r\n") {
+		t.Errorf("expected the client's UID, got\n%s", buf.String())
+	}
+}
+
+func TestParseUID(t *testing.T) {
+	if id, ok := ParseUID(UID(42)); !ok || id != 42 {
+		t.Errorf("ParseUID(UID(42)) = %d, %v", id, ok)
+	}
+	for _, uid := range []string{"42", "todo-", "todo-x", "todo-0", "abc@example.com"} {
+		if _, ok := ParseUID(uid); ok {
+			t.Errorf("ParseUID(%q) should fail", uid)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package model
+
+// Dependency records that TodoID is blocked by BlockedBy: TodoID cannot be
+// completed while BlockedBy is still open.
+type Dependency struct {
+	TodoID    int64 `json:"todo_id"`
+	BlockedBy int64 `json:"blocked_by"`
+}
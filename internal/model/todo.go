@@ -11,11 +11,20 @@ const (
 )
 
 type Todo struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	DueDate     time.Time `json:"due_date,omitempty"`
-	Status      Status    `json:"status"`
-	Priority    int       `json:"priority,omitempty"`
-	Tags        []string  `json:"tags,omitempty"`
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	DueDate     time.Time  `json:"due_date,omitempty"`
+	Status      Status     `json:"status"`
+	Priority    int        `json:"priority,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ParentID    int64      `json:"parent_id,omitempty"`   // 0 for top-level todos
+	Progress    int        `json:"progress"`              // completion percentage, rolled up from subtasks
+	Recurrence  string     `json:"recurrence,omitempty"`  // RFC 5545 RRULE, e.g. FREQ=WEEKLY;BYDAY=MO
+	UID         string     `json:"uid,omitempty"`         // iCalendar UID a CalDAV client gave the todo; todo-<id> when empty
+	CalDAVName  string     `json:"caldav_name,omitempty"` // CalDAV resource name the todo was created under; <id>.ics when empty
+	Version     int64      `json:"version"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // set while the todo is in the trash
 }
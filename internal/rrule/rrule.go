@@ -0,0 +1,320 @@
+// Package rrule implements the subset of RFC 5545 recurrence rules used for
+// recurring todos: FREQ=DAILY|WEEKLY|MONTHLY with INTERVAL, BYDAY, COUNT and
+// UNTIL. Weeks start on Monday (WKST=MO).
+package rrule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the FREQ part of a rule
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// Day is one BYDAY entry. N selects the nth weekday of the month for
+// MONTHLY rules (1 = first, -1 = last); it is 0 everywhere else.
+type Day struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule is a parsed recurrence rule
+type Rule struct {
+	Freq     Frequency
+	Interval int // always >= 1 after Parse
+	ByDay    []Day
+	Count    int       // occurrences left including the current one, 0 for unlimited
+	Until    time.Time // last allowed occurrence, zero for none
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// untilLayouts are the accepted UNTIL forms: UTC date-time or date
+var untilLayouts = []string{"20060102T150405Z", "20060102T150405", "20060102"}
+
+// Parse parses a rule such as "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=10". An
+// "RRULE:" prefix is allowed.
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+	s = strings.TrimSpace(s)
+	if len(s) >= 6 && strings.EqualFold(s[:6], "RRULE:") {
+		s = s[6:]
+	}
+	if s == "" {
+		return r, fmt.Errorf("empty rule")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, fmt.Errorf("invalid rule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly {
+				return r, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return r, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				d, err := parseDay(v)
+				if err != nil {
+					return r, err
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+		case "WKST":
+			if strings.ToUpper(value) != "MO" {
+				return r, fmt.Errorf("unsupported WKST %q", value)
+			}
+		default:
+			return r, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return r, fmt.Errorf("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return r, fmt.Errorf("COUNT and UNTIL are mutually exclusive")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly {
+			return r, fmt.Errorf("numbered BYDAY is only supported with FREQ=MONTHLY")
+		}
+	}
+	return r, nil
+}
+
+func parseUntil(v string) (time.Time, error) {
+	for _, layout := range untilLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			if layout == "20060102" {
+				// a date-only UNTIL includes the whole day
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", v)
+}
+
+func parseDay(v string) (Day, error) {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	if len(v) < 2 {
+		return Day{}, fmt.Errorf("invalid BYDAY %q", v)
+	}
+	wd, ok := weekdays[v[len(v)-2:]]
+	if !ok {
+		return Day{}, fmt.Errorf("invalid BYDAY %q", v)
+	}
+	d := Day{Weekday: wd}
+	if prefix := v[:len(v)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return Day{}, fmt.Errorf("invalid BYDAY %q", v)
+		}
+		d.N = n
+	}
+	return d, nil
+}
+
+// String formats the rule in canonical RRULE form, without prefix
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// String formats the day as in BYDAY, e.g. "MO" or "-1FR"
+func (d Day) String() string {
+	code := strings.ToUpper(d.Weekday.String()[:2])
+	if d.N != 0 {
+		return strconv.Itoa(d.N) + code
+	}
+	return code
+}
+
+// maxSteps bounds the search for the next occurrence so a rule that can
+// never match (e.g. the 5th Monday with a long INTERVAL) cannot spin forever
+const maxSteps = 5000
+
+// Next returns the first occurrence strictly after prev, keeping prev's
+// time of day and location. prev is assumed to be an occurrence itself and
+// anchors the INTERVAL. ok is false when the rule is exhausted: COUNT has
+// no occurrences left after prev or the next one falls after UNTIL.
+func (r Rule) Next(prev time.Time) (next time.Time, ok bool) {
+	if r.Count == 1 {
+		return time.Time{}, false
+	}
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	switch r.Freq {
+	case Daily:
+		next = prev.AddDate(0, 0, interval)
+		for i := 0; len(r.ByDay) > 0 && !r.hasWeekday(next.Weekday()) && i < maxSteps; i++ {
+			next = next.AddDate(0, 0, interval)
+		}
+		if len(r.ByDay) > 0 && !r.hasWeekday(next.Weekday()) {
+			return time.Time{}, false
+		}
+	case Weekly:
+		next, ok = r.nextWeekly(prev, interval)
+		if !ok {
+			return time.Time{}, false
+		}
+	case Monthly:
+		next, ok = r.nextMonthly(prev, interval)
+		if !ok {
+			return time.Time{}, false
+		}
+	default:
+		return time.Time{}, false
+	}
+
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Reachable reports whether BYDAY can match a date the rule steps to from
+// start. A DAILY rule whose INTERVAL is a multiple of 7 never leaves
+// start's weekday, so BYDAY must hold it; every other rule reaches all
+// weekdays.
+func (r Rule) Reachable(start time.Time) bool {
+	if r.Freq != Daily || len(r.ByDay) == 0 || r.Interval < 7 || r.Interval%7 != 0 {
+		return true
+	}
+	return r.hasWeekday(start.Weekday())
+}
+
+// After returns the rule for the occurrence following the current one,
+// with COUNT decremented
+func (r Rule) After() Rule {
+	if r.Count > 1 {
+		r.Count--
+	}
+	return r
+}
+
+func (r Rule) hasWeekday(wd time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d.Weekday == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// weekStart returns midnight of the Monday starting t's week
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -offset).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func (r Rule) nextWeekly(prev time.Time, interval int) (time.Time, bool) {
+	if len(r.ByDay) == 0 {
+		return prev.AddDate(0, 0, 7*interval), true
+	}
+	start := weekStart(prev)
+	for i := 1; i < maxSteps; i++ {
+		t := prev.AddDate(0, 0, i)
+		weeks := int(weekStart(t).Sub(start).Hours()+12) / (24 * 7)
+		if weeks%interval == 0 && r.hasWeekday(t.Weekday()) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r Rule) nextMonthly(prev time.Time, interval int) (time.Time, bool) {
+	y, m, _ := prev.Date()
+	hh, mm, ss := prev.Clock()
+	for i := 0; i < maxSteps; i += interval {
+		first := time.Date(y, m+time.Month(i), 1, hh, mm, ss, prev.Nanosecond(), prev.Location())
+		for _, day := range r.monthDays(prev, first) {
+			if day.After(prev) {
+				return day, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// monthDays returns the candidate occurrences in the month starting at
+// first, in ascending order
+func (r Rule) monthDays(prev, first time.Time) []time.Time {
+	daysIn := first.AddDate(0, 1, -1).Day()
+	var out []time.Time
+	if len(r.ByDay) == 0 {
+		// same day of month as prev; months without it are skipped
+		if prev.Day() <= daysIn {
+			out = append(out, first.AddDate(0, 0, prev.Day()-1))
+		}
+		return out
+	}
+	for d := 1; d <= daysIn; d++ {
+		t := first.AddDate(0, 0, d-1)
+		for _, bd := range r.ByDay {
+			if bd.Weekday != t.Weekday() {
+				continue
+			}
+			nth := (d-1)/7 + 1
+			nthLast := -((daysIn-d)/7 + 1)
+			if bd.N == 0 || bd.N == nth || bd.N == nthLast {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	return out
+}
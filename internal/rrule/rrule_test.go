@@ -0,0 +1,116 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_RoundTrip(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:freq=weekly;byday=mo,th;count=4", "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4"},
+		{"FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR;UNTIL=20270101T000000Z", "FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR;UNTIL=20270101T000000Z"},
+		{"FREQ=WEEKLY;INTERVAL=1;WKST=MO", "FREQ=WEEKLY"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"FREQ=YEARLY",
+		"INTERVAL=2",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=x",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=DAILY;COUNT=2;UNTIL=20270101",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) should fail", in)
+		}
+	}
+}
+
+func TestRule_Next(t *testing.T) {
+	// Monday 2026-01-05 09:30 UTC
+	mon := time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 9, 30, 0, 0, time.UTC) }
+
+	tests := []struct {
+		rule string
+		prev time.Time
+		want time.Time
+	}{
+		{"FREQ=DAILY", mon, day(2026, 1, 6)},
+		{"FREQ=DAILY;INTERVAL=3", mon, day(2026, 1, 8)},
+		{"FREQ=DAILY;BYDAY=MO,WE,FR", day(2026, 1, 9), day(2026, 1, 12)},
+		{"FREQ=WEEKLY", mon, day(2026, 1, 12)},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", mon, day(2026, 1, 8)},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", day(2026, 1, 8), day(2026, 1, 12)},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", day(2026, 1, 8), day(2026, 1, 19)},
+		{"FREQ=WEEKLY;BYDAY=SU", mon, day(2026, 1, 11)},
+		{"FREQ=MONTHLY", day(2026, 1, 15), day(2026, 2, 15)},
+		{"FREQ=MONTHLY", day(2026, 1, 31), day(2026, 3, 31)},
+		{"FREQ=MONTHLY;INTERVAL=3", day(2026, 1, 15), day(2026, 4, 15)},
+		{"FREQ=MONTHLY;BYDAY=1MO", mon, day(2026, 2, 2)},
+		{"FREQ=MONTHLY;BYDAY=-1FR", mon, day(2026, 1, 30)},
+		{"FREQ=MONTHLY;BYDAY=-1FR", day(2026, 1, 30), day(2026, 2, 27)},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.rule, err)
+		}
+		got, ok := r.Next(tt.prev)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s after %s = %s (%v), want %s", tt.rule, tt.prev.Format("Mon 2006-01-02"), got.Format("Mon 2006-01-02 15:04"), ok, tt.want.Format("Mon 2006-01-02 15:04"))
+		}
+	}
+}
+
+func TestRule_Next_Limits(t *testing.T) {
+	mon := time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+
+	r, _ := Parse("FREQ=DAILY;COUNT=2")
+	if _, ok := r.Next(mon); !ok {
+		t.Fatalf("expected a second occurrence")
+	}
+	if _, ok := r.After().Next(mon); ok {
+		t.Errorf("expected COUNT to be exhausted after the second occurrence")
+	}
+
+	r, _ = Parse("FREQ=WEEKLY;UNTIL=20260110")
+	if _, ok := r.Next(mon); ok {
+		t.Errorf("expected UNTIL to stop the series")
+	}
+	r, _ = Parse("FREQ=DAILY;UNTIL=20260106")
+	if _, ok := r.Next(mon); !ok {
+		t.Errorf("expected a date-only UNTIL to include the whole day")
+	}
+
+	// stepping a week at a time never leaves Monday
+	r, _ = Parse("FREQ=DAILY;INTERVAL=7;BYDAY=TU")
+	if next, ok := r.Next(mon); ok {
+		t.Errorf("expected no occurrence, got %s", next)
+	}
+	if r.Reachable(mon) || !r.Reachable(mon.AddDate(0, 0, 1)) {
+		t.Errorf("expected BYDAY=TU reachable from Tuesdays only")
+	}
+	for _, rule := range []string{"FREQ=DAILY;INTERVAL=3;BYDAY=TU", "FREQ=DAILY;BYDAY=TU"} {
+		if r, _ = Parse(rule); !r.Reachable(mon) {
+			t.Errorf("expected %s to reach every weekday", rule)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package todotxt reads and writes todos in the todo.txt format
+// (https://github.com/todotxt/todo.txt): one todo per line, "x " marking
+// completed todos, "(A)" to "(Z)" the priority, +project and @context tags
+// and key:value extensions such as due:2024-05-01.
+//
+// Priority 1 is (A), the most important, up to 26 for (Z). Tags starting
+// with @ are contexts, all others projects. A status other than the
+// default and completed is kept as status:<name>. Descriptions, subtasks
+// and recurrences have no todo.txt form and are left out.
+package todotxt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+const dateLayout = "2006-01-02"
+
+// Format renders t as one todo.txt line
+func Format(t model.Todo) string {
+	var parts []string
+	done := t.Status == model.Completed
+	if done {
+		parts = append(parts, "x")
+	} else if p := priority(t.Priority); p != "" {
+		parts = append(parts, "("+p+")")
+	}
+	if !t.CreatedAt.IsZero() {
+		parts = append(parts, t.CreatedAt.UTC().Format(dateLayout))
+	}
+	parts = append(parts, strings.Fields(t.Name)...)
+	for _, tag := range t.Tags {
+		tag = strings.Join(strings.Fields(tag), "_")
+		switch {
+		case tag == "" || tag == "@":
+		case strings.HasPrefix(tag, "@"):
+			parts = append(parts, tag)
+		default:
+			parts = append(parts, "+"+tag)
+		}
+	}
+	if !t.DueDate.IsZero() {
+		parts = append(parts, "due:"+t.DueDate.UTC().Format(dateLayout))
+	}
+	if t.Status != "" && t.Status != model.NotStarted && !done {
+		parts = append(parts, "status:"+string(t.Status))
+	}
+	// completed todos drop their priority, todo.txt clients keep it as pri:
+	if p := priority(t.Priority); p != "" && done {
+		parts = append(parts, "pri:"+p)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse reads one todo.txt line. The completion and creation dates are
+// skipped; they belong to the server.
+func Parse(line string) (model.Todo, error) {
+	var t model.Todo
+	words := strings.Fields(line)
+	if len(words) > 0 && words[0] == "x" {
+		t.Status = model.Completed
+		words = words[1:]
+		// completion date, followed by the creation date
+		if len(words) > 0 && isDate(words[0]) {
+			words = words[1:]
+		}
+	}
+	if len(words) > 0 && isPriority(words[0]) {
+		t.Priority = int(words[0][1]-'A') + 1
+		words = words[1:]
+	}
+	if len(words) > 0 && isDate(words[0]) {
+		words = words[1:]
+	}
+
+	var name []string
+	for _, w := range words {
+		key, value, _ := strings.Cut(w, ":")
+		switch {
+		case len(w) > 1 && w[0] == '+':
+			t.Tags = append(t.Tags, w[1:])
+		case len(w) > 1 && w[0] == '@':
+			t.Tags = append(t.Tags, w)
+		case key == "due" && value != "":
+			d, err := time.Parse(dateLayout, value)
+			if err != nil {
+				return t, fmt.Errorf("invalid due date %q", value)
+			}
+			t.DueDate = d
+		case key == "pri" && isPriority("("+value+")"):
+			t.Priority = int(value[0]-'A') + 1
+		case key == "status" && value != "" && t.Status == "":
+			t.Status = model.Status(value)
+		default:
+			name = append(name, w)
+		}
+	}
+	t.Name = strings.Join(name, " ")
+	return t, nil
+}
+
+// priority is the letter of a priority, empty for none
+func priority(p int) string {
+	if p <= 0 {
+		return ""
+	}
+	if p > 26 {
+		p = 26
+	}
+	return string(rune('A' + p - 1))
+}
+
+// isPriority reports whether w is a priority such as (A)
+func isPriority(w string) bool {
+	return len(w) == 3 && w[0] == '(' && w[1] >= 'A' && w[1] <= 'Z' && w[2] == ')'
+}
+
+func isDate(w string) bool {
+	_, err := time.Parse(dateLayout, w)
+	return err == nil
+}
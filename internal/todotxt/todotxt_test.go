@@ -0,0 +1,85 @@
+package todotxt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+func TestFormat(t *testing.T) {
+	created := time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)
+	due := time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC)
+	tests := []struct {
+		todo model.Todo
+		want string
+	}{
+		{model.Todo{Name: "call mom"}, "call mom"},
+		{
+			model.Todo{Name: "ship  release", Priority: 1, Tags: []string{"launch", "@office"}, DueDate: due, CreatedAt: created, Status: model.NotStarted},
+			"(A) 2024-04-01 ship release +launch @office due:2024-05-01",
+		},
+		{
+			model.Todo{Name: "review PR", Priority: 2, Status: model.Completed, Tags: []string{"team work"}},
+			"x review PR +team_work pri:B",
+		},
+		{model.Todo{Name: "draft", Status: model.InProgress, Priority: 40}, "(Z) draft status:in_progress"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.todo); got != tt.want {
+			t.Errorf("Format(%+v) = %q, want %q", tt.todo, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	due := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		line string
+		want model.Todo
+	}{
+		{"call mom", model.Todo{Name: "call mom"}},
+		{
+			"(A) 2024-04-01 ship release +launch @office due:2024-05-01",
+			model.Todo{Name: "ship release", Priority: 1, Tags: []string{"launch", "@office"}, DueDate: due},
+		},
+		{
+			"x 2024-05-02 2024-04-01 review PR +team pri:B",
+			model.Todo{Name: "review PR", Status: model.Completed, Priority: 2, Tags: []string{"team"}},
+		},
+		{"draft status:in_progress see http://example.com", model.Todo{Name: "draft see http://example.com", Status: model.InProgress}},
+		{"(a) lower-case is not a priority", model.Todo{Name: "(a) lower-case is not a priority"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.line)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+
+	if _, err := Parse("pay rent due:tomorrow"); err == nil {
+		t.Error("expected an invalid due date to fail")
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	in := model.Todo{
+		Name:     "plan offsite",
+		Priority: 3,
+		Tags:     []string{"events", "@home"},
+		DueDate:  time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC),
+		Status:   model.InProgress,
+	}
+	got, err := Parse(Format(in))
+	if err != nil {
+		t.Fatalf("Parse(Format()) failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("round trip = %+v, want %+v", got, in)
+	}
+}
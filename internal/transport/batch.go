@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// batchResult is the outcome of one operation of POST /todos/batch. Status
+// is the status the operation would have answered on its own, or 424 when
+// it was not applied because another operation failed.
+type batchResult struct {
+	Op     api.BatchKind `json:"op"`
+	ID     int64         `json:"id,omitempty"`
+	Status int           `json:"status"`
+	Todo   *model.Todo   `json:"todo,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// batchResponse is the body of POST /todos/batch
+type batchResponse struct {
+	Error   string        `json:"error,omitempty"`
+	Results []batchResult `json:"results"`
+}
+
+// runBatch executes ops and returns the response status and body. A failed
+// batch answers with the status of its first failing operation. The changes
+// of a successful batch go to hub as one message.
+func runBatch(ctx context.Context, svc *api.Service, hub *Hub, ops []api.BatchOp) (int, interface{}) {
+	res, err := svc.Batch(ctx, ops)
+	if err != nil && !errors.Is(err, api.ErrBatchFailed) {
+		return errorStatus(err), map[string]string{"error": err.Error()}
+	}
+
+	body := batchResponse{Results: make([]batchResult, len(res.Results))}
+	status := http.StatusOK
+	for i, r := range res.Results {
+		out := batchResult{Op: r.Op, ID: r.ID, Todo: r.Todo}
+		switch {
+		case r.Err != nil:
+			out.Status, out.Error = errorStatus(r.Err), r.Err.Error()
+			if status == http.StatusOK {
+				status = out.Status
+			}
+		case err != nil:
+			out.Status = http.StatusFailedDependency
+		case r.Op == api.BatchCreate:
+			out.Status = http.StatusCreated
+		case r.Op == api.BatchDelete:
+			out.Status = http.StatusNoContent
+		default:
+			out.Status = http.StatusOK
+		}
+		body.Results[i] = out
+	}
+	if err != nil {
+		body.Error = err.Error()
+		return status, body
+	}
+	if hub != nil {
+		hub.BroadcastBatch(res.Changes)
+	}
+	return status, body
+}
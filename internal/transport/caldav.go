@@ -0,0 +1,572 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/ical"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// CalDAV paths: the root doubles as principal and calendar home, holding
+// the one calendar collection of todos
+const (
+	calDAVRoot       = "/caldav/"
+	calDAVCollection = calDAVRoot + "todos/"
+)
+
+// XML namespaces of WebDAV, CalDAV and the CalendarServer extensions
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// calDAVMethods are the methods the CalDAV handler serves
+var calDAVMethods = []string{http.MethodOptions, "PROPFIND", "REPORT", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete}
+
+// CalDAV serves the todos as a minimal CalDAV calendar of VTODO resources
+// below /caldav/ (RFC 4791): PROPFIND for discovery and listing, the
+// calendar-query and calendar-multiget REPORTs, and GET, PUT and DELETE on
+// single resources with the todo version as ETag. Changes are broadcast to
+// the hub like those made through the REST routes.
+//
+// A todo a client creates keeps the resource name and UID it was put with,
+// stored with the todo as CalDAVName and UID; other todos are served as
+// <id>.ics with the UID todo-<id>.
+type CalDAV struct {
+	svc *api.Service
+	hub *Hub
+}
+
+// NewCalDAV returns the CalDAV handler for svc. hub may be nil.
+func NewCalDAV(svc *api.Service, hub *Hub) *CalDAV {
+	return &CalDAV{svc: svc, hub: hub}
+}
+
+func (d *CalDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	svc := d.svc
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		svc = svc.As(callerOf(r, w.Header()))
+	}
+
+	path := r.URL.Path
+	if path+"/" == calDAVRoot || path+"/" == calDAVCollection {
+		path += "/"
+	}
+	switch {
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(calDAVMethods, ", "))
+		w.WriteHeader(http.StatusOK)
+	case path == calDAVRoot && r.Method == "PROPFIND":
+		d.propfindRoot(w, r)
+	case path == calDAVCollection && r.Method == "PROPFIND":
+		d.propfindCollection(w, r)
+	case path == calDAVCollection && r.Method == "REPORT":
+		d.report(w, r)
+	case strings.HasPrefix(path, calDAVCollection) && strings.HasSuffix(path, ".ics") && !strings.Contains(path[len(calDAVCollection):], "/"):
+		d.serveResource(w, r, svc, path[len(calDAVCollection):])
+	case path == calDAVRoot || path == calDAVCollection:
+		w.Header().Set("Allow", strings.Join(calDAVMethods[:3], ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *CalDAV) serveResource(w http.ResponseWriter, r *http.Request, svc *api.Service, name string) {
+	ctx := r.Context()
+	switch r.Method {
+	case "PROPFIND":
+		t, err := d.lookup(ctx, name)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		props, err := readPropfind(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := d.todoResponse(t, props)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeMultistatus(w, []davResponse{resp})
+	case http.MethodGet, http.MethodHead:
+		t, err := d.lookup(ctx, name)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		var buf bytes.Buffer
+		if err := ical.Encode(&buf, []model.Todo{*t}, ical.VTodo); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("ETag", etag(t.Version))
+		if r.Method == http.MethodGet {
+			w.Write(buf.Bytes())
+		}
+	case http.MethodPut:
+		d.put(w, r, svc, name)
+	case http.MethodDelete:
+		d.delete(w, r, svc, name)
+	default:
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// put creates or replaces the todo of a resource from the single VTODO of
+// the request body
+func (d *CalDAV) put(w http.ResponseWriter, r *http.Request, svc *api.Service, name string) {
+	ctx := r.Context()
+	items, err := ical.Decode(io.LimitReader(r.Body, maxImportBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) != 1 || items[0].Component != ical.VTodo {
+		http.Error(w, "a resource holds exactly one VTODO", http.StatusForbidden)
+		return
+	}
+	t := items[0].Todo
+
+	cur, err := d.lookup(ctx, name)
+	if err != nil && !errors.Is(err, cache.ErrNotFound) {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	version, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (cur == nil && r.Header.Get("If-Match") != "") || (cur != nil && r.Header.Get("If-None-Match") == "*") {
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	if cur == nil {
+		// <id>.ics names the todo with that id, even one not created yet
+		if _, ok := serverName(name); ok {
+			http.Error(w, "resource names of the form <id>.ics are reserved for the server", http.StatusConflict)
+			return
+		}
+		// a UID of the form todo-<id> would name another todo; the new one
+		// gets its own
+		uid := items[0].UID
+		if _, ours := ical.ParseUID(uid); uid != "" && !ours {
+			_, err := d.find(ctx, func(o *model.Todo) bool { return o.UID == uid })
+			if err == nil {
+				http.Error(w, "a todo with UID "+uid+" already exists", http.StatusConflict)
+				return
+			}
+			if !errors.Is(err, cache.ErrNotFound) {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			t.UID = uid
+		}
+		t.CalDAVName = name
+		if _, err := svc.Create(ctx, &t); err != nil {
+			writeError(w, err, updateStatus(err))
+			return
+		}
+		if d.hub != nil {
+			d.hub.BroadcastCreate(&t)
+		}
+		w.Header().Set("ETag", etag(t.Version))
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	t.ID, t.Version = cur.ID, version
+	// clients that do not know about subtasks leave RELATED-TO out
+	if t.ParentID == 0 {
+		t.ParentID = cur.ParentID
+	}
+	if err := svc.Update(ctx, &t); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+	updated, err := svc.Get(ctx, t.ID)
+	if err != nil {
+		updated = &t
+	}
+	if d.hub != nil {
+		d.hub.BroadcastUpdate(updated)
+	}
+	w.Header().Set("ETag", etag(updated.Version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *CalDAV) delete(w http.ResponseWriter, r *http.Request, svc *api.Service, name string) {
+	ctx := r.Context()
+	t, err := d.lookup(ctx, name)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	version, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if version != 0 && version != t.Version {
+		http.Error(w, cache.ErrConflict.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if err := svc.Delete(ctx, t.ID); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if d.hub != nil {
+		d.hub.BroadcastDelete(t.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookup returns the todo of a resource name: the todo <id>.ics names,
+// unless it was created under another name, or else the todo created under
+// name
+func (d *CalDAV) lookup(ctx context.Context, name string) (*model.Todo, error) {
+	if id, ok := serverName(name); ok {
+		t, err := d.svc.Get(ctx, id)
+		if err == nil && (t.CalDAVName == "" || t.CalDAVName == name) {
+			return t, nil
+		}
+		if err != nil && !errors.Is(err, cache.ErrNotFound) {
+			return nil, err
+		}
+	}
+	return d.find(ctx, func(t *model.Todo) bool { return t.CalDAVName == name })
+}
+
+// serverName reports whether name is of the form <id>.ics the server gives
+// todos, and the id it names.
+func serverName(name string) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimSuffix(name, ".ics"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+// find returns the first live todo fn accepts. Client-chosen names and UIDs
+// are not indexed; the collection is listed whole like for PROPFIND.
+func (d *CalDAV) find(ctx context.Context, fn func(*model.Todo) bool) (*model.Todo, error) {
+	todos, err := d.svc.List(ctx, cache.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range todos {
+		if fn(&todos[i]) {
+			return &todos[i], nil
+		}
+	}
+	return nil, cache.ErrNotFound
+}
+
+// href is the URL of the resource of t
+func href(t *model.Todo) string {
+	if t.CalDAVName != "" {
+		return calDAVCollection + t.CalDAVName
+	}
+	return calDAVCollection + strconv.FormatInt(t.ID, 10) + ".ics"
+}
+
+func (d *CalDAV) propfindRoot(w http.ResponseWriter, r *http.Request) {
+	props, err := readPropfind(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	home := davHref(calDAVRoot)
+	responses := []davResponse{newDAVResponse(calDAVRoot, props, map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                 "<d:collection/>",
+		{Space: nsDAV, Local: "displayname"}:                  "Todo",
+		{Space: nsDAV, Local: "current-user-principal"}:       home,
+		{Space: nsDAV, Local: "principal-URL"}:                home,
+		{Space: nsCalDAV, Local: "calendar-home-set"}:         home,
+		{Space: nsCalDAV, Local: "calendar-user-address-set"}: "",
+	})}
+	if r.Header.Get("Depth") != "0" {
+		todos, err := d.svc.List(r.Context(), cache.ListOptions{})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		responses = append(responses, d.collectionResponse(todos, props))
+	}
+	writeMultistatus(w, responses)
+}
+
+func (d *CalDAV) propfindCollection(w http.ResponseWriter, r *http.Request) {
+	props, err := readPropfind(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	todos, err := d.svc.List(r.Context(), cache.ListOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	responses := []davResponse{d.collectionResponse(todos, props)}
+	if r.Header.Get("Depth") != "0" {
+		for i := range todos {
+			resp, err := d.todoResponse(&todos[i], props)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			responses = append(responses, resp)
+		}
+	}
+	writeMultistatus(w, responses)
+}
+
+// report answers calendar-query with every todo and calendar-multiget with
+// the todos it names. Query filters are not evaluated: the collection only
+// holds VTODOs and clients filter again anyway.
+func (d *CalDAV) report(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		XMLName xml.Name
+		Prop    davPropNames `xml:"DAV: prop"`
+		Hrefs   []string     `xml:"DAV: href"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, maxImportBytes)).Decode(&req); err != nil {
+		http.Error(w, "invalid report: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var todos []model.Todo
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		var err error
+		if todos, err = d.svc.List(ctx, cache.ListOptions{}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		var responses []davResponse
+		for _, href := range req.Hrefs {
+			name, ok := strings.CutPrefix(strings.TrimSpace(href), calDAVCollection)
+			t, err := d.lookup(ctx, name)
+			if !ok || err != nil {
+				responses = append(responses, davResponse{Href: href, Status: "HTTP/1.1 404 Not Found"})
+				continue
+			}
+			resp, err := d.todoResponse(t, req.Prop)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			responses = append(responses, resp)
+		}
+		writeMultistatus(w, responses)
+		return
+	default:
+		http.Error(w, "unsupported report "+req.XMLName.Local, http.StatusForbidden)
+		return
+	}
+	responses := make([]davResponse, len(todos))
+	for i := range todos {
+		var err error
+		if responses[i], err = d.todoResponse(&todos[i], req.Prop); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeMultistatus(w, responses)
+}
+
+// collectionResponse describes the calendar collection holding todos. Its
+// getctag changes whenever a todo does.
+func (d *CalDAV) collectionResponse(todos []model.Todo, props davPropNames) davResponse {
+	h := fnv.New64a()
+	for _, t := range todos {
+		fmt.Fprintf(h, "%d:%d;", t.ID, t.Version)
+	}
+	return newDAVResponse(calDAVCollection, props, map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                        "<d:collection/><c:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:                         "Todos",
+		{Space: nsDAV, Local: "current-user-principal"}:              davHref(calDAVRoot),
+		{Space: nsDAV, Local: "current-user-privilege-set"}:          "<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege><d:privilege><d:write-content/></d:privilege><d:privilege><d:bind/></d:privilege><d:privilege><d:unbind/></d:privilege>",
+		{Space: nsDAV, Local: "supported-report-set"}:                "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report><d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>",
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<c:comp name="VTODO"/>`,
+		{Space: nsCS, Local: "getctag"}:                              strconv.FormatUint(h.Sum64(), 16),
+	})
+}
+
+// todoResponse describes the resource of t. calendar-data is only sent
+// when asked for.
+func (d *CalDAV) todoResponse(t *model.Todo, props davPropNames) (davResponse, error) {
+	var data bytes.Buffer
+	if err := ical.Encode(&data, []model.Todo{*t}, ical.VTodo); err != nil {
+		return davResponse{}, err
+	}
+	values := map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:     "",
+		{Space: nsDAV, Local: "getetag"}:          xmlEscape(etag(t.Version)),
+		{Space: nsDAV, Local: "getcontenttype"}:   "text/calendar; charset=utf-8; component=VTODO",
+		{Space: nsDAV, Local: "getlastmodified"}:  t.UpdatedAt.UTC().Format(http.TimeFormat),
+		{Space: nsCalDAV, Local: "calendar-data"}: xmlEscape(data.String()),
+	}
+	if props.all {
+		delete(values, xml.Name{Space: nsCalDAV, Local: "calendar-data"})
+	}
+	return newDAVResponse(href(t), props, values), nil
+}
+
+// davPropNames are the properties a PROPFIND or REPORT asks for; all for
+// allprop and an empty request
+type davPropNames struct {
+	all   bool
+	names []xml.Name
+}
+
+func (p *davPropNames) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			p.names = append(p.names, tok.Name)
+			if err := dec.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// readPropfind reads the properties a PROPFIND body asks for
+func readPropfind(body io.Reader) (davPropNames, error) {
+	var req struct {
+		AllProp *struct{}    `xml:"DAV: allprop"`
+		Prop    davPropNames `xml:"DAV: prop"`
+	}
+	err := xml.NewDecoder(io.LimitReader(body, maxImportBytes)).Decode(&req)
+	if err == io.EOF || (err == nil && (req.AllProp != nil || len(req.Prop.names) == 0)) {
+		return davPropNames{all: true}, nil
+	}
+	if err != nil {
+		return davPropNames{}, fmt.Errorf("invalid propfind: %v", err)
+	}
+	return req.Prop, nil
+}
+
+// davResponse is one response of a multistatus: the requested properties
+// found, as inner XML, and those that are not
+type davResponse struct {
+	Href     string
+	Status   string // set instead of properties for missing resources
+	Found    []davProp
+	NotFound []xml.Name
+}
+
+type davProp struct {
+	Name  xml.Name
+	Value string
+}
+
+// newDAVResponse picks the requested properties from values
+func newDAVResponse(href string, props davPropNames, values map[xml.Name]string) davResponse {
+	resp := davResponse{Href: href}
+	names := props.names
+	if props.all {
+		names = nil
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return names[i].Local < names[j].Local })
+	}
+	for _, name := range names {
+		if v, ok := values[name]; ok {
+			resp.Found = append(resp.Found, davProp{name, v})
+		} else {
+			resp.NotFound = append(resp.NotFound, name)
+		}
+	}
+	return resp
+}
+
+// writeMultistatus writes a 207 Multi-Status response
+func writeMultistatus(w http.ResponseWriter, responses []davResponse) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<d:multistatus xmlns:d=%q xmlns:c=%q xmlns:cs=%q>`, nsDAV, nsCalDAV, nsCS)
+	for _, r := range responses {
+		b.WriteString("<d:response><d:href>" + xmlEscape(r.Href) + "</d:href>")
+		if r.Status != "" {
+			b.WriteString("<d:status>" + r.Status + "</d:status>")
+		}
+		if len(r.Found) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, p := range r.Found {
+				tag := davTag(p.Name)
+				b.WriteString("<" + tag + ">" + p.Value + "</" + tag + ">")
+			}
+			b.WriteString("</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+		}
+		if len(r.NotFound) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range r.NotFound {
+				b.WriteString(davEmptyTag(name))
+			}
+			b.WriteString("</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+// davTag is the prefixed tag of a property we serve
+func davTag(name xml.Name) string {
+	switch name.Space {
+	case nsCalDAV:
+		return "c:" + name.Local
+	case nsCS:
+		return "cs:" + name.Local
+	}
+	return "d:" + name.Local
+}
+
+// davEmptyTag is an empty element for any property, declaring namespaces
+// we have no prefix for
+func davEmptyTag(name xml.Name) string {
+	switch name.Space {
+	case nsDAV, nsCalDAV, nsCS:
+		return "<" + davTag(name) + "/>"
+	}
+	return fmt.Sprintf(`<x:%s xmlns:x=%q/>`, name.Local, xmlEscape(name.Space))
+}
+
+func davHref(href string) string { return "<d:href>" + xmlEscape(href) + "</d:href>" }
+
+// xmlEscape escapes s for XML text and attribute values
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,221 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/dao/eventlog"
+	"github.com/conbanwa/todo/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const calDAVTodo = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:4f1c@phone\r\nSUMMARY:Buy milk\r\nDUE:20240501T090000Z\r\nPRIORITY:2\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAV(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	svc := api.NewService(cache.NewInMemoryStore())
+	svc.Create(ctx, &model.Todo{Name: "Pay rent", Tags: []string{"home"}})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutesWithHub(r, svc, hub)
+	r.GET("/ws", func(c *gin.Context) { HandleWebSocket(c, hub) })
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+"/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer ws.Close()
+	time.Sleep(50 * time.Millisecond)
+	nextMessage := func() WSMessage {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var msg WSMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read WebSocket message: %v", err)
+		}
+		return msg
+	}
+
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodOptions, "/caldav/todos/", ""); !strings.Contains(w.Header().Get("DAV"), "calendar-access") {
+		t.Errorf("expected calendar-access in DAV, got %q", w.Header().Get("DAV"))
+	}
+	if w := do("PROPFIND", "/.well-known/caldav", ""); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/caldav/" {
+		t.Errorf("expected a redirect to /caldav/, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// discovery: the home set points at the root, which lists the calendar
+	w := do("PROPFIND", "/caldav/", `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-home-set/><d:resourcetype/><x:color xmlns:x="http://apple.com/ns/ical/"/></d:prop></d:propfind>`, "Depth", "1")
+	body := w.Body.String()
+	if w.Code != http.StatusMultiStatus || !strings.Contains(body, "<c:calendar-home-set><d:href>/caldav/</d:href></c:calendar-home-set>") ||
+		!strings.Contains(body, "<d:href>/caldav/todos/</d:href>") || !strings.Contains(body, "<d:collection/><c:calendar/>") ||
+		!strings.Contains(body, `<x:color xmlns:x="http://apple.com/ns/ical/"/></d:prop><d:status>HTTP/1.1 404 Not Found`) {
+		t.Errorf("unexpected root PROPFIND %d\n%s", w.Code, body)
+	}
+
+	propfind := func() string {
+		w := do("PROPFIND", "/caldav/todos/", `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/"><d:prop><d:getetag/><cs:getctag/></d:prop></d:propfind>`, "Depth", "1")
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("expected 207, got %d", w.Code)
+		}
+		return w.Body.String()
+	}
+	body = propfind()
+	if !strings.Contains(body, "<d:href>/caldav/todos/1.ics</d:href><d:propstat><d:prop><d:getetag>&#34;1&#34;</d:getetag>") {
+		t.Errorf("expected the todo listed with its ETag, got\n%s", body)
+	}
+	ctag := body[strings.Index(body, "<cs:getctag>"):strings.Index(body, "</cs:getctag>")]
+
+	// a client creates a todo under a name of its own
+	if w = do(http.MethodPut, "/caldav/todos/4f1c.ics", calDAVTodo, "If-None-Match", "*"); w.Code != http.StatusCreated || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected 201 with an ETag, got %d %s", w.Code, w.Body.String())
+	}
+	if msg := nextMessage(); msg.Type != "create" || msg.Payload.Name != "Buy milk" {
+		t.Errorf("expected the create broadcast, got %+v", msg)
+	}
+	w = do(http.MethodGet, "/caldav/todos/4f1c.ics", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SUMMARY:Buy milk\r\n") || !strings.Contains(w.Body.String(), "PRIORITY:2\r\n") {
+		t.Errorf("unexpected GET %d\n%s", w.Code, w.Body.String())
+	}
+	if body = propfind(); !strings.Contains(body, "<d:href>/caldav/todos/4f1c.ics</d:href>") || strings.Contains(body, ctag+"<") {
+		t.Errorf("expected the new resource listed and the ctag changed, got\n%s", body)
+	}
+
+	// calendar-multiget returns the calendar data of the named resources
+	w = do("REPORT", "/caldav/todos/", `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/><c:calendar-data/></d:prop><d:href>/caldav/todos/4f1c.ics</d:href><d:href>/caldav/todos/99.ics</d:href></c:calendar-multiget>`)
+	body = w.Body.String()
+	if w.Code != http.StatusMultiStatus || !strings.Contains(body, "SUMMARY:Buy milk") || !strings.Contains(body, "<d:href>/caldav/todos/99.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status>") {
+		t.Errorf("unexpected multiget %d\n%s", w.Code, body)
+	}
+	w = do("REPORT", "/caldav/todos/", `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/></d:prop><c:filter><c:comp-filter name="VCALENDAR"/></c:filter></c:calendar-query>`)
+	if strings.Count(w.Body.String(), "<d:response>") != 2 {
+		t.Errorf("expected both todos from calendar-query, got\n%s", w.Body.String())
+	}
+
+	// completing it with a stale ETag fails, with the current one succeeds
+	done := strings.Replace(calDAVTodo, "PRIORITY:2", "STATUS:COMPLETED", 1)
+	if w = do(http.MethodPut, "/caldav/todos/4f1c.ics", done, "If-Match", `"7"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for a stale ETag, got %d", w.Code)
+	}
+	if w = do(http.MethodPut, "/caldav/todos/4f1c.ics", done, "If-Match", `"1"`); w.Code != http.StatusNoContent || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 204 with the new ETag, got %d %s", w.Code, w.Body.String())
+	}
+	if msg := nextMessage(); msg.Type != "update" || msg.Payload.Status != model.Completed {
+		t.Errorf("expected the update broadcast, got %+v", msg)
+	}
+	if w = do(http.MethodPut, "/caldav/todos/1.ics", strings.Replace(calDAVTodo, "VTODO", "VEVENT", 2)); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an event, got %d", w.Code)
+	}
+
+	if w = do(http.MethodDelete, "/caldav/todos/4f1c.ics", "", "If-Match", `"1"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for a stale ETag, got %d", w.Code)
+	}
+	if w = do(http.MethodDelete, "/caldav/todos/4f1c.ics", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d %s", w.Code, w.Body.String())
+	}
+	if msg := nextMessage(); msg.Type != "delete" || msg.Payload.ID != 2 {
+		t.Errorf("expected the delete broadcast, got %+v", msg)
+	}
+	if w = do(http.MethodGet, "/caldav/todos/4f1c.ics", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after the delete, got %d", w.Code)
+	}
+}
+
+func TestCalDAV_KeepsClientNameAndUID(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	open := func() (*eventlog.EventStore, *CalDAV) {
+		store, err := eventlog.NewEventStore(dir)
+		if err != nil {
+			t.Fatalf("open store: %v", err)
+		}
+		return store, NewCalDAV(api.NewService(store), nil)
+	}
+	do := func(d *CalDAV, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	store, d := open()
+	api.NewService(store).Create(ctx, &model.Todo{Name: "Pay rent"})
+	if w := do(d, http.MethodPut, "/caldav/todos/4f1c.ics", calDAVTodo); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	// the UID belongs to one resource only
+	if w := do(d, http.MethodPut, "/caldav/todos/other.ics", calDAVTodo); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a UID in use, got %d", w.Code)
+	}
+	store.Close()
+
+	// after a restart the resource is still found under its name and UID
+	store, d = open()
+	defer store.Close()
+	w := do(d, http.MethodGet, "/caldav/todos/4f1c.ics", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "\r\nUID:4f1c@phone\r\n") {
+		t.Fatalf("expected the client's UID after a restart, got %d\n%s", w.Code, w.Body.String())
+	}
+	if w := do(d, http.MethodGet, "/caldav/todos/2.ics", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the todo only under its own name, got %d", w.Code)
+	}
+	w = do(d, "PROPFIND", "/caldav/todos/", "")
+	if body := w.Body.String(); !strings.Contains(body, "<d:href>/caldav/todos/4f1c.ics</d:href>") || !strings.Contains(body, "<d:href>/caldav/todos/1.ics</d:href>") {
+		t.Errorf("expected both resources under their names, got\n%s", body)
+	}
+
+	// a replacement keeps them too
+	done := strings.Replace(calDAVTodo, "PRIORITY:2", "STATUS:COMPLETED", 1)
+	if w := do(d, http.MethodPut, "/caldav/todos/4f1c.ics", done); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d %s", w.Code, w.Body.String())
+	}
+	if got, _ := store.Get(ctx, 2); got.UID != "4f1c@phone" || got.CalDAVName != "4f1c.ics" || got.Status != model.Completed {
+		t.Errorf("unexpected todo after the update %+v", got)
+	}
+	if w := do(d, http.MethodDelete, "/caldav/todos/4f1c.ics", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+}
+
+// TestCalDAV_ReservesServerNames tests that a client cannot create a resource
+// under the name of a todo the server has yet to create.
+func TestCalDAV_ReservesServerNames(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewInMemoryStore()
+	svc := api.NewService(store)
+	d := NewCalDAV(svc, nil)
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/caldav/todos/1.ics", strings.NewReader(calDAVTodo)))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a name of the form <id>.ics, got %d", w.Code)
+	}
+
+	// todo 1 made over REST is the only resource named 1.ics
+	svc.Create(ctx, &model.Todo{Name: "Pay rent"})
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("PROPFIND", "/caldav/todos/", nil))
+	if n := strings.Count(w.Body.String(), "<d:href>/caldav/todos/1.ics</d:href>"); n != 1 {
+		t.Errorf("expected one resource named 1.ics, got %d\n%s", n, w.Body.String())
+	}
+}
@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+)
+
+// Headers identifying who makes a request. X-Request-ID is generated when
+// the client sends none and is always echoed in the response.
+const (
+	actorHeader     = "X-Actor"
+	requestIDHeader = "X-Request-ID"
+)
+
+// callerOf returns the audit identity of r and sets the X-Request-ID
+// response header on h
+func callerOf(r *http.Request, h http.Header) api.Caller {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		id = newRequestID()
+	}
+	h.Set(requestIDHeader, id)
+	return api.Caller{Actor: r.Header.Get(actorHeader), RequestID: id}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+)
+
+// errorStatus maps service and store errors to HTTP status codes
+func errorStatus(err error) int {
+	var invalid api.ErrInvalid
+	var transition *api.TransitionError
+	switch {
+	case errors.As(err, &transition):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &invalid), errors.Is(err, cache.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, cache.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cache.ErrConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, api.ErrHasChildren), errors.Is(err, api.ErrBlocked):
+		return http.StatusConflict
+	case errors.Is(err, errUnsupportedPatch):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// updateStatus maps errors from PUT and POST. Unknown ids have always
+// answered 400 there, so only version conflicts, blocked completions,
+// workflow violations and timeouts are singled out.
+func updateStatus(err error) int {
+	var transition *api.TransitionError
+	switch {
+	case errors.As(err, &transition):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, cache.ErrConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, api.ErrBlocked):
+		return http.StatusConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadRequest
+}
+
+// errorBody is the JSON error response for err. Workflow violations carry
+// the rejected transition and the allowed targets so clients can recover.
+func errorBody(err error) map[string]interface{} {
+	body := map[string]interface{}{"error": err.Error()}
+	var transition *api.TransitionError
+	if errors.As(err, &transition) {
+		body["code"] = "invalid_transition"
+		if transition.From != "" {
+			body["from"] = transition.From
+		}
+		body["to"] = transition.To
+		body["allowed"] = transition.Allowed
+	}
+	return body
+}
+
+// writeError is http.Error for the plain Handler, except that workflow
+// violations get the structured JSON body of errorBody
+func writeError(w http.ResponseWriter, err error, status int) {
+	var transition *api.TransitionError
+	if !errors.As(err, &transition) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody(err))
+}
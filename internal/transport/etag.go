@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+)
+
+// etag formats a todo version as a strong entity tag
+func etag(version int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch extracts the expected version from an If-Match header. An
+// empty header or "*" yields 0, which the stores treat as unconditional.
+func parseIfMatch(h string) (int64, error) {
+	h = strings.TrimSpace(h)
+	if h == "" || h == "*" {
+		return 0, nil
+	}
+	h = strings.TrimPrefix(h, "W/")
+	v, err := strconv.ParseInt(strings.Trim(h, `"`), 10, 64)
+	if err != nil || v <= 0 {
+		return 0, api.ErrInvalid("invalid If-Match header")
+	}
+	return v, nil
+}
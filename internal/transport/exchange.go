@@ -0,0 +1,335 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/ical"
+	"github.com/conbanwa/todo/internal/model"
+	"github.com/conbanwa/todo/internal/todotxt"
+)
+
+// maxImportBytes caps the body of POST /todos/import
+const maxImportBytes = 10 << 20
+
+// exportFormats are the formats of GET /todos/export and POST /todos/import
+var exportFormats = map[string]struct{ contentType, filename string }{
+	"json":    {"application/json", "todos.json"},
+	"csv":     {"text/csv; charset=utf-8", "todos.csv"},
+	"todotxt": {"text/plain; charset=utf-8", "todo.txt"},
+	"ics":     {"text/calendar; charset=utf-8", "todos.ics"},
+}
+
+// csvColumns are the columns of a CSV export. Imports find the columns by
+// their header and read name, description, status, priority, tags, due_date
+// and recurrence; tags are separated by semicolons.
+var csvColumns = []string{"id", "name", "description", "status", "priority", "tags", "due_date", "parent_id", "progress", "recurrence", "created_at", "updated_at"}
+
+// exportTodos lists the todos selected by the GET /todos parameters of r
+// and encodes them in format. Calendars hold VTODO components unless the
+// component parameter asks for VEVENT.
+func exportTodos(ctx context.Context, svc *api.Service, r *http.Request, format string) ([]byte, error) {
+	if _, ok := exportFormats[format]; !ok {
+		return nil, api.ErrInvalid(fmt.Sprintf("unknown format %q, use json, csv, todotxt or ics", format))
+	}
+	q := r.URL.Query()
+	component := ical.VTodo
+	switch strings.ToUpper(q.Get("component")) {
+	case "", string(ical.VTodo):
+	case string(ical.VEvent):
+		component = ical.VEvent
+	default:
+		return nil, api.ErrInvalid(fmt.Sprintf("unknown component %q, use vtodo or vevent", q.Get("component")))
+	}
+	opts, err := parseListOptions(q)
+	if err != nil {
+		return nil, api.ErrInvalid(err.Error())
+	}
+	todos, err := svc.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := encodeTodos(&buf, format, todos, component); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exportFormat is the format parameter of GET /todos/export, json by
+// default
+func exportFormat(r *http.Request) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+	return "json"
+}
+
+// setExportHeaders makes the response of GET /todos/export a download
+func setExportHeaders(h http.Header, format string) {
+	f := exportFormats[format]
+	h.Set("Content-Type", f.contentType)
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.filename))
+}
+
+// encodeTodos writes todos to w in format, as c components for ics
+func encodeTodos(w io.Writer, format string, todos []model.Todo, c ical.Component) error {
+	switch format {
+	case "ics":
+		return ical.Encode(w, todos, c)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(csvColumns)
+		for _, t := range todos {
+			cw.Write([]string{
+				strconv.FormatInt(t.ID, 10),
+				t.Name,
+				t.Description,
+				string(t.Status),
+				strconv.Itoa(t.Priority),
+				strings.Join(t.Tags, ";"),
+				csvTime(t.DueDate),
+				strconv.FormatInt(t.ParentID, 10),
+				strconv.Itoa(t.Progress),
+				t.Recurrence,
+				csvTime(t.CreatedAt),
+				csvTime(t.UpdatedAt),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "todotxt":
+		for _, t := range todos {
+			if _, err := fmt.Fprintln(w, todotxt.Format(t)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if todos == nil {
+		todos = []model.Todo{}
+	}
+	return json.NewEncoder(w).Encode(todos)
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// importResponse is the body of POST /todos/import
+type importResponse struct {
+	Error string `json:"error,omitempty"`
+	*api.ImportReport
+}
+
+// runImport imports the todos of a POST /todos/import request and returns
+// the response status and body. The todos of a successful import go to hub
+// as one batch message.
+func runImport(ctx context.Context, svc *api.Service, hub *Hub, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			return http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid dry_run %q", v)}
+		}
+	}
+	todos, err := readImport(w, r)
+	if err != nil {
+		return errorStatus(err), map[string]string{"error": err.Error()}
+	}
+	rep, err := svc.Import(ctx, todos, dryRun)
+	if errors.Is(err, api.ErrImportInvalid) {
+		return http.StatusUnprocessableEntity, importResponse{Error: err.Error(), ImportReport: rep}
+	}
+	if err != nil {
+		return errorStatus(err), map[string]string{"error": err.Error()}
+	}
+	if hub != nil && len(rep.Changes) > 0 {
+		hub.BroadcastBatch(rep.Changes)
+	}
+	return http.StatusOK, importResponse{ImportReport: rep}
+}
+
+// readImport decodes the todos of a POST /todos/import request, sent as
+// the "file" field of a multipart form or as the raw body. The format
+// parameter wins over the file extension and the content type.
+func readImport(w http.ResponseWriter, r *http.Request) ([]model.Todo, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	format := r.URL.Query().Get("format")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var body io.Reader = r.Body
+	if mediaType == "multipart/form-data" {
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			return nil, api.ErrInvalid("the import form needs a file field")
+		}
+		defer f.Close()
+		body = f
+		if format == "" {
+			format = formatOf(filepath.Ext(hdr.Filename), hdr.Header.Get("Content-Type"))
+		}
+	} else if format == "" {
+		format = formatOf("", mediaType)
+	}
+	if _, ok := exportFormats[format]; !ok {
+		return nil, api.ErrInvalid("unknown import format, set format to json, csv, todotxt or ics")
+	}
+	todos, err := decodeTodos(format, body)
+	var tooLarge *http.MaxBytesError
+	var invalid api.ErrInvalid
+	switch {
+	case errors.As(err, &tooLarge):
+		return nil, api.ErrInvalid(fmt.Sprintf("import is larger than %d bytes", tooLarge.Limit))
+	case err != nil && !errors.As(err, &invalid):
+		return nil, api.ErrInvalid(fmt.Sprintf("invalid %s: %v", format, err))
+	}
+	return todos, err
+}
+
+// formatOf guesses an import format from a file extension or content type
+func formatOf(ext, contentType string) string {
+	switch strings.ToLower(ext) {
+	case ".json":
+		return "json"
+	case ".csv":
+		return "csv"
+	case ".txt":
+		return "todotxt"
+	case ".ics":
+		return "ics"
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return "json"
+	case "text/csv":
+		return "csv"
+	case "text/plain":
+		return "todotxt"
+	case "text/calendar":
+		return "ics"
+	}
+	return ""
+}
+
+// decodeTodos reads the todos of an import in format. Errors in a row are
+// returned as api.ErrInvalid naming the row.
+func decodeTodos(format string, r io.Reader) ([]model.Todo, error) {
+	switch format {
+	case "csv":
+		return decodeCSV(r)
+	case "ics":
+		items, err := ical.Decode(r)
+		if err != nil {
+			return nil, api.ErrInvalid(err.Error())
+		}
+		todos := make([]model.Todo, len(items))
+		for i, it := range items {
+			todos[i] = it.Todo
+		}
+		return todos, nil
+	case "todotxt":
+		var todos []model.Todo
+		sc := bufio.NewScanner(r)
+		for line := 1; sc.Scan(); line++ {
+			if strings.TrimSpace(sc.Text()) == "" {
+				continue
+			}
+			t, err := todotxt.Parse(sc.Text())
+			if err != nil {
+				return nil, api.ErrInvalid(fmt.Sprintf("line %d: %v", line, err))
+			}
+			todos = append(todos, t)
+		}
+		return todos, sc.Err()
+	}
+	var todos []model.Todo
+	err := json.NewDecoder(r).Decode(&todos)
+	return todos, err
+}
+
+// decodeCSV reads todos from CSV with a header row naming the columns, see
+// csvColumns. Unknown columns are ignored.
+func decodeCSV(r io.Reader) ([]model.Todo, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		// spreadsheets like to start the file with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["name"]; !ok {
+		return nil, api.ErrInvalid("csv header has no name column")
+	}
+
+	var todos []model.Todo
+	for row := 1; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return todos, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		t := model.Todo{
+			Name:        get("name"),
+			Description: get("description"),
+			Status:      model.Status(get("status")),
+			Recurrence:  get("recurrence"),
+		}
+		if v := get("priority"); v != "" {
+			if t.Priority, err = strconv.Atoi(v); err != nil {
+				return nil, api.ErrInvalid(fmt.Sprintf("row %d: invalid priority %q", row, v))
+			}
+		}
+		for _, tag := range strings.Split(get("tags"), ";") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				t.Tags = append(t.Tags, tag)
+			}
+		}
+		if v := get("due_date"); v != "" {
+			if t.DueDate, err = parseDate(v); err != nil {
+				return nil, api.ErrInvalid(fmt.Sprintf("row %d: invalid due_date %q", row, v))
+			}
+		}
+		todos = append(todos, t)
+	}
+}
+
+// parseDate accepts an RFC3339 time or a plain date
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -4,26 +4,57 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/conbanwa/todo/internal/dao/cache"
 	"github.com/conbanwa/todo/internal/dao/cache/api"
 	"github.com/conbanwa/todo/internal/model"
 	"github.com/gin-gonic/gin"
 )
 
-// RegisterRoutes registers api REST routes on the provided Gin engine.
-func RegisterRoutes(r *gin.Engine, svc *api.Service) {
+// RegisterRoutes registers api REST routes on the provided Gin engine or group.
+func RegisterRoutes(r gin.IRouter, svc *api.Service) {
 	RegisterRoutesWithHub(r, svc, nil)
 }
 
 // RegisterRoutesWithHub registers api REST routes with WebSocket hub for broadcasting.
 // If hub is nil, routes work without WebSocket broadcasting (backward compatible).
-func RegisterRoutesWithHub(r *gin.Engine, svc *api.Service, hub *Hub) {
+func RegisterRoutesWithHub(r gin.IRouter, svc *api.Service, hub *Hub) {
+	r.GET("/workflow", func(c *gin.Context) { handleWorkflow(c, svc) })
+	r.GET("/audit", func(c *gin.Context) { handleAudit(c, svc) })
+	r.GET("/calendar.ics", func(c *gin.Context) { handleCalendar(c, svc) })
+
+	dav := gin.WrapH(NewCalDAV(svc, hub))
+	for _, method := range calDAVMethods {
+		r.Handle(method, calDAVRoot+"*path", dav)
+	}
+	// service discovery, RFC 6764
+	for _, method := range []string{http.MethodGet, "PROPFIND"} {
+		r.Handle(method, "/.well-known/caldav", func(c *gin.Context) {
+			c.Redirect(http.StatusMovedPermanently, calDAVRoot)
+		})
+	}
+
 	g := r.Group("/todos")
 	g.GET("", func(c *gin.Context) { handleList(c, svc) })
-	g.POST("", func(c *gin.Context) { handleCreateWithBroadcast(c, svc, hub) })
+	g.POST("", func(c *gin.Context) { handleCreateWithBroadcast(c, as(c, svc), hub) })
+	g.POST("batch", func(c *gin.Context) { handleBatchWithBroadcast(c, as(c, svc), hub) })
+	g.GET("export", func(c *gin.Context) { handleExport(c, svc) })
+	g.POST("import", func(c *gin.Context) { handleImportWithBroadcast(c, as(c, svc), hub) })
+	g.GET("search", func(c *gin.Context) { handleSearch(c, svc) })
+	g.GET("trash", func(c *gin.Context) { handleTrash(c, svc) })
 	g.GET(":id", func(c *gin.Context) { handleGet(c, svc) })
-	g.PUT(":id", func(c *gin.Context) { handleUpdateWithBroadcast(c, svc, hub) })
-	g.DELETE(":id", func(c *gin.Context) { handleDeleteWithBroadcast(c, svc, hub) })
+	g.GET(":id/children", func(c *gin.Context) { handleChildren(c, svc) })
+	g.GET(":id/graph", func(c *gin.Context) { handleGraph(c, svc) })
+	g.GET(":id/history", func(c *gin.Context) { handleHistory(c, svc) })
+	g.POST(":id/dependencies", func(c *gin.Context) { handleAddDependency(c, svc) })
+	g.DELETE(":id/dependencies/:blocker", func(c *gin.Context) { handleRemoveDependency(c, svc) })
+	g.PUT(":id", func(c *gin.Context) { handleUpdateWithBroadcast(c, as(c, svc), hub) })
+	g.PATCH(":id", func(c *gin.Context) { handlePatchWithBroadcast(c, as(c, svc), hub) })
+	g.DELETE(":id", func(c *gin.Context) { handleDeleteWithBroadcast(c, as(c, svc), hub) })
+	g.POST(":id/restore", func(c *gin.Context) { handleRestoreWithBroadcast(c, as(c, svc), hub) })
+}
+
+// as attributes the changes made while serving c to its caller, see callerOf
+func as(c *gin.Context, svc *api.Service) *api.Service {
+	return svc.As(callerOf(c.Request, c.Writer.Header()))
 }
 
 // @Summary List todos
@@ -31,18 +62,75 @@ func RegisterRoutesWithHub(r *gin.Engine, svc *api.Service, hub *Hub) {
 // @Tags todos
 // @Accept json
 // @Produce json
+// @Param status query string false "status filter, comma-separated for several"
+// @Param tags_any query string false "comma-separated tags, match any"
+// @Param tags_all query string false "comma-separated tags, match all"
+// @Param priority_min query int false "minimum priority"
+// @Param priority_max query int false "maximum priority"
+// @Param due_after query string false "due at or after (RFC3339)"
+// @Param due_before query string false "due before (RFC3339)"
+// @Param overdue query bool false "only overdue, not completed todos"
+// @Param q query string false "name/description substring"
+// @Param updated_since query string false "updated at or after (RFC3339)"
+// @Param parent_id query int false "direct subtasks of this todo, 0 for top-level todos"
 // @Param sort_by query string false "sort field"
 // @Param order query string false "sort order"
+// @Param limit query int false "page size (max 1000)"
+// @Param cursor query string false "opaque cursor from X-Next-Cursor"
+// @Param as_of query string false "list the todos as they were at this time (RFC3339)"
 // @Success 200 {array} Todo
+// @Header 200 {string} Link "next page URL, rel=next"
+// @Header 200 {string} X-Next-Cursor "cursor for the next page"
+// @Failure 400 {object} map[string]string
 // @Router /todos [get]
 func handleList(c *gin.Context, svc *api.Service) {
-	q := c.Request.URL.Query()
-	opts := cache.ListOptions{SortBy: q.Get("sort_by"), SortOrder: q.Get("order")}
-	if s := q.Get("status"); s != "" {
-		opts.Status = model.Status(s)
+	ctx := c.Request.Context()
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := listPage(ctx, svc, c.Request.URL.Query(), opts)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
 	}
-	items, _ := svc.List(opts)
-	c.JSON(http.StatusOK, items)
+	setPageHeaders(c.Writer.Header(), c.Request.URL, page.NextCursor)
+	c.JSON(http.StatusOK, page.Items)
+}
+
+// @Summary Search todos
+// @Description Full-text search over name, description and tags, best match first
+// @Tags todos
+// @Produce json
+// @Param q query string true "search words, each matched as a word prefix"
+// @Param limit query int false "maximum results (default 20, max 100)"
+// @Success 200 {array} cache.SearchResult
+// @Failure 400 {object} map[string]string
+// @Router /todos/search [get]
+func handleSearch(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	limit, err := parseSearchLimit(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	results, err := svc.Search(ctx, c.Query("q"), limit)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// @Summary Get workflow
+// @Description The statuses a todo can have and the allowed status changes
+// @Tags workflow
+// @Produce json
+// @Success 200 {object} api.Workflow
+// @Router /workflow [get]
+func handleWorkflow(c *gin.Context, svc *api.Service) {
+	c.JSON(http.StatusOK, svc.Workflow())
 }
 
 // @Summary Create api
@@ -52,20 +140,23 @@ func handleList(c *gin.Context, svc *api.Service) {
 // @Produce json
 // @Param api body Todo true "Todo to create"
 // @Success 201 {object} Todo
+// @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]interface{} "status not allowed by the workflow"
 // @Router /todos [post]
 func handleCreate(c *gin.Context, svc *api.Service) {
 	handleCreateWithBroadcast(c, svc, nil)
 }
 
 func handleCreateWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
+	ctx := c.Request.Context()
 	var t model.Todo
 	if err := c.ShouldBindJSON(&t); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
 		return
 	}
-	id, err := svc.Create(&t)
+	id, err := svc.Create(ctx, &t)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(updateStatus(err), errorBody(err))
 		return
 	}
 	t.ID = id
@@ -75,28 +166,324 @@ func handleCreateWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
 		hub.BroadcastCreate(&t)
 	}
 
+	c.Header("ETag", etag(t.Version))
 	c.JSON(http.StatusCreated, t)
 }
 
+// @Summary Batch changes
+// @Description Create, update and delete todos in one atomic step. Either every operation is applied or none; the results follow the order of the operations.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Param operations body []api.BatchOp true "operations, at most 100"
+// @Success 200 {object} batchResponse
+// @Failure 400 {object} batchResponse "an operation was invalid; nothing was applied"
+// @Failure 404 {object} batchResponse
+// @Failure 409 {object} batchResponse
+// @Failure 412 {object} batchResponse
+// @Failure 422 {object} batchResponse
+// @Router /todos/batch [post]
+func handleBatch(c *gin.Context, svc *api.Service) {
+	handleBatchWithBroadcast(c, svc, nil)
+}
+
+func handleBatchWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
+	ctx := c.Request.Context()
+	var ops []api.BatchOp
+	if err := c.ShouldBindJSON(&ops); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	c.JSON(runBatch(ctx, svc, hub, ops))
+}
+
+// @Summary Export todos
+// @Description Download the todos selected by the GET /todos filters as JSON, CSV, todo.txt or iCalendar
+// @Tags todos
+// @Produce json
+// @Produce text/csv
+// @Produce plain
+// @Produce text/calendar
+// @Param format query string false "json (default), csv, todotxt or ics"
+// @Param component query string false "ics only: vtodo (default) or vevent"
+// @Param status query string false "filter by status, comma-separated for several"
+// @Param tags_any query string false "comma-separated tags, any must match"
+// @Param due_after query string false "due at or after (RFC3339)"
+// @Param due_before query string false "due before (RFC3339)"
+// @Success 200 {array} Todo
+// @Failure 400 {object} map[string]string
+// @Router /todos/export [get]
+func handleExport(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	format := exportFormat(c.Request)
+	body, err := exportTodos(ctx, svc, c.Request, format)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	setExportHeaders(c.Writer.Header(), format)
+	c.Data(http.StatusOK, exportFormats[format].contentType, body)
+}
+
+// @Summary Calendar feed
+// @Description The todos selected by the GET /todos filters as an iCalendar feed to subscribe to from calendar apps
+// @Tags todos
+// @Produce text/calendar
+// @Param component query string false "vtodo (default) or vevent, for calendar apps that do not show tasks"
+// @Param status query string false "filter by status, comma-separated for several"
+// @Param tags_any query string false "comma-separated tags, any must match"
+// @Param due_after query string false "due at or after (RFC3339)"
+// @Param due_before query string false "due before (RFC3339)"
+// @Success 200 {string} string "text/calendar"
+// @Failure 400 {object} map[string]string
+// @Router /calendar.ics [get]
+func handleCalendar(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	body, err := exportTodos(ctx, svc, c.Request, "ics")
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, exportFormats["ics"].contentType, body)
+}
+
+// @Summary Import todos
+// @Description Create todos from a JSON, CSV, todo.txt or iCalendar file, sent as the "file" field of a multipart form or as the raw body. Todos with the name and due date of an existing todo or an earlier row are skipped. Nothing is imported when a row is invalid.
+// @Tags todos
+// @Accept json
+// @Accept text/csv
+// @Accept plain
+// @Accept text/calendar
+// @Accept mpfd
+// @Produce json
+// @Param format query string false "json, csv, todotxt or ics; guessed from the file name or content type when missing"
+// @Param dry_run query bool false "validate and report without importing"
+// @Param file formData file false "the file to import"
+// @Success 200 {object} importResponse
+// @Failure 400 {object} map[string]string
+// @Failure 422 {object} importResponse "a row was invalid; nothing was imported"
+// @Router /todos/import [post]
+func handleImport(c *gin.Context, svc *api.Service) {
+	handleImportWithBroadcast(c, svc, nil)
+}
+
+func handleImportWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
+	ctx := c.Request.Context()
+	c.JSON(runImport(ctx, svc, hub, c.Writer, c.Request))
+}
+
 // @Summary Get api
 // @Description Get a api by ID
 // @Tags todos
 // @Accept json
 // @Produce json
 // @Param id path int true "Todo ID"
+// @Param as_of query string false "the todo as it was at this time (RFC3339)"
 // @Success 200 {object} Todo
+// @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /todos/{id} [get]
 func handleGet(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-	t, err := svc.Get(id)
+	asOf, err := parseTimeParam(c.Request.URL.Query(), "as_of")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	t, err := getTodo(ctx, svc, id, asOf)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	c.Header("ETag", etag(t.Version))
 	c.JSON(http.StatusOK, t)
 }
 
+// @Summary List subtasks
+// @Description List the direct subtasks of a todo; accepts the GET /todos query parameters
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {array} Todo
+// @Header 200 {string} Link "next page URL, rel=next"
+// @Header 200 {string} X-Next-Cursor "cursor for the next page"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /todos/{id}/children [get]
+func handleChildren(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := svc.Children(ctx, id, opts)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	setPageHeaders(c.Writer.Header(), c.Request.URL, page.NextCursor)
+	c.JSON(http.StatusOK, page.Items)
+}
+
+// @Summary List trash
+// @Description List deleted todos that have not been purged yet; accepts the GET /todos query parameters
+// @Tags todos
+// @Produce json
+// @Success 200 {array} Todo
+// @Header 200 {string} Link "next page URL, rel=next"
+// @Header 200 {string} X-Next-Cursor "cursor for the next page"
+// @Failure 400 {object} map[string]string
+// @Router /todos/trash [get]
+func handleTrash(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := svc.Trash(ctx, opts)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	setPageHeaders(c.Writer.Header(), c.Request.URL, page.NextCursor)
+	c.JSON(http.StatusOK, page.Items)
+}
+
+// @Summary Todo history
+// @Description Audit entries of one todo, oldest first, with a field-level diff per change. Deleted todos keep their history
+// @Tags audit
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param actor query string false "exact actor (X-Actor of the change)"
+// @Param action query string false "create, update, delete or restore"
+// @Param request_id query string false "X-Request-ID of the change"
+// @Param since query string false "recorded at or after (RFC3339)"
+// @Param until query string false "recorded before (RFC3339)"
+// @Param after query int false "entries after this entry id"
+// @Param limit query int false "page size (default 100, max 1000)"
+// @Success 200 {array} model.AuditEntry
+// @Header 200 {string} Link "next page URL, rel=next"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /todos/{id}/history [get]
+func handleHistory(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	opts, err := parseAuditOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries, err := svc.History(ctx, id, opts)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	setAuditPageHeaders(c.Writer.Header(), c.Request.URL, entries, opts.Limit)
+	c.JSON(http.StatusOK, entries)
+}
+
+// @Summary Audit log
+// @Description Audit entries of all todos, oldest first
+// @Tags audit
+// @Produce json
+// @Param todo_id query int false "entries of this todo"
+// @Param actor query string false "exact actor (X-Actor of the change)"
+// @Param action query string false "create, update, delete or restore"
+// @Param request_id query string false "X-Request-ID of the change"
+// @Param since query string false "recorded at or after (RFC3339)"
+// @Param until query string false "recorded before (RFC3339)"
+// @Param after query int false "entries after this entry id"
+// @Param limit query int false "page size (default 100, max 1000)"
+// @Success 200 {array} model.AuditEntry
+// @Header 200 {string} Link "next page URL, rel=next"
+// @Failure 400 {object} map[string]string
+// @Router /audit [get]
+func handleAudit(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	opts, err := parseAuditOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries, err := svc.Audit(ctx, opts)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	setAuditPageHeaders(c.Writer.Header(), c.Request.URL, entries, opts.Limit)
+	c.JSON(http.StatusOK, entries)
+}
+
+// @Summary Dependency graph
+// @Description Get the dependency DAG around a todo: everything it is transitively blocked by or blocks
+// @Tags dependencies
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} api.Graph
+// @Failure 404 {object} map[string]string
+// @Router /todos/{id}/graph [get]
+func handleGraph(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	g, err := svc.DependencyGraph(ctx, id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, g)
+}
+
+// @Summary Add dependency
+// @Description Mark a todo as blocked by another one; it cannot be completed until the blocker is
+// @Tags dependencies
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param dependency body model.Dependency true "blocked_by is the blocking todo's ID"
+// @Success 201 {object} model.Dependency
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /todos/{id}/dependencies [post]
+func handleAddDependency(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var d model.Dependency
+	if err := c.ShouldBindJSON(&d); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	d.TodoID = id
+	if err := svc.AddDependency(ctx, d.TodoID, d.BlockedBy); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, d)
+}
+
+// @Summary Remove dependency
+// @Description Remove a blocked-by relationship
+// @Tags dependencies
+// @Param id path int true "Todo ID"
+// @Param blocker path int true "Blocking todo ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /todos/{id}/dependencies/{blocker} [delete]
+func handleRemoveDependency(c *gin.Context, svc *api.Service) {
+	ctx := c.Request.Context()
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	blocker, _ := strconv.ParseInt(c.Param("blocker"), 10, 64)
+	if err := svc.RemoveDependency(ctx, id, blocker); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 // @Summary Update api
 // @Description Update a api by ID
 // @Tags todos
@@ -104,14 +491,19 @@ func handleGet(c *gin.Context, svc *api.Service) {
 // @Produce json
 // @Param id path int true "Todo ID"
 // @Param api body Todo true "Todo to update"
+// @Param If-Match header string false "ETag of the version being replaced"
 // @Success 200 {object} Todo
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 422 {object} map[string]interface{} "status change not allowed by the workflow"
 // @Router /todos/{id} [put]
 func handleUpdate(c *gin.Context, svc *api.Service) {
 	handleUpdateWithBroadcast(c, svc, nil)
 }
 
 func handleUpdateWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
+	ctx := c.Request.Context()
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 	var t model.Todo
 	if err := c.ShouldBindJSON(&t); err != nil {
@@ -119,38 +511,96 @@ func handleUpdateWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
 		return
 	}
 	t.ID = id
-	if err := svc.Update(&t); err != nil {
+	version, err := parseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	t.Version = version
+	if err := svc.Update(ctx, &t); err != nil {
+		c.JSON(updateStatus(err), errorBody(err))
+		return
+	}
 
 	// Get updated api to broadcast complete state and return accurate data
-	updated, err := svc.Get(id)
+	updated, err := svc.Get(ctx, id)
 	if err == nil {
 		if hub != nil {
 			hub.BroadcastUpdate(updated)
 		}
+		c.Header("ETag", etag(updated.Version))
 		c.JSON(http.StatusOK, updated)
 	} else {
+		c.Header("ETag", etag(t.Version))
 		c.JSON(http.StatusOK, t)
 	}
 }
 
+// @Summary Patch api
+// @Description Partially update a api with an RFC 7396 merge patch or an RFC 6902 JSON patch
+// @Tags todos
+// @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param If-Match header string false "ETag of the version being patched"
+// @Success 200 {object} Todo
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 422 {object} map[string]interface{} "status change not allowed by the workflow"
+// @Router /todos/{id} [patch]
+func handlePatch(c *gin.Context, svc *api.Service) {
+	handlePatchWithBroadcast(c, svc, nil)
+}
+
+func handlePatchWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
+	ctx := c.Request.Context()
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	version, err := parseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	updated, err := applyPatch(ctx, svc, id, c.ContentType(), body, version)
+	if err != nil {
+		c.JSON(errorStatus(err), errorBody(err))
+		return
+	}
+
+	if hub != nil {
+		hub.BroadcastUpdate(updated)
+	}
+
+	c.Header("ETag", etag(updated.Version))
+	c.JSON(http.StatusOK, updated)
+}
+
 // @Summary Delete api
-// @Description Delete a api by ID
+// @Description Move a api to the trash. Subtasks are deleted too or block the delete, depending on the server's DELETE_POLICY
 // @Tags todos
 // @Param id path int true "Todo ID"
 // @Success 204
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /todos/{id} [delete]
 func handleDelete(c *gin.Context, svc *api.Service) {
 	handleDeleteWithBroadcast(c, svc, nil)
 }
 
 func handleDeleteWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
+	ctx := c.Request.Context()
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err := svc.Delete(id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if err := svc.Delete(ctx, id); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -161,3 +611,32 @@ func handleDeleteWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// @Summary Restore api
+// @Description Take a api out of the trash together with the subtasks deleted with it
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} Todo
+// @Failure 404 {object} map[string]string "not in the trash"
+// @Router /todos/{id}/restore [post]
+func handleRestore(c *gin.Context, svc *api.Service) {
+	handleRestoreWithBroadcast(c, svc, nil)
+}
+
+func handleRestoreWithBroadcast(c *gin.Context, svc *api.Service, hub *Hub) {
+	ctx := c.Request.Context()
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	t, err := svc.Restore(ctx, id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if hub != nil {
+		hub.BroadcastRestore(t)
+	}
+
+	c.Header("ETag", etag(t.Version))
+	c.JSON(http.StatusOK, t)
+}
@@ -2,14 +2,19 @@ package transport
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/conbanwa/todo/internal/dao/cache"
 	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/dao/eventlog"
 	"github.com/conbanwa/todo/internal/model"
 	"github.com/gin-gonic/gin"
 )
@@ -23,9 +28,11 @@ type mockStore struct {
 	updateErr error
 	deleteErr error
 	listErr   error
+	deps      map[model.Dependency]bool
+	audit     []model.AuditEntry
 }
 
-func (m *mockStore) Create(t *model.Todo) (int64, error) {
+func (m *mockStore) Create(ctx context.Context, t *model.Todo) (int64, error) {
 	if m.createErr != nil {
 		return 0, m.createErr
 	}
@@ -43,7 +50,7 @@ func (m *mockStore) Create(t *model.Todo) (int64, error) {
 	return t.ID, nil
 }
 
-func (m *mockStore) Get(id int64) (*model.Todo, error) {
+func (m *mockStore) Get(ctx context.Context, id int64) (*model.Todo, error) {
 	if m.getErr != nil {
 		return nil, m.getErr
 	}
@@ -57,7 +64,7 @@ func (m *mockStore) Get(id int64) (*model.Todo, error) {
 	return nil, cache.ErrNotFound
 }
 
-func (m *mockStore) Update(t *model.Todo) error {
+func (m *mockStore) Update(ctx context.Context, t *model.Todo) error {
 	if m.updateErr != nil {
 		return m.updateErr
 	}
@@ -72,7 +79,7 @@ func (m *mockStore) Update(t *model.Todo) error {
 	return nil
 }
 
-func (m *mockStore) Delete(id int64) error {
+func (m *mockStore) Delete(ctx context.Context, id int64, at time.Time) error {
 	if m.deleteErr != nil {
 		return m.deleteErr
 	}
@@ -86,7 +93,16 @@ func (m *mockStore) Delete(id int64) error {
 	return nil
 }
 
-func (m *mockStore) List(opts cache.ListOptions) ([]model.Todo, error) {
+func (m *mockStore) Restore(ctx context.Context, id int64) (*model.Todo, error) {
+	// Delete removes todos outright, so the trash is always empty
+	return nil, cache.ErrNotFound
+}
+
+func (m *mockStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockStore) List(ctx context.Context, opts cache.ListOptions) ([]model.Todo, error) {
 	if m.listErr != nil {
 		return nil, m.listErr
 	}
@@ -100,6 +116,75 @@ func (m *mockStore) List(opts cache.ListOptions) ([]model.Todo, error) {
 	return cache.FilterAndSort(result, opts), nil
 }
 
+func (m *mockStore) Search(ctx context.Context, query string, limit int) ([]cache.SearchResult, error) {
+	todos, _ := m.List(ctx, cache.ListOptions{Query: query})
+	results := make([]cache.SearchResult, 0, len(todos))
+	for _, t := range todos {
+		results = append(results, cache.SearchResult{Todo: t, Score: 1, Snippet: t.Name})
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (m *mockStore) AddDependency(ctx context.Context, todoID, blockedBy int64) error {
+	if m.deps == nil {
+		m.deps = make(map[model.Dependency]bool)
+	}
+	m.deps[model.Dependency{TodoID: todoID, BlockedBy: blockedBy}] = true
+	return nil
+}
+
+func (m *mockStore) RemoveDependency(ctx context.Context, todoID, blockedBy int64) error {
+	d := model.Dependency{TodoID: todoID, BlockedBy: blockedBy}
+	if !m.deps[d] {
+		return cache.ErrNotFound
+	}
+	delete(m.deps, d)
+	return nil
+}
+
+func (m *mockStore) Blockers(ctx context.Context, todoID int64) ([]int64, error) {
+	var ids []int64
+	for d := range m.deps {
+		if d.TodoID == todoID {
+			ids = append(ids, d.BlockedBy)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockStore) Dependents(ctx context.Context, todoID int64) ([]int64, error) {
+	var ids []int64
+	for d := range m.deps {
+		if d.BlockedBy == todoID {
+			ids = append(ids, d.TodoID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockStore) AddAudit(ctx context.Context, e *model.AuditEntry) error {
+	e.ID = int64(len(m.audit)) + 1
+	e.CreatedAt = time.Now()
+	m.audit = append(m.audit, *e)
+	return nil
+}
+
+func (m *mockStore) ListAudit(ctx context.Context, opts cache.AuditOptions) ([]model.AuditEntry, error) {
+	entries := []model.AuditEntry{}
+	for _, e := range m.audit {
+		if e.ID > opts.AfterID && cache.MatchAudit(e, opts) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// WithTx runs fn on the mock itself; the mock does not roll back
+func (m *mockStore) WithTx(ctx context.Context, fn func(cache.Store) error) error { return fn(m) }
+
 func setupGinTestRouter(svc *api.Service) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
@@ -266,6 +351,683 @@ func TestGinHandler_handleList(t *testing.T) {
 			t.Errorf("expected empty list, got %d todos", len(response))
 		}
 	})
+
+	t.Run("applies rich filters", func(t *testing.T) {
+		store := &mockStore{todos: make(map[int64]*model.Todo)}
+		store.todos[1] = &model.Todo{ID: 1, Name: "Deploy", Status: model.InProgress, Priority: 5, Tags: []string{"ops"}}
+		store.todos[2] = &model.Todo{ID: 2, Name: "Docs", Status: model.NotStarted, Priority: 1, Tags: []string{"docs"}}
+		store.todos[3] = &model.Todo{ID: 3, Name: "Deploy docs", Status: model.Completed, Priority: 3, Tags: []string{"ops", "docs"}}
+		svc := api.NewService(store)
+		r := setupGinTestRouter(svc)
+
+		cases := map[string][]int64{
+			"/todos?status=in_progress,completed":        {1, 3},
+			"/todos?tags_any=docs":                       {2, 3},
+			"/todos?tags_all=ops&tags_all=docs":          {3},
+			"/todos?priority_min=2&priority_max=4":       {3},
+			"/todos?q=deploy&status=completed":           {3},
+			"/todos?q=DEPLOY&sort_by=priority&order=asc": {3, 1},
+		}
+		for url, want := range cases {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: expected status 200, got %d", url, w.Code)
+			}
+			var response []model.Todo
+			json.NewDecoder(w.Body).Decode(&response)
+			if len(response) != len(want) {
+				t.Fatalf("%s: expected %v, got %d todos", url, want, len(response))
+			}
+			for i, id := range want {
+				if response[i].ID != id {
+					t.Errorf("%s: expected %v, got id %d at %d", url, want, response[i].ID, i)
+				}
+			}
+		}
+
+		for _, url := range []string{"/todos?priority_min=high", "/todos?due_before=tomorrow", "/todos?overdue=maybe"} {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", url, w.Code)
+			}
+		}
+	})
+
+	t.Run("paginates with limit and cursor", func(t *testing.T) {
+		store := &mockStore{todos: make(map[int64]*model.Todo)}
+		for i := int64(1); i <= 5; i++ {
+			store.todos[i] = &model.Todo{ID: i, Name: "Todo"}
+		}
+		svc := api.NewService(store)
+		r := setupGinTestRouter(svc)
+
+		var ids []int64
+		url := "/todos?limit=2"
+		for pages := 0; url != ""; pages++ {
+			if pages > 3 {
+				t.Fatal("too many pages")
+			}
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			var response []model.Todo
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			for _, todo := range response {
+				ids = append(ids, todo.ID)
+			}
+
+			url = ""
+			if next := w.Header().Get("X-Next-Cursor"); next != "" {
+				if link := w.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+					t.Errorf("expected Link rel=next header, got %q", link)
+				}
+				url = "/todos?limit=2&cursor=" + next
+			}
+		}
+
+		if len(ids) != 5 || ids[0] != 1 || ids[4] != 5 {
+			t.Errorf("expected ids 1..5 across pages, got %v", ids)
+		}
+	})
+
+	t.Run("rejects invalid cursor", func(t *testing.T) {
+		svc := api.NewService(&mockStore{todos: make(map[int64]*model.Todo)})
+		r := setupGinTestRouter(svc)
+
+		req := httptest.NewRequest(http.MethodGet, "/todos?limit=2&cursor=bogus", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestGinHandler_handleSearch(t *testing.T) {
+	store := &mockStore{todos: make(map[int64]*model.Todo)}
+	store.todos[1] = &model.Todo{ID: 1, Name: "Deploy release"}
+	store.todos[2] = &model.Todo{ID: 2, Name: "Write docs"}
+	r := setupGinTestRouter(api.NewService(store))
+
+	t.Run("returns ranked results", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/todos/search?q=deploy", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var results []cache.SearchResult
+		if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if len(results) != 1 || results[0].Todo.ID != 1 {
+			t.Errorf("expected todo 1, got %+v", results)
+		}
+	})
+
+	t.Run("requires a query", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/todos/search", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("rejects invalid limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/todos/search?q=deploy&limit=x", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestGinHandler_handleChildren(t *testing.T) {
+	store := &mockStore{todos: make(map[int64]*model.Todo)}
+	store.todos[1] = &model.Todo{ID: 1, Name: "Release"}
+	store.todos[2] = &model.Todo{ID: 2, Name: "Build", ParentID: 1}
+	store.todos[3] = &model.Todo{ID: 3, Name: "Test", ParentID: 1}
+	store.todos[4] = &model.Todo{ID: 4, Name: "Other"}
+	r := setupGinTestRouter(api.NewService(store))
+
+	t.Run("lists direct subtasks", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/todos/1/children", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var todos []model.Todo
+		json.Unmarshal(w.Body.Bytes(), &todos)
+		if len(todos) != 2 || todos[0].ID != 2 || todos[1].ID != 3 {
+			t.Errorf("expected subtasks 2 and 3, got %+v", todos)
+		}
+	})
+
+	t.Run("returns 404 for unknown parent", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/todos/99/children", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("filters top-level todos", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/todos?parent_id=0", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var todos []model.Todo
+		json.Unmarshal(w.Body.Bytes(), &todos)
+		if len(todos) != 2 {
+			t.Errorf("expected 2 top-level todos, got %d", len(todos))
+		}
+	})
+
+	t.Run("blocks deleting a parent", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/todos/1", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", w.Code)
+		}
+	})
+}
+
+func TestGinHandler_Dependencies(t *testing.T) {
+	store := &mockStore{todos: make(map[int64]*model.Todo)}
+	store.todos[1] = &model.Todo{ID: 1, Name: "Design"}
+	store.todos[2] = &model.Todo{ID: 2, Name: "Build"}
+	r := setupGinTestRouter(api.NewService(store))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/todos/2/dependencies", `{"blocked_by": 1}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/todos/1/dependencies", `{"blocked_by": 2}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected cycle to answer 400, got %d", w.Code)
+	}
+	if w := do(http.MethodPut, "/todos/2", `{"name": "Build", "status": "completed"}`); w.Code != http.StatusConflict {
+		t.Errorf("expected completing a blocked todo to answer 409, got %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "/todos/2/graph", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var g api.Graph
+	json.Unmarshal(w.Body.Bytes(), &g)
+	if g.Root != 2 || len(g.Nodes) != 2 || len(g.Edges) != 1 || g.Edges[0] != (model.Dependency{TodoID: 2, BlockedBy: 1}) {
+		t.Errorf("unexpected graph %+v", g)
+	}
+
+	if w := do(http.MethodDelete, "/todos/2/dependencies/1", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/todos/2/dependencies/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/todos/99/graph", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_Workflow(t *testing.T) {
+	wf := &api.Workflow{
+		States:  []api.State{{Name: model.NotStarted}, {Name: "review"}, {Name: model.Completed}},
+		Initial: model.NotStarted,
+		Transitions: map[model.Status][]model.Status{
+			model.NotStarted: {"review"},
+			"review":         {model.NotStarted, model.Completed},
+		},
+	}
+	store := &mockStore{todos: make(map[int64]*model.Todo)}
+	store.todos[1] = &model.Todo{ID: 1, Name: "Spec", Status: model.NotStarted}
+	r := setupGinTestRouter(api.NewService(store, api.WithWorkflow(wf)))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/workflow", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var got api.Workflow
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if len(got.States) != 3 || got.States[1].Name != "review" || len(got.Transitions["review"]) != 2 {
+		t.Errorf("unexpected workflow %+v", got)
+	}
+
+	w = do(http.MethodPut, "/todos/1", `{"name": "Spec", "status": "completed"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Code    string         `json:"code"`
+		From    model.Status   `json:"from"`
+		To      model.Status   `json:"to"`
+		Allowed []model.Status `json:"allowed"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Code != "invalid_transition" || body.From != model.NotStarted || body.To != model.Completed ||
+		len(body.Allowed) != 1 || body.Allowed[0] != "review" {
+		t.Errorf("unexpected error body %s", w.Body.String())
+	}
+
+	if w := do(http.MethodPatch, "/todos/1", `{"status": "review"}`); w.Code != http.StatusOK {
+		t.Errorf("expected allowed transition to answer 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/todos", `{"name": "New", "status": "archived"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected unknown status on create to answer 422, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/todos?status=archived", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected unknown status filter to answer 400, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_Trash(t *testing.T) {
+	ctx := context.Background()
+	svc := api.NewService(cache.NewInMemoryStore())
+	r := setupGinTestRouter(svc)
+	id, _ := svc.Create(ctx, &model.Todo{Name: "Old"})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodDelete, "/todos/1"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+	w := do(http.MethodGet, "/todos/trash")
+	var trash []model.Todo
+	json.Unmarshal(w.Body.Bytes(), &trash)
+	if w.Code != http.StatusOK || len(trash) != 1 || trash[0].ID != id || trash[0].DeletedAt == nil {
+		t.Fatalf("unexpected trash %d %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPost, "/todos/1/restore")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != `"3"` {
+		t.Errorf("expected ETag \"3\" after delete and restore, got %q", got)
+	}
+	if w := do(http.MethodPost, "/todos/1/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 restoring a live todo, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/todos/1"); w.Code != http.StatusOK {
+		t.Errorf("expected the restored todo to be back, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_Audit(t *testing.T) {
+	r := setupGinTestRouter(api.NewService(cache.NewInMemoryStore()))
+
+	do := func(method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/todos", `{"name": "Draft"}`, map[string]string{"X-Actor": "alice"})
+	if w.Code != http.StatusCreated || w.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("expected 201 with a generated request id, got %d %v", w.Code, w.Header())
+	}
+	w = do(http.MethodPatch, "/todos/1", `{"name": "Final"}`, map[string]string{"X-Actor": "bob", "X-Request-ID": "req-42"})
+	if w.Code != http.StatusOK || w.Header().Get("X-Request-ID") != "req-42" {
+		t.Fatalf("expected 200 echoing the request id, got %d %v", w.Code, w.Header())
+	}
+
+	w = do(http.MethodGet, "/todos/1/history", "", nil)
+	var history []model.AuditEntry
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if w.Code != http.StatusOK || len(history) != 2 || history[0].Actor != "alice" || history[1].RequestID != "req-42" {
+		t.Fatalf("unexpected history %d %s", w.Code, w.Body.String())
+	}
+	if c := history[1].Changes; len(c) != 1 || c[0].Field != "name" || string(c[0].New) != `"Final"` {
+		t.Errorf("unexpected diff %+v", c)
+	}
+
+	w = do(http.MethodGet, "/audit?actor=bob&action=update", "", nil)
+	var entries []model.AuditEntry
+	json.Unmarshal(w.Body.Bytes(), &entries)
+	if w.Code != http.StatusOK || len(entries) != 1 || entries[0].TodoID != 1 {
+		t.Errorf("unexpected audit %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/audit?limit=1", "", nil)
+	if link := w.Header().Get("Link"); !strings.Contains(link, "after=1") {
+		t.Errorf("expected a next page link, got %q", link)
+	}
+
+	if w := do(http.MethodGet, "/audit?action=rename", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown action, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/todos/99/history", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown todo, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_Batch(t *testing.T) {
+	ctx := context.Background()
+	svc := api.NewService(cache.NewInMemoryStore())
+	svc.Create(ctx, &model.Todo{Name: "Existing"})
+	r := setupGinTestRouter(svc)
+
+	post := func(body string) (*httptest.ResponseRecorder, batchResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/todos/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp batchResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := post(`[
+		{"op": "create", "todo": {"name": "New"}},
+		{"op": "update", "id": 1, "todo": {"name": "Renamed"}},
+		{"op": "delete", "id": 1}
+	]`)
+	if w.Code != http.StatusBadRequest || len(resp.Results) != 3 {
+		t.Fatalf("expected 400 for a todo named twice, got %d %s", w.Code, w.Body.String())
+	}
+	if got := []int{resp.Results[0].Status, resp.Results[1].Status, resp.Results[2].Status}; got[0] != http.StatusFailedDependency ||
+		got[1] != http.StatusFailedDependency || got[2] != http.StatusBadRequest || resp.Results[2].Error == "" {
+		t.Errorf("unexpected per-operation results %+v", resp.Results)
+	}
+
+	w, resp = post(`[
+		{"op": "create", "todo": {"name": "New"}},
+		{"op": "update", "id": 1, "todo": {"name": "Renamed"}}
+	]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if r := resp.Results[0]; r.Status != http.StatusCreated || r.ID != 2 || r.Todo.Name != "New" {
+		t.Errorf("unexpected create result %+v", r)
+	}
+	if r := resp.Results[1]; r.Status != http.StatusOK || r.Todo.Version != 2 {
+		t.Errorf("unexpected update result %+v", r)
+	}
+
+	if w, _ := post(`[{"op": "delete", "id": 42}]`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown todo, got %d", w.Code)
+	}
+	if w, _ := post(`[]`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty batch, got %d", w.Code)
+	}
+	if w, _ := post(`{"op": "create"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a body that is not a list, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	svc := api.NewService(cache.NewInMemoryStore())
+	due := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	svc.Create(ctx, &model.Todo{Name: "Pay rent", DueDate: due, Priority: 1, Tags: []string{"home", "@phone"}})
+	svc.Create(ctx, &model.Todo{Name: "Ship it", DueDate: due, Status: model.Completed})
+	r := setupGinTestRouter(svc)
+
+	export := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos/export"+query, nil))
+		return w
+	}
+	w := export("?format=todotxt&status=not_started")
+	if w.Code != http.StatusOK || w.Body.String() != "(A) "+time.Now().UTC().Format("2006-01-02")+" Pay rent +home @phone due:2024-05-01\n" {
+		t.Errorf("unexpected todo.txt export %d %q", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="todo.txt"` {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	w = export("?format=csv")
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], "1,Pay rent,,not_started,1,home;@phone,2024-05-01T00:00:00Z") {
+		t.Errorf("unexpected csv export %q", w.Body.String())
+	}
+	var todos []model.Todo
+	if w = export(""); json.Unmarshal(w.Body.Bytes(), &todos) != nil || len(todos) != 2 {
+		t.Errorf("unexpected json export %q", w.Body.String())
+	}
+	if w = export("?format=xml"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", w.Code)
+	}
+
+	post := func(query, contentType string, body io.Reader) (*httptest.ResponseRecorder, importResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/todos/import"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp importResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	txt := "(B) Water plants +home due:2024-05-02\n\nPay rent due:2024-05-01\nx Old chore\n"
+	w, resp := post("?dry_run=true", "text/plain", strings.NewReader(txt))
+	if w.Code != http.StatusOK || resp.ImportReport == nil || !resp.DryRun || resp.Created != 2 || resp.Skipped != 1 {
+		t.Fatalf("unexpected dry run %d %s", w.Code, w.Body.String())
+	}
+	if list, _ := svc.List(ctx, cache.ListOptions{}); len(list) != 2 {
+		t.Errorf("expected the dry run to import nothing, got %d todos", len(list))
+	}
+
+	// a multipart CSV upload, the format taken from the file name
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "export.csv")
+	fw.Write([]byte("\ufeffName,Priority,Tags,Due_Date,Notes\nWater plants,2,home;garden,2024-05-02,x\nCall mom,,,,\n"))
+	mw.Close()
+	w, resp = post("", mw.FormDataContentType(), &form)
+	if w.Code != http.StatusOK || resp.Created != 2 || resp.Rows[0].ID == 0 {
+		t.Fatalf("unexpected import %d %s", w.Code, w.Body.String())
+	}
+	if plants, _ := svc.Get(ctx, resp.Rows[0].ID); plants.Priority != 2 || len(plants.Tags) != 2 || !plants.DueDate.Equal(due.AddDate(0, 0, 1)) {
+		t.Errorf("unexpected imported todo %+v", plants)
+	}
+
+	w, resp = post("?format=todotxt", "application/octet-stream", strings.NewReader(txt))
+	if w.Code != http.StatusOK || resp.Created != 1 || resp.Skipped != 2 {
+		t.Errorf("expected only the completed chore imported, got %d %s", w.Code, w.Body.String())
+	}
+	if w, resp = post("", "application/json", strings.NewReader(`[{"name": "ok"}, {"name": ""}]`)); w.Code != http.StatusUnprocessableEntity || resp.Invalid != 1 || resp.Error == "" {
+		t.Errorf("expected 422 for an invalid row, got %d %s", w.Code, w.Body.String())
+	}
+	if w, _ = post("", "text/plain", strings.NewReader("Pay rent due:soon")); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unreadable line, got %d", w.Code)
+	}
+	if w, _ = post("", "application/xml", strings.NewReader("<todos/>")); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_Calendar(t *testing.T) {
+	ctx := context.Background()
+	svc := api.NewService(cache.NewInMemoryStore())
+	due := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	svc.Create(ctx, &model.Todo{Name: "Pay rent", DueDate: due, Priority: 1, Tags: []string{"home"}})
+	svc.Create(ctx, &model.Todo{Name: "Ship it", DueDate: due, Status: model.Completed})
+	r := setupGinTestRouter(svc)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/calendar.ics"+query, nil))
+		return w
+	}
+	w := get("?status=not_started")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, line := range []string{"BEGIN:VTODO", "UID:todo-1", "SUMMARY:Pay rent", "DUE:20240501T090000Z", "STATUS:NEEDS-ACTION", "PRIORITY:1", "CATEGORIES:home"} {
+		if !strings.Contains(body, line+"\r\n") {
+			t.Errorf("expected %q in the feed, got\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "Ship it") {
+		t.Errorf("expected the completed todo filtered out, got\n%s", body)
+	}
+	if body = get("?component=vevent").Body.String(); strings.Count(body, "BEGIN:VEVENT") != 2 || !strings.Contains(body, "DTSTART;VALUE=DATE:20240501") {
+		t.Errorf("expected two all-day events, got\n%s", body)
+	}
+	if w = get("?component=vjournal"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown component, got %d", w.Code)
+	}
+	if w = get("?due_before=tomorrow"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid filter, got %d", w.Code)
+	}
+
+	// the feed of one server imports into another
+	other := api.NewService(cache.NewInMemoryStore())
+	req := httptest.NewRequest(http.MethodPost, "/todos/import", strings.NewReader(get("").Body.String()))
+	req.Header.Set("Content-Type", "text/calendar")
+	w = httptest.NewRecorder()
+	setupGinTestRouter(other).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the calendar imported, got %d %s", w.Code, w.Body.String())
+	}
+	list, _ := other.List(ctx, cache.ListOptions{SortBy: "id"})
+	if len(list) != 2 || list[0].Name != "Pay rent" || !list[0].DueDate.Equal(due) || list[0].Priority != 1 || list[1].Status != model.Completed {
+		t.Errorf("unexpected imported todos %+v", list)
+	}
+}
+
+func TestGinHandler_ListAsOf(t *testing.T) {
+	ctx := context.Background()
+	store, err := eventlog.NewEventStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open event store: %v", err)
+	}
+	defer store.Close()
+	svc := api.NewService(store)
+	todo := &model.Todo{Name: "Draft"}
+	if _, err := svc.Create(ctx, todo); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	asOf := time.Now().UTC().Format(time.RFC3339Nano)
+	time.Sleep(5 * time.Millisecond)
+	todo.Name = "Final"
+	if err := svc.Update(ctx, todo); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	r := setupGinTestRouter(svc)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	w := get("/todos?as_of=" + asOf)
+	var todos []model.Todo
+	json.Unmarshal(w.Body.Bytes(), &todos)
+	if w.Code != http.StatusOK || len(todos) != 1 || todos[0].Name != "Draft" {
+		t.Fatalf("expected the earlier name, got %d %s", w.Code, w.Body.String())
+	}
+	if w := get("/todos?as_of=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid time, got %d", w.Code)
+	}
+
+	// stores without an event log are rewound through the audit log
+	svc = api.NewService(cache.NewInMemoryStore())
+	todo = &model.Todo{Name: "Draft"}
+	svc.Create(ctx, todo)
+	time.Sleep(5 * time.Millisecond)
+	asOf = time.Now().UTC().Format(time.RFC3339Nano)
+	time.Sleep(5 * time.Millisecond)
+	todo.Name = "Final"
+	svc.Update(ctx, todo)
+	r = setupGinTestRouter(svc)
+
+	w = get("/todos/1?as_of=" + asOf)
+	var got model.Todo
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got.Name != "Draft" || w.Header().Get("ETag") != etag(1) {
+		t.Fatalf("expected the earlier version, got %d %s", w.Code, w.Body.String())
+	}
+	if w := get("/todos/1?as_of=2000-01-01T00:00:00Z"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 before the todo existed, got %d", w.Code)
+	}
+	if w := get("/todos/1?as_of=soon"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid time, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_Timeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("bounds the request context", func(t *testing.T) {
+		for _, d := range []time.Duration{time.Minute, 0} {
+			r := gin.New()
+			r.Use(Timeout(d))
+			var bounded bool
+			r.GET("/", func(c *gin.Context) { _, bounded = c.Request.Context().Deadline() })
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			if bounded != (d > 0) {
+				t.Errorf("Timeout(%v): expected a deadline %v, got %v", d, d > 0, bounded)
+			}
+		}
+	})
+
+	t.Run("expired requests answer 504", func(t *testing.T) {
+		svc := api.NewService(cache.NewInMemoryStore())
+		r := gin.New()
+		RegisterRoutes(r.Group("", Timeout(time.Minute)), svc)
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"name":"too late"}`)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusGatewayTimeout {
+			t.Fatalf("expected 504, got %d: %s", w.Code, w.Body.String())
+		}
+		if list, _ := svc.List(context.Background(), cache.ListOptions{}); len(list) != 0 {
+			t.Errorf("expected nothing created, got %+v", list)
+		}
+	})
 }
 
 func TestGinHandler_handleCreate(t *testing.T) {
@@ -493,7 +1255,67 @@ func TestGinHandler_handleUpdate(t *testing.T) {
 	})
 }
 
+func TestGinHandler_handleUpdate_IfMatch(t *testing.T) {
+	svc := api.NewService(cache.NewInMemoryStore())
+	r := setupGinTestRouter(svc)
+
+	req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader([]byte(`{"name":"Original"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	created := w.Header().Get("ETag")
+	if created != `"1"` {
+		t.Fatalf("expected ETag \"1\" on create, got %q", created)
+	}
+
+	put := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/todos/1", bytes.NewReader([]byte(`{"name":"Updated"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w = put(created)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("expected ETag \"2\" after update, got %q", got)
+	}
+	var response model.Todo
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Version != 2 {
+		t.Errorf("expected version 2 in body, got %d", response.Version)
+	}
+
+	// the same If-Match is now stale
+	if w = put(created); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status 412 for stale If-Match, got %d", w.Code)
+	}
+
+	if w = put(`"abc"`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for malformed If-Match, got %d", w.Code)
+	}
+
+	// without If-Match the update stays unconditional
+	if w = put(""); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 without If-Match, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("ETag"); got != `"3"` {
+		t.Errorf("expected ETag \"3\" on get, got %q", got)
+	}
+}
+
 func TestGinHandler_handleDelete(t *testing.T) {
+	ctx := context.Background()
 	t.Run("deletes existing api", func(t *testing.T) {
 		store := &mockStore{todos: make(map[int64]*model.Todo)}
 		store.todos[1] = &model.Todo{ID: 1, Name: "To Delete"}
@@ -509,7 +1331,7 @@ func TestGinHandler_handleDelete(t *testing.T) {
 		}
 
 		// Verify it's deleted
-		_, err := svc.Get(1)
+		_, err := svc.Get(ctx, 1)
 		if err != cache.ErrNotFound {
 			t.Errorf("expected ErrNotFound after delete, got %v", err)
 		}
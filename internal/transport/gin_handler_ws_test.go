@@ -2,12 +2,14 @@ package transport
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/conbanwa/todo/internal/dao/cache"
 	"github.com/conbanwa/todo/internal/dao/cache/api"
 	"github.com/conbanwa/todo/internal/model"
 	"github.com/gin-gonic/gin"
@@ -129,6 +131,55 @@ func TestGinHandler_WebSocketIntegration_Update(t *testing.T) {
 	}
 }
 
+func TestGinHandler_WebSocketIntegration_UpdateCarriesVersion(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	store := cache.NewInMemoryStore()
+	store.Create(ctx, &model.Todo{Name: "Original"})
+	svc := api.NewService(store)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutesWithHub(r, svc, hub)
+
+	r.GET("/ws", func(c *gin.Context) {
+		HandleWebSocket(c, hub)
+	})
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	wsURL := "ws" + s.URL[4:] + "/ws"
+	wsConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer wsConn.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodPut, "/todos/1", bytes.NewReader([]byte(`{"name":"Updated"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	wsConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	var wsMsg WSMessage
+	if err := wsConn.ReadJSON(&wsMsg); err != nil {
+		t.Fatalf("failed to read WebSocket message: %v", err)
+	}
+	if wsMsg.Payload.Version != 2 {
+		t.Errorf("expected broadcast version 2, got %d", wsMsg.Payload.Version)
+	}
+}
+
 func TestGinHandler_WebSocketIntegration_Delete(t *testing.T) {
 	hub := NewHub()
 	defer hub.Close()
@@ -181,6 +232,57 @@ func TestGinHandler_WebSocketIntegration_Delete(t *testing.T) {
 	}
 }
 
+func TestGinHandler_WebSocketIntegration_Restore(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	svc := api.NewService(cache.NewInMemoryStore())
+	id, _ := svc.Create(ctx, &model.Todo{Name: "Deleted by mistake"})
+	svc.Delete(ctx, id)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutesWithHub(r, svc, hub)
+
+	r.GET("/ws", func(c *gin.Context) {
+		HandleWebSocket(c, hub)
+	})
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	wsURL := "ws" + s.URL[4:] + "/ws"
+	wsConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer wsConn.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodPost, "/todos/1/restore", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	wsConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	var wsMsg WSMessage
+	if err := wsConn.ReadJSON(&wsMsg); err != nil {
+		t.Fatalf("failed to read WebSocket message: %v", err)
+	}
+
+	if wsMsg.Type != "restore" {
+		t.Errorf("expected type 'restore', got %q", wsMsg.Type)
+	}
+	if wsMsg.Payload.ID != id || wsMsg.Payload.Name != "Deleted by mistake" {
+		t.Errorf("unexpected payload %+v", wsMsg.Payload)
+	}
+}
+
 func TestGinHandler_WebSocketIntegration_MultipleClients(t *testing.T) {
 	hub := NewHub()
 	defer hub.Close()
@@ -247,3 +349,188 @@ func TestGinHandler_WebSocketIntegration_MultipleClients(t *testing.T) {
 		t.Errorf("both clients should receive correct payload")
 	}
 }
+
+func TestGinHandler_WebSocketIntegration_Patch(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	store := cache.NewInMemoryStore()
+	store.Create(ctx, &model.Todo{Name: "Original", Priority: 2, Tags: []string{"ops"}})
+	svc := api.NewService(store)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutesWithHub(r, svc, hub)
+
+	r.GET("/ws", func(c *gin.Context) {
+		HandleWebSocket(c, hub)
+	})
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	wsURL := "ws" + s.URL[4:] + "/ws"
+	wsConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer wsConn.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodPatch, "/todos/1", bytes.NewReader([]byte(`{"status":"in_progress"}`)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("expected ETag \"2\", got %q", got)
+	}
+
+	wsConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	var wsMsg WSMessage
+	if err := wsConn.ReadJSON(&wsMsg); err != nil {
+		t.Fatalf("failed to read WebSocket message: %v", err)
+	}
+	if wsMsg.Type != "update" || wsMsg.Payload.Status != model.InProgress {
+		t.Errorf("unexpected broadcast: %+v", wsMsg)
+	}
+	if wsMsg.Payload.Priority != 2 || len(wsMsg.Payload.Tags) != 1 {
+		t.Errorf("broadcast should carry the merged todo, got %+v", wsMsg.Payload)
+	}
+
+	// stale If-Match is rejected
+	req = httptest.NewRequest(http.MethodPatch, "/todos/1", bytes.NewReader([]byte(`{"priority":9}`)))
+	req.Header.Set("If-Match", `"1"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status 412, got %d", w.Code)
+	}
+}
+
+func TestGinHandler_WebSocketIntegration_RecurringComplete(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	svc := api.NewService(cache.NewInMemoryStore(), api.WithBroadcaster(hub))
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	id, _ := svc.Create(ctx, &model.Todo{Name: "Weekly ops", DueDate: due, Recurrence: "FREQ=WEEKLY"})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutesWithHub(r, svc, hub)
+	r.GET("/ws", func(c *gin.Context) {
+		HandleWebSocket(c, hub)
+	})
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	wsURL := "ws" + s.URL[4:] + "/ws"
+	wsConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer wsConn.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	body, _ := json.Marshal(model.Todo{Name: "Weekly ops", DueDate: due, Status: model.Completed, Recurrence: "FREQ=WEEKLY"})
+	req := httptest.NewRequest(http.MethodPut, "/todos/1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the service announces the next occurrence, the handler the update
+	got := map[string]model.Todo{}
+	for i := 0; i < 2; i++ {
+		wsConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+		var msg WSMessage
+		if err := wsConn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read WebSocket message: %v", err)
+		}
+		got[msg.Type] = msg.Payload
+	}
+	if got["update"].ID != id || got["update"].Status != model.Completed {
+		t.Errorf("expected update for the completed todo, got %+v", got["update"])
+	}
+	next := got["create"]
+	if next.ID == id || !next.DueDate.Equal(due.AddDate(0, 0, 7)) || next.Recurrence != "FREQ=WEEKLY" {
+		t.Errorf("expected next weekly occurrence, got %+v", next)
+	}
+}
+
+func TestGinHandler_WebSocketIntegration_Batch(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	svc := api.NewService(cache.NewInMemoryStore(), api.WithBroadcaster(hub))
+	parent := &model.Todo{Name: "Release"}
+	svc.Create(ctx, parent)
+	svc.Create(ctx, &model.Todo{Name: "Changelog", ParentID: parent.ID})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutesWithHub(r, svc, hub)
+	r.GET("/ws", func(c *gin.Context) {
+		HandleWebSocket(c, hub)
+	})
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	wsURL := "ws" + s.URL[4:] + "/ws"
+	wsConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer wsConn.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	body := `[
+		{"op": "update", "id": 2, "todo": {"name": "Changelog", "parent_id": 1, "status": "completed"}},
+		{"op": "create", "todo": {"name": "Announce"}}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/todos/batch", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// one message carrying the update, the parent's roll-up and the create
+	wsConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	var msg WSMessage
+	if err := wsConn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read WebSocket message: %v", err)
+	}
+	if msg.Type != "batch" || len(msg.Changes) != 3 {
+		t.Fatalf("expected a batch of 3 changes, got %+v", msg)
+	}
+	if c := msg.Changes[1]; c.Type != "update" || c.Payload.ID != parent.ID || c.Payload.Progress != 100 {
+		t.Errorf("expected the parent roll-up second, got %+v", c)
+	}
+	if c := msg.Changes[2]; c.Type != "create" || c.Payload.Name != "Announce" {
+		t.Errorf("expected the create last, got %+v", c)
+	}
+
+	wsConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if err := wsConn.ReadJSON(&msg); err == nil {
+		t.Errorf("expected no further message, got %+v", msg)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/conbanwa/todo/internal/dao/cache"
 	"github.com/conbanwa/todo/internal/dao/cache/api"
 	"github.com/conbanwa/todo/internal/model"
 )
@@ -20,6 +19,10 @@ type Handler struct {
 func NewHandler(svc *api.Service) http.Handler { return &Handler{svc: svc} }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		// attribute the changes of this request to its caller
+		h = &Handler{svc: h.svc.As(callerOf(r, w.Header()))}
+	}
 	path := strings.TrimPrefix(r.URL.Path, "/todos")
 	if path == "" || path == "/" {
 		switch r.Method {
@@ -31,10 +34,50 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if path == "/batch" && r.Method == http.MethodPost {
+		h.handleBatch(w, r)
+		return
+	}
+	if path == "/export" && r.Method == http.MethodGet {
+		h.handleExport(w, r)
+		return
+	}
+	if path == "/import" && r.Method == http.MethodPost {
+		h.handleImport(w, r)
+		return
+	}
+	if path == "/search" && r.Method == http.MethodGet {
+		h.handleSearch(w, r)
+		return
+	}
+	if path == "/trash" && r.Method == http.MethodGet {
+		h.handleTrash(w, r)
+		return
+	}
 	// /todos/{id}
 	parts := strings.Split(strings.Trim(path, "/"), "/")
 	if len(parts) >= 1 {
 		id, _ := strconv.ParseInt(parts[0], 10, 64)
+		if len(parts) == 2 && parts[1] == "children" && r.Method == http.MethodGet {
+			h.handleChildren(w, r, id)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "history" && r.Method == http.MethodGet {
+			h.handleHistory(w, r, id)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "graph" && r.Method == http.MethodGet {
+			h.handleGraph(w, r, id)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "restore" && r.Method == http.MethodPost {
+			h.handleRestore(w, r, id)
+			return
+		}
+		if len(parts) >= 2 && parts[1] == "dependencies" {
+			h.handleDependencies(w, r, id, parts[2:])
+			return
+		}
 		switch r.Method {
 		case http.MethodGet:
 			h.handleGet(w, r, id)
@@ -42,6 +85,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPut:
 			h.handleUpdate(w, r, id)
 			return
+		case http.MethodPatch:
+			h.handlePatch(w, r, id)
+			return
 		case http.MethodDelete:
 			h.handleDelete(w, r, id)
 			return
@@ -56,6 +102,7 @@ func (h *Handler) writeJSON(w http.ResponseWriter, v interface{}) {
 }
 
 func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var t model.Todo
 	body, _ := io.ReadAll(r.Body)
 	if err := json.Unmarshal(body, &t); err != nil {
@@ -72,53 +119,244 @@ func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	id, err := h.svc.Create(&t)
+	id, err := h.svc.Create(ctx, &t)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err, updateStatus(err))
 		return
 	}
 	t.ID = id
+	w.Header().Set("ETag", etag(t.Version))
 	w.WriteHeader(http.StatusCreated)
 	h.writeJSON(w, t)
 }
 
+func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var ops []api.BatchOp
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	status, body := runBatch(ctx, h.svc, nil, ops)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format := exportFormat(r)
+	body, err := exportTodos(ctx, h.svc, r, format)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	setExportHeaders(w.Header(), format)
+	w.Write(body)
+}
+
+func (h *Handler) handleImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status, body := runImport(ctx, h.svc, nil, w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
 func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request, id int64) {
-	t, err := h.svc.Get(id)
+	ctx := r.Context()
+	asOf, err := parseTimeParam(r.URL.Query(), "as_of")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, err := getTodo(ctx, h.svc, id, asOf)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	w.Header().Set("ETag", etag(t.Version))
 	h.writeJSON(w, t)
 }
 
 func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request, id int64) {
+	ctx := r.Context()
 	var t model.Todo
 	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 	t.ID = id
-	if err := h.svc.Update(&t); err != nil {
+	version, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t.Version = version
+	if err := h.svc.Update(ctx, &t); err != nil {
+		writeError(w, err, updateStatus(err))
+		return
+	}
+	w.Header().Set("ETag", etag(t.Version))
+	h.writeJSON(w, t)
+}
+
+func (h *Handler) handlePatch(w http.ResponseWriter, r *http.Request, id int64) {
+	ctx := r.Context()
+	version, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	t, err := applyPatch(ctx, h.svc, id, r.Header.Get("Content-Type"), body, version)
+	if err != nil {
+		writeError(w, err, errorStatus(err))
+		return
+	}
+	w.Header().Set("ETag", etag(t.Version))
 	h.writeJSON(w, t)
 }
 
 func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request, id int64) {
-	if err := h.svc.Delete(id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	ctx := r.Context()
+	if err := h.svc.Delete(ctx, id); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	opts := cache.ListOptions{SortBy: q.Get("sort_by"), SortOrder: q.Get("order")}
-	if s := q.Get("status"); s != "" {
-		opts.Status = model.Status(strings.ToLower(s))
+	ctx := r.Context()
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := listPage(ctx, h.svc, r.URL.Query(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	setPageHeaders(w.Header(), r.URL, page.NextCursor)
+	h.writeJSON(w, page.Items)
+}
+
+func (h *Handler) handleChildren(w http.ResponseWriter, r *http.Request, id int64) {
+	ctx := r.Context()
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.svc.Children(ctx, id, opts)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	setPageHeaders(w.Header(), r.URL, page.NextCursor)
+	h.writeJSON(w, page.Items)
+}
+
+func (h *Handler) handleTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.svc.Trash(ctx, opts)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	setPageHeaders(w.Header(), r.URL, page.NextCursor)
+	h.writeJSON(w, page.Items)
+}
+
+func (h *Handler) handleRestore(w http.ResponseWriter, r *http.Request, id int64) {
+	ctx := r.Context()
+	t, err := h.svc.Restore(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("ETag", etag(t.Version))
+	h.writeJSON(w, t)
+}
+
+func (h *Handler) handleHistory(w http.ResponseWriter, r *http.Request, id int64) {
+	ctx := r.Context()
+	opts, err := parseAuditOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := h.svc.History(ctx, id, opts)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	setAuditPageHeaders(w.Header(), r.URL, entries, opts.Limit)
+	h.writeJSON(w, entries)
+}
+
+func (h *Handler) handleGraph(w http.ResponseWriter, r *http.Request, id int64) {
+	ctx := r.Context()
+	g, err := h.svc.DependencyGraph(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	h.writeJSON(w, g)
+}
+
+// handleDependencies serves POST /todos/{id}/dependencies and
+// DELETE /todos/{id}/dependencies/{blocker}
+func (h *Handler) handleDependencies(w http.ResponseWriter, r *http.Request, id int64, rest []string) {
+	ctx := r.Context()
+	switch {
+	case r.Method == http.MethodPost && len(rest) == 0:
+		var d model.Dependency
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		d.TodoID = id
+		if err := h.svc.AddDependency(ctx, d.TodoID, d.BlockedBy); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		h.writeJSON(w, d)
+	case r.Method == http.MethodDelete && len(rest) == 1:
+		blocker, _ := strconv.ParseInt(rest[0], 10, 64)
+		if err := h.svc.RemoveDependency(ctx, id, blocker); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limit, err := parseSearchLimit(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	results, err := h.svc.Search(ctx, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
 	}
-	items, _ := h.svc.List(opts)
-	h.writeJSON(w, items)
+	h.writeJSON(w, results)
 }
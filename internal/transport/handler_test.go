@@ -2,6 +2,7 @@ package transport
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -43,6 +44,8 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			{http.MethodGet, "/todos/1", http.StatusNotFound, "GET /todos/1 (doesn't exist)"},
 			{http.MethodPut, "/todos/1", http.StatusBadRequest, "PUT /todos/1 (invalid JSON)"},
 			{http.MethodDelete, "/todos/1", http.StatusNotFound, "DELETE /todos/1 (doesn't exist)"},
+			{http.MethodGet, "/todos/export?format=csv", http.StatusOK, "GET /todos/export"},
+			{http.MethodPost, "/todos/import", http.StatusBadRequest, "POST /todos/import (not a list)"},
 		}
 
 		for _, tt := range tests {
@@ -268,7 +271,80 @@ func TestHandler_handleUpdate(t *testing.T) {
 	})
 }
 
+func TestHandler_handlePatch(t *testing.T) {
+	newHandler := func() http.Handler {
+		store := &mockStore{todos: make(map[int64]*model.Todo)}
+		store.todos[1] = &model.Todo{ID: 1, Name: "Original", Priority: 4, Tags: []string{"keep"}}
+		return NewHandler(api.NewService(store))
+	}
+
+	t.Run("merge patch keeps omitted fields", func(t *testing.T) {
+		handler := newHandler()
+		req := httptest.NewRequest(http.MethodPatch, "/todos/1", bytes.NewReader([]byte(`{"status":"completed"}`)))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response model.Todo
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if response.Status != model.Completed || response.Priority != 4 || len(response.Tags) != 1 {
+			t.Errorf("unexpected patched todo: %+v", response)
+		}
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		handler := newHandler()
+		body := []byte(`[{"op":"replace","path":"/name","value":"Renamed"}]`)
+		req := httptest.NewRequest(http.MethodPatch, "/todos/1", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response model.Todo
+		json.NewDecoder(w.Body).Decode(&response)
+		if response.Name != "Renamed" || response.Priority != 4 {
+			t.Errorf("unexpected patched todo: %+v", response)
+		}
+	})
+
+	t.Run("returns 415 for unknown media type", func(t *testing.T) {
+		handler := newHandler()
+		req := httptest.NewRequest(http.MethodPatch, "/todos/1", bytes.NewReader([]byte(`name=x`)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status 415, got %d", w.Code)
+		}
+	})
+
+	t.Run("returns 404 for non-existent api", func(t *testing.T) {
+		handler := newHandler()
+		req := httptest.NewRequest(http.MethodPatch, "/todos/999", bytes.NewReader([]byte(`{"name":"x"}`)))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+}
+
 func TestHandler_handleDelete(t *testing.T) {
+	ctx := context.Background()
 	t.Run("deletes existing api", func(t *testing.T) {
 		store := &mockStore{todos: make(map[int64]*model.Todo)}
 		store.todos[1] = &model.Todo{ID: 1, Name: "To Delete"}
@@ -285,7 +361,7 @@ func TestHandler_handleDelete(t *testing.T) {
 		}
 
 		// Verify it's deleted
-		_, err := svc.Get(1)
+		_, err := svc.Get(ctx, 1)
 		if err != cache.ErrNotFound {
 			t.Errorf("expected ErrNotFound after delete, got %v", err)
 		}
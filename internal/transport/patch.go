@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"mime"
+
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// errUnsupportedPatch is returned for PATCH bodies that are neither a merge
+// patch nor a JSON patch
+var errUnsupportedPatch = errors.New("unsupported patch media type, use application/merge-patch+json or application/json-patch+json")
+
+// applyPatch dispatches a PATCH body to the service by its Content-Type.
+// Plain application/json (or no type) is treated as a merge patch.
+func applyPatch(ctx context.Context, svc *api.Service, id int64, contentType string, body []byte, version int64) (*model.Todo, error) {
+	mediaType := ""
+	if contentType != "" {
+		mt, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, errUnsupportedPatch
+		}
+		mediaType = mt
+	}
+
+	switch mediaType {
+	case "", "application/json", "application/merge-patch+json":
+		return svc.MergePatch(ctx, id, body, version)
+	case "application/json-patch+json":
+		return svc.JSONPatch(ctx, id, body, version)
+	}
+	return nil, errUnsupportedPatch
+}
@@ -0,0 +1,238 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// maxPageSize caps the limit query parameter of GET /todos
+const maxPageSize = 1000
+
+// parseListOptions converts GET /todos query parameters into ListOptions.
+// Both the gin routes and the plain Handler use it so they accept the same
+// parameters.
+func parseListOptions(q url.Values) (cache.ListOptions, error) {
+	opts := cache.ListOptions{
+		SortBy:    q.Get("sort_by"),
+		SortOrder: q.Get("order"),
+		Cursor:    q.Get("cursor"),
+		TagsAny:   splitList(q, "tags_any"),
+		TagsAll:   splitList(q, "tags_all"),
+		Query:     q.Get("q"),
+	}
+	// status accepts a comma-separated list; a single value keeps using Status
+	statuses := splitList(q, "status")
+	if len(statuses) == 1 {
+		opts.Status = model.Status(strings.ToLower(statuses[0]))
+	} else {
+		for _, s := range statuses {
+			opts.Statuses = append(opts.Statuses, model.Status(strings.ToLower(s)))
+		}
+	}
+	var err error
+	if opts.PriorityMin, err = parseIntParam(q, "priority_min"); err != nil {
+		return opts, err
+	}
+	if opts.PriorityMax, err = parseIntParam(q, "priority_max"); err != nil {
+		return opts, err
+	}
+	if opts.DueAfter, err = parseTimeParam(q, "due_after"); err != nil {
+		return opts, err
+	}
+	if opts.DueBefore, err = parseTimeParam(q, "due_before"); err != nil {
+		return opts, err
+	}
+	if v := q.Get("parent_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return opts, fmt.Errorf("invalid parent_id %q", v)
+		}
+		opts.ParentID = &id
+	}
+	if v := q.Get("overdue"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid overdue %q", v)
+		}
+		opts.Overdue = b
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid limit %q", v)
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		opts.Limit = n
+	}
+	if opts.UpdatedSince, err = parseTimeParam(q, "updated_since"); err != nil {
+		return opts, err
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid offset %q", v)
+		}
+		opts.Offset = n
+	}
+	return opts, nil
+}
+
+// listPage serves a GET /todos page, from the past when as_of is given
+func listPage(ctx context.Context, svc *api.Service, q url.Values, opts cache.ListOptions) (*api.Page, error) {
+	asOf, err := parseTimeParam(q, "as_of")
+	if err != nil {
+		return nil, api.ErrInvalid(err.Error())
+	}
+	if asOf.IsZero() {
+		return svc.ListPage(ctx, opts)
+	}
+	return svc.ListPageAsOf(ctx, asOf, opts)
+}
+
+// getTodo serves GET /todos/{id}, from the past when asOf is set
+func getTodo(ctx context.Context, svc *api.Service, id int64, asOf time.Time) (*model.Todo, error) {
+	if asOf.IsZero() {
+		return svc.Get(ctx, id)
+	}
+	return svc.GetAsOf(ctx, id, asOf)
+}
+
+// defaultSearchLimit and maxSearchLimit bound GET /todos/search results
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// parseSearchLimit reads the limit parameter of GET /todos/search
+func parseSearchLimit(q url.Values) (int, error) {
+	v := q.Get("limit")
+	if v == "" {
+		return defaultSearchLimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", v)
+	}
+	if n > maxSearchLimit {
+		n = maxSearchLimit
+	}
+	return n, nil
+}
+
+// defaultAuditLimit is the page size of GET /audit and GET /todos/{id}/history
+// when no limit is given; maxPageSize caps it
+const defaultAuditLimit = 100
+
+// parseAuditOptions converts GET /audit query parameters into AuditOptions
+func parseAuditOptions(q url.Values) (cache.AuditOptions, error) {
+	opts := cache.AuditOptions{
+		Actor:     q.Get("actor"),
+		Action:    model.AuditAction(strings.ToLower(q.Get("action"))),
+		RequestID: q.Get("request_id"),
+		Limit:     defaultAuditLimit,
+	}
+	switch opts.Action {
+	case "", model.AuditCreate, model.AuditUpdate, model.AuditDelete, model.AuditRestore:
+	default:
+		return opts, fmt.Errorf("invalid action %q", opts.Action)
+	}
+	var err error
+	if v := q.Get("todo_id"); v != "" {
+		if opts.TodoID, err = strconv.ParseInt(v, 10, 64); err != nil || opts.TodoID < 0 {
+			return opts, fmt.Errorf("invalid todo_id %q", v)
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if opts.AfterID, err = strconv.ParseInt(v, 10, 64); err != nil || opts.AfterID < 0 {
+			return opts, fmt.Errorf("invalid after %q", v)
+		}
+	}
+	if opts.Since, err = parseTimeParam(q, "since"); err != nil {
+		return opts, err
+	}
+	if opts.Until, err = parseTimeParam(q, "until"); err != nil {
+		return opts, err
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid limit %q", v)
+		}
+		opts.Limit = min(n, maxPageSize)
+	}
+	return opts, nil
+}
+
+// setAuditPageHeaders links the next page of audit entries when the current
+// one is full
+func setAuditPageHeaders(h http.Header, u *url.URL, entries []model.AuditEntry, limit int) {
+	if len(entries) == 0 || len(entries) < limit {
+		return
+	}
+	q := u.Query()
+	q.Set("after", strconv.FormatInt(entries[len(entries)-1].ID, 10))
+	next := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	h.Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
+
+// splitList collects a list parameter given either repeated or comma-separated
+func splitList(q url.Values, key string) []string {
+	var out []string
+	for _, v := range q[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+func parseIntParam(q url.Values, key string) (*int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return &n, nil
+}
+
+func parseTimeParam(q url.Values, key string) (time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q, expected RFC3339", key, v)
+	}
+	return t, nil
+}
+
+// setPageHeaders advertises the next page, if any, through an RFC 8288 Link
+// header and X-Next-Cursor. The body stays a plain JSON array so existing
+// clients keep working.
+func setPageHeaders(h http.Header, u *url.URL, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+	q := u.Query()
+	q.Set("cursor", nextCursor)
+	next := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	h.Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+	h.Set("X-Next-Cursor", nextCursor)
+}
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -19,6 +20,7 @@ func setupBenchService(b *testing.B) *api.Service {
 }
 
 func BenchmarkService_Create(b *testing.B) {
+	ctx := context.Background()
 	svc := setupBenchService(b)
 	todo := &model.Todo{
 		Name:        "Benchmark Todo",
@@ -30,7 +32,7 @@ func BenchmarkService_Create(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := svc.Create(todo)
+		_, err := svc.Create(ctx, todo)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -38,12 +40,13 @@ func BenchmarkService_Create(b *testing.B) {
 }
 
 func BenchmarkService_List_Empty(b *testing.B) {
+	ctx := context.Background()
 	svc := setupBenchService(b)
 	opts := cache.ListOptions{} // Zero value = default (full list, no filters)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := svc.List(opts)
+		_, err := svc.List(ctx, opts)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -51,6 +54,7 @@ func BenchmarkService_List_Empty(b *testing.B) {
 }
 
 func BenchmarkService_List_1000Items(b *testing.B) {
+	ctx := context.Background()
 	svc := setupBenchService(b)
 	opts := cache.ListOptions{}
 
@@ -60,7 +64,7 @@ func BenchmarkService_List_1000Items(b *testing.B) {
 			Name:   "Preload Todo",
 			Status: model.InProgress,
 		}
-		_, err := svc.Create(todo)
+		_, err := svc.Create(ctx, todo)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -68,7 +72,7 @@ func BenchmarkService_List_1000Items(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := svc.List(opts)
+		_, err := svc.List(ctx, opts)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -76,18 +80,19 @@ func BenchmarkService_List_1000Items(b *testing.B) {
 }
 
 func BenchmarkService_Get(b *testing.B) {
+	ctx := context.Background()
 	svc := setupBenchService(b)
 
 	// Create one todo to fetch
 	todo := &model.Todo{Name: "Test Todo", Status: model.Completed}
-	id, err := svc.Create(todo)
+	id, err := svc.Create(ctx, todo)
 	if err != nil {
 		b.Fatal(err)
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := svc.Get(id)
+		_, err := svc.Get(ctx, id)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -95,11 +100,12 @@ func BenchmarkService_Get(b *testing.B) {
 }
 
 func BenchmarkService_Update(b *testing.B) {
+	ctx := context.Background()
 	svc := setupBenchService(b)
 
 	// Create one todo to update
 	todo := &model.Todo{Name: "Updatable Todo", Status: model.NotStarted}
-	id, err := svc.Create(todo)
+	id, err := svc.Create(ctx, todo)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -113,7 +119,7 @@ func BenchmarkService_Update(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		err := svc.Update(updateTodo)
+		err := svc.Update(ctx, updateTodo)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -121,6 +127,7 @@ func BenchmarkService_Update(b *testing.B) {
 }
 
 func BenchmarkService_Delete(b *testing.B) {
+	ctx := context.Background()
 	svc := setupBenchService(b)
 
 	b.ResetTimer()
@@ -128,13 +135,13 @@ func BenchmarkService_Delete(b *testing.B) {
 		b.StopTimer()
 		// Create a fresh todo each iteration (delete requires existing ID)
 		todo := &model.Todo{Name: "Deletable Todo", Status: model.NotStarted}
-		id, err := svc.Create(todo)
+		id, err := svc.Create(ctx, todo)
 		if err != nil {
 			b.Fatal(err)
 		}
 		b.StartTimer()
 
-		err = svc.Delete(id)
+		err = svc.Delete(ctx, id)
 		if err != nil {
 			b.Fatal(err)
 		}
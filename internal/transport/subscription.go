@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// Subscription selects the changes a client receives over /ws. A todo must
+// match every field that is set, and any one value of each. Status, tags and
+// ids are the only filters; todos have no assignee, so there is none by
+// assignee.
+type Subscription struct {
+	Status []model.Status `json:"status,omitempty"`
+	Tags   []string       `json:"tags,omitempty"`
+	IDs    []int64        `json:"ids,omitempty"`
+}
+
+// parseSubscription reads the filter of a subscribe command. Unknown
+// fields are errors rather than filters silently ignored.
+func parseSubscription(data json.RawMessage) (*Subscription, error) {
+	var s Subscription
+	if len(data) == 0 || string(data) == "null" {
+		return &s, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("%v, filter by status, tags or ids", err)
+	}
+	return &s, nil
+}
+
+func (s *Subscription) matches(t model.Todo) bool {
+	return s.matchesID(t.ID) && s.matchesStatus(t.Status) && s.matchesTags(t.Tags)
+}
+
+func (s *Subscription) matchesID(id int64) bool {
+	if len(s.IDs) == 0 {
+		return true
+	}
+	for _, v := range s.IDs {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) matchesStatus(status model.Status) bool {
+	if len(s.Status) == 0 {
+		return true
+	}
+	for _, v := range s.Status {
+		if v == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) matchesTags(tags []string) bool {
+	if len(s.Tags) == 0 {
+		return true
+	}
+	for _, v := range s.Tags {
+		for _, tag := range tags {
+			if v == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subscribe replaces the subscription of the client; nil receives every
+// change again
+func (c *Client) subscribe(s *Subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sub = s
+	c.seen = make(map[int64]bool)
+}
+
+// remember marks todos the client listed as known to it, see filter
+func (c *Client) remember(todos []model.Todo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sub == nil {
+		return
+	}
+	for _, t := range todos {
+		if c.sub.matches(t) {
+			c.seen[t.ID] = true
+		}
+	}
+}
+
+// filter returns the part of msg the client subscribed to and whether
+// anything is left. A todo the client was sent or listed since it
+// subscribed is still delivered once when a change takes it out of the
+// subscription, so the client can drop it. Deletes only carry the id and
+// pass every filter but ids.
+func (c *Client) filter(msg WSMessage) (WSMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sub == nil {
+		return msg, true
+	}
+	if msg.Type != "batch" {
+		return msg, c.wants(msg)
+	}
+	var changes []WSMessage
+	for _, change := range msg.Changes {
+		if c.wants(change) {
+			changes = append(changes, change)
+		}
+	}
+	if len(changes) == 0 {
+		return msg, false
+	}
+	msg.Changes = changes
+	return msg, true
+}
+
+// wants decides a single change; c.mu is held
+func (c *Client) wants(change WSMessage) bool {
+	id := change.Payload.ID
+	switch {
+	case change.Type == "delete":
+		delete(c.seen, id)
+		return c.sub.matchesID(id)
+	case c.sub.matches(change.Payload):
+		c.seen[id] = true
+		return true
+	case c.seen[id]:
+		delete(c.seen, id)
+		return true
+	}
+	return false
+}
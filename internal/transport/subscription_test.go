@@ -0,0 +1,161 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// drain collects what the hub has delivered to c so far
+func drain(c *Client) []WSMessage {
+	var msgs []WSMessage
+	for {
+		select {
+		case msg := <-c.send:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestHubSubscriptions_ManyClients(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	subs := []*Subscription{
+		nil,
+		{Status: []model.Status{model.Completed}},
+		{Tags: []string{"work"}},
+		{IDs: []int64{2}},
+		{Status: []model.Status{model.NotStarted, model.InProgress}, Tags: []string{"home"}},
+	}
+	const perSub = 20
+	clients := make([]*Client, len(subs)*perSub)
+	for i := range clients {
+		c := &Client{
+			hub:  hub,
+			send: make(chan WSMessage, 256),
+		}
+		if sub := subs[i%len(subs)]; sub != nil {
+			c.subscribe(sub)
+		}
+		clients[i] = c
+		hub.register <- c
+	}
+	defer func() {
+		for _, c := range clients {
+			hub.unregister <- c
+		}
+	}()
+
+	work := model.Todo{ID: 1, Name: "Report", Status: model.NotStarted, Tags: []string{"work"}}
+	home := model.Todo{ID: 2, Name: "Dishes", Status: model.InProgress, Tags: []string{"home"}}
+	hub.BroadcastCreate(&work)
+	hub.BroadcastCreate(&home)
+	work.Status = model.Completed
+	hub.BroadcastUpdate(&work)
+	// completing the dishes takes them out of the last subscription
+	home.Status = model.Completed
+	hub.BroadcastBatch([]api.Change{{Type: "update", Todo: home}, {Type: "create", Todo: model.Todo{ID: 3, Name: "Mop", Status: model.NotStarted, Tags: []string{"home"}}}})
+	hub.BroadcastDelete(1)
+	time.Sleep(100 * time.Millisecond)
+
+	// the types and ids each subscription should have received, in order
+	want := [][]string{
+		{"create 1", "create 2", "update 1", "batch [update 2 create 3]", "delete 1"},
+		{"update 1", "batch [update 2]", "delete 1"},
+		{"create 1", "update 1", "delete 1"},
+		{"create 2", "batch [update 2]"},
+		{"create 2", "batch [update 2 create 3]", "delete 1"},
+	}
+	for i, c := range clients {
+		var got []string
+		for _, msg := range drain(c) {
+			got = append(got, describe(msg))
+		}
+		w := want[i%len(subs)]
+		if len(got) != len(w) {
+			t.Fatalf("client %d (%+v): expected %v, got %v", i, subs[i%len(subs)], w, got)
+		}
+		for j := range w {
+			if got[j] != w[j] {
+				t.Errorf("client %d (%+v): expected %v, got %v", i, subs[i%len(subs)], w, got)
+				break
+			}
+		}
+	}
+}
+
+func describe(msg WSMessage) string {
+	if msg.Type != "batch" {
+		return msg.Type + " " + strconv.FormatInt(msg.Payload.ID, 10)
+	}
+	s := "batch ["
+	for i, c := range msg.Changes {
+		if i > 0 {
+			s += " "
+		}
+		s += describe(c)
+	}
+	return s + "]"
+}
+
+func TestWebSocketSubscribe(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", func(c *gin.Context) { HandleWebSocket(c, hub) })
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+"/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer ws.Close()
+	read := func() WSMessage {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var msg WSMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read WebSocket message: %v", err)
+		}
+		return msg
+	}
+
+	// even a listen-only connection may subscribe
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"id": "s1", "command": "subscribe", "filter": {"tags": ["work"]}}`))
+	if msg := read(); msg.Type != "result" || msg.ReplyTo != "s1" {
+		t.Fatalf("expected the subscription confirmed, got %+v", msg)
+	}
+	hub.BroadcastCreate(&model.Todo{ID: 1, Name: "Dishes", Tags: []string{"home"}})
+	hub.BroadcastCreate(&model.Todo{ID: 2, Name: "Report", Tags: []string{"work"}})
+	if msg := read(); msg.Type != "create" || msg.Payload.ID != 2 {
+		t.Errorf("expected only the work todo, got %+v", msg)
+	}
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"id": "s2", "command": "subscribe", "filter": {"assignee": "bob"}}`))
+	if msg := read(); msg.Type != "error" || msg.Status != http.StatusBadRequest || !strings.Contains(msg.Error, "status, tags or ids") {
+		t.Errorf("expected 400 naming the supported filters, got %+v", msg)
+	}
+
+	ws.WriteJSON(WSCommand{ID: "s3", Command: "unsubscribe"})
+	if msg := read(); msg.Type != "result" || msg.ReplyTo != "s3" {
+		t.Fatalf("expected the unsubscribe confirmed, got %+v", msg)
+	}
+	hub.BroadcastCreate(&model.Todo{ID: 3, Name: "Mop", Tags: []string{"home"}})
+	if msg := read(); msg.Payload.ID != 3 {
+		t.Errorf("expected every change after unsubscribing, got %+v", msg)
+	}
+}
@@ -1,11 +1,14 @@
 package transport
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/conbanwa/todo/internal/dao/cache/api"
 	"github.com/conbanwa/todo/internal/model"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -19,11 +22,25 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-// WSMessage represents a WebSocket message
+// historySize is how many broadcasts the hub keeps for clients that
+// reconnect with ?since=
+const historySize = 1024
+
+// WSMessage represents a WebSocket message. Besides the broadcast changes,
+// a client gets a "result" or "error" answering each of its commands, see
+// WSCommand, and a "resync" when the changes it asked to be replayed are
+// gone.
 type WSMessage struct {
-	Type      string     `json:"type"` // "create", "update", "delete"
-	Payload   model.Todo `json:"payload"`
-	Timestamp time.Time  `json:"timestamp,omitempty"`
+	Type       string       `json:"type"`          // "create", "update", "delete", "restore", "batch", "result", "error", "resync"
+	Seq        uint64       `json:"seq,omitempty"` // broadcasts are numbered from 1 in the order they are sent
+	Payload    model.Todo   `json:"payload"`
+	Changes    []WSMessage  `json:"changes,omitempty"`     // batch: the changes in order
+	ReplyTo    string       `json:"reply_to,omitempty"`    // result, error: the id of the command
+	Todos      []model.Todo `json:"todos,omitempty"`       // result of list
+	NextCursor string       `json:"next_cursor,omitempty"` // result of list
+	Status     int          `json:"status,omitempty"`      // error: the HTTP status of the same REST request
+	Error      string       `json:"error,omitempty"`
+	Timestamp  time.Time    `json:"timestamp,omitempty"`
 }
 
 // Client represents a WebSocket connection
@@ -33,6 +50,52 @@ type Client struct {
 	send   chan WSMessage
 	mu     sync.Mutex
 	closed bool
+
+	// svc runs the commands of the client, nil when it only listens;
+	// timeout bounds each command, 0 for none
+	svc     *api.Service
+	actor   string
+	timeout time.Duration
+
+	// sub selects the changes the client receives, nil for all; seen
+	// holds the todos it knows of under sub. Both are guarded by mu.
+	sub  *Subscription
+	seen map[int64]bool
+
+	// replay asks for the broadcasts after since when the client
+	// registers; lastSeq is the last broadcast handled for it, only
+	// touched by Hub.Run
+	replay  bool
+	since   uint64
+	lastSeq uint64
+}
+
+// close closes the send channel once; the hub calls it when it drops the
+// client
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// reply queues msg for this client only. It is dropped when the send
+// buffer is full.
+func (c *Client) reply(msg WSMessage) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- msg:
+	default:
+	}
 }
 
 // Hub maintains the set of active clients and broadcasts messages to them
@@ -40,8 +103,8 @@ type Hub struct {
 	// Registered clients
 	clients map[*Client]bool
 
-	// Inbound messages from clients (for future use)
-	broadcast chan WSMessage
+	// notify wakes Run when there are broadcasts to deliver
+	notify chan struct{}
 
 	// Register requests from clients
 	register chan *Client
@@ -50,15 +113,24 @@ type Hub struct {
 	unregister chan *Client
 
 	mu sync.RWMutex
+
+	// seq numbers the broadcasts and history keeps the last historySize
+	// of them, the one numbered s at s%historySize; both are guarded by
+	// histMu. sent is the last one Run delivered, only touched by Run.
+	histMu  sync.Mutex
+	seq     uint64
+	history []WSMessage
+	sent    uint64
 }
 
 // NewHub creates a new Hub
 func NewHub() *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan WSMessage, 256),
+		notify:     make(chan struct{}, 1),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		history:    make([]WSMessage, historySize),
 	}
 }
 
@@ -69,6 +141,7 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
+			h.catchUp(client)
 			count := len(h.clients)
 			h.mu.Unlock()
 			log.Printf("Client registered. Total clients: %d", count)
@@ -77,37 +150,109 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
+				client.close()
 			}
 			count := len(h.clients)
 			h.mu.Unlock()
 			log.Printf("Client unregistered. Total clients: %d", count)
 
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					// Client send buffer is full, remove client
-					close(client.send)
-					delete(h.clients, client)
-				}
+		case <-h.notify:
+			h.deliver()
+		}
+	}
+}
+
+// deliver sends the clients the broadcasts made since the last delivery,
+// in order. Should Run have fallen so far behind that some are no longer
+// kept, every client is sent a resync instead.
+func (h *Hub) deliver() {
+	h.histMu.Lock()
+	last := h.seq
+	var messages []WSMessage
+	if last-h.sent <= historySize {
+		for seq := h.sent + 1; seq <= last; seq++ {
+			messages = append(messages, h.history[seq%historySize])
+		}
+	}
+	h.histMu.Unlock()
+	lost := messages == nil && last > h.sent
+	h.sent = last
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if lost {
+		for client := range h.clients {
+			if client.lastSeq < last {
+				client.lastSeq = last
+				h.send(client, WSMessage{Type: "resync", Seq: last, Timestamp: time.Now()})
 			}
-			h.mu.RUnlock()
 		}
+		return
+	}
+	for _, message := range messages {
+		for client := range h.clients {
+			if message.Seq <= client.lastSeq {
+				// replayed when it registered
+				continue
+			}
+			client.lastSeq = message.Seq
+			if msg, ok := client.filter(message); ok {
+				h.send(client, msg)
+			}
+		}
+	}
+}
+
+// send queues msg for client, dropping the client when its send buffer is
+// full; it reconnects with ?since= to catch up. Callers hold mu.
+func (h *Hub) send(client *Client, msg WSMessage) {
+	select {
+	case client.send <- msg:
+	default:
+		client.close()
+		delete(h.clients, client)
 	}
 }
 
-// Broadcast sends a message to all connected clients
+// Broadcast numbers a message and keeps it for replay, then has Run send
+// it to all connected clients. It never blocks on Run and never drops a
+// message: Run delivers everything kept since its last delivery.
 func (h *Hub) Broadcast(msg WSMessage) {
 	if msg.Timestamp.IsZero() {
 		msg.Timestamp = time.Now()
 	}
+	h.histMu.Lock()
+	h.seq++
+	msg.Seq = h.seq
+	h.history[msg.Seq%historySize] = msg
+	h.histMu.Unlock()
 	select {
-	case h.broadcast <- msg:
+	case h.notify <- struct{}{}:
 	default:
-		// log.Println("Hub broadcast channel full, dropping message")
+		// Run is already due to deliver
+	}
+}
+
+// catchUp sends a client that asked for a replay the broadcasts after its
+// since, or a resync when they are no longer kept, would not fit its send
+// buffer or were numbered by an earlier run of the server. Broadcasts
+// still queued for Run are then skipped for it.
+func (h *Hub) catchUp(c *Client) {
+	if !c.replay {
+		return
+	}
+	h.histMu.Lock()
+	defer h.histMu.Unlock()
+	c.lastSeq = h.seq
+	missed := h.seq - c.since
+	if c.since > h.seq || missed > historySize || missed > uint64(cap(c.send)) {
+		c.reply(WSMessage{Type: "resync", Seq: h.seq})
+		return
+	}
+	for seq := c.since + 1; seq <= h.seq; seq++ {
+		if msg, ok := c.filter(h.history[seq%historySize]); ok {
+			c.reply(msg)
+		}
 	}
 }
 
@@ -121,13 +266,17 @@ func (h *Hub) Close() {
 	}
 }
 
-// readPump pumps messages from the websocket connection to the hub
+// readPump reads the commands of the client and runs them one by one
 func (c *Client) readPump() {
+	// commands still running stop when the connection goes away
+	ctx, cancel := context.WithCancel(context.Background())
 	defer func() {
+		cancel()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
 
+	c.conn.SetReadLimit(maxCommandBytes)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -135,15 +284,14 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
-		// For now, we only handle incoming pings/pongs
-		// Future: could handle incoming messages from client
+		c.handleCommand(ctx, data)
 	}
 }
 
@@ -179,8 +327,28 @@ func (c *Client) writePump() {
 	}
 }
 
-// HandleWebSocket handles websocket requests from clients
+// HandleWebSocket handles websocket requests from clients that only
+// listen; their commands are answered with 501 errors
 func HandleWebSocket(c *gin.Context, hub *Hub) {
+	HandleWebSocketWithService(c, hub, nil, 0)
+}
+
+// HandleWebSocketWithService handles websocket requests from clients that
+// may also send commands, run on svc. Commands are attributed to the
+// X-Actor of the upgrade request and each is bounded by timeout like
+// Timeout bounds a REST request; 0 leaves them unbounded. A client
+// reconnecting with ?since=<seq> is first sent the broadcasts it missed,
+// see Hub.catchUp.
+func HandleWebSocketWithService(c *gin.Context, hub *Hub, svc *api.Service, timeout time.Duration) {
+	since, replay := c.GetQuery("since")
+	var after uint64
+	if replay {
+		var err error
+		if after, err = strconv.ParseUint(since, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+			return
+		}
+	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -188,9 +356,15 @@ func HandleWebSocket(c *gin.Context, hub *Hub) {
 	}
 
 	client := &Client{
-		hub:  hub,
-		conn: conn,
-		send: make(chan WSMessage, 256),
+		hub:     hub,
+		conn:    conn,
+		send:    make(chan WSMessage, 256),
+		svc:     svc,
+		actor:   c.GetHeader(actorHeader),
+		timeout: timeout,
+
+		replay: replay,
+		since:  after,
 	}
 
 	client.hub.register <- client
@@ -223,3 +397,21 @@ func (h *Hub) BroadcastDelete(id int64) {
 		Payload: model.Todo{ID: id},
 	})
 }
+
+// BroadcastRestore broadcasts a restore event for a todo taken out of the trash
+func (h *Hub) BroadcastRestore(todo *model.Todo) {
+	h.Broadcast(WSMessage{
+		Type:    "restore",
+		Payload: *todo,
+	})
+}
+
+// BroadcastBatch broadcasts the changes of a batch as a single message so
+// clients re-render once
+func (h *Hub) BroadcastBatch(changes []api.Change) {
+	msg := WSMessage{Type: "batch", Changes: make([]WSMessage, len(changes))}
+	for i, c := range changes {
+		msg.Changes[i] = WSMessage{Type: c.Type, Payload: c.Todo}
+	}
+	h.Broadcast(msg)
+}
@@ -117,4 +117,62 @@ func BenchmarkHubBroadcast_1000Clients(b *testing.B) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+func BenchmarkHubBroadcast_1000Subscribers(b *testing.B) {
+	hub := NewHub()
+	go hub.Run()
+
+	// a tenth of the clients follow the todo, the rest other tags
+	const numClients = 1000
+	clients := make([]*Client, numClients)
+	for i := range clients {
+		c := &Client{
+			hub:  hub,
+			send: make(chan WSMessage, 256),
+		}
+		tag := "other"
+		if i%10 == 0 {
+			tag = "bench"
+		}
+		c.subscribe(&Subscription{Tags: []string{tag}})
+		clients[i] = c
+		hub.register <- c
+	}
+	defer func() {
+		for _, c := range clients {
+			hub.unregister <- c
+		}
+	}()
+
+	msg := WSMessage{
+		Type: "update",
+		Payload: model.Todo{
+			ID:     1,
+			Name:   "Updated Todo",
+			Status: model.Completed,
+			Tags:   []string{"bench"},
+		},
+	}
+
+	// wait until Run has delivered to every subscriber, so the filtering
+	// of all clients is measured rather than Broadcast alone
+	var subscribers []*Client
+	for i := 0; i < numClients; i += 10 {
+		subscribers = append(subscribers, clients[i])
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hub.Broadcast(msg)
+		for _, c := range subscribers {
+			<-c.send
+		}
+	}
+	b.StopTimer()
+	for _, c := range clients {
+		if len(c.send) > 0 {
+			b.Fatalf("a client outside the subscription was sent %d messages", len(c.send))
+		}
+	}
+}
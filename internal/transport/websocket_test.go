@@ -137,6 +137,51 @@ func TestWebSocketHub_Broadcast(t *testing.T) {
 	}
 }
 
+// TestWebSocketHub_BroadcastBacklog tests that broadcasts made faster than Run
+// delivers them all reach the client, in order
+func TestWebSocketHub_BroadcastBacklog(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	client := &Client{hub: hub, send: make(chan WSMessage, historySize)}
+	hub.register <- client
+	defer func() { hub.unregister <- client }()
+
+	// while Run is stalled, broadcasts pile up past any channel buffer
+	const n = 600
+	hub.mu.Lock()
+	for i := 1; i <= n; i++ {
+		hub.BroadcastDelete(int64(i))
+	}
+	hub.mu.Unlock()
+	for want := uint64(1); want <= n; want++ {
+		select {
+		case msg := <-client.send:
+			if msg.Seq != want {
+				t.Fatalf("expected seq %d, got %+v", want, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("broadcast %d was never delivered", want)
+		}
+	}
+
+	// a hub so far behind that the history lost some tells clients to resync
+	idle := NewHub()
+	behind := &Client{hub: idle, send: make(chan WSMessage, 8)}
+	idle.clients[behind] = true
+	for i := 0; i <= historySize; i++ {
+		idle.BroadcastDelete(1)
+	}
+	idle.deliver()
+	select {
+	case msg := <-behind.send:
+		if msg.Type != "resync" || msg.Seq != historySize+1 {
+			t.Errorf("expected a resync at seq %d, got %+v", historySize+1, msg)
+		}
+	default:
+		t.Error("expected a resync")
+	}
+}
+
 // TestWebSocketHandler_Upgrade tests HTTP to WebSocket upgrade
 func TestWebSocketHandler_Upgrade(t *testing.T) {
 	hub := NewHub()
@@ -420,3 +465,87 @@ func TestWSMessage_JSONMarshaling(t *testing.T) {
 		t.Errorf("expected name %q, got %q", msg.Payload.Name, unmarshaled.Payload.Name)
 	}
 }
+
+// TestWebSocketHub_Replay tests that reconnecting clients get what they missed
+func TestWebSocketHub_Replay(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	go hub.Run()
+
+	svc := api.NewService(&mockStore{todos: make(map[int64]*model.Todo)})
+	r := setupWebSocketTestRouter(hub, svc)
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	dial := func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+"/ws"+query, nil)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		return conn
+	}
+	read := func(conn *websocket.Conn) WSMessage {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var msg WSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		return msg
+	}
+
+	conn := dial("")
+	hub.BroadcastCreate(&model.Todo{ID: 1, Name: "First"})
+	hub.BroadcastUpdate(&model.Todo{ID: 1, Name: "First", Status: model.Completed})
+	for want := uint64(1); want <= 2; want++ {
+		if msg := read(conn); msg.Seq != want {
+			t.Fatalf("expected seq %d, got %+v", want, msg)
+		}
+	}
+	conn.Close()
+
+	// changes while the client is away
+	hub.BroadcastCreate(&model.Todo{ID: 2, Name: "Second"})
+	hub.BroadcastDelete(1)
+	time.Sleep(50 * time.Millisecond)
+
+	conn = dial("?since=2")
+	defer conn.Close()
+	if msg := read(conn); msg.Seq != 3 || msg.Type != "create" || msg.Payload.ID != 2 {
+		t.Errorf("expected the missed create, got %+v", msg)
+	}
+	if msg := read(conn); msg.Seq != 4 || msg.Type != "delete" {
+		t.Errorf("expected the missed delete, got %+v", msg)
+	}
+	hub.BroadcastCreate(&model.Todo{ID: 3, Name: "Third"})
+	if msg := read(conn); msg.Seq != 5 {
+		t.Errorf("expected live broadcasts after the replay, got %+v", msg)
+	}
+
+	// a sequence number from an earlier run of the server
+	future := dial("?since=99")
+	defer future.Close()
+	if msg := read(future); msg.Type != "resync" || msg.Seq != 5 {
+		t.Errorf("expected a resync at seq 5, got %+v", msg)
+	}
+
+	// more missed broadcasts than the history keeps
+	for i := 0; i < historySize; i++ {
+		hub.BroadcastDelete(int64(i))
+	}
+	old := dial("?since=5")
+	defer old.Close()
+	if msg := read(old); msg.Type != "resync" || msg.Seq != 5+historySize {
+		t.Errorf("expected a resync, got %+v", msg)
+	}
+
+	resp, err := http.Get(s.URL + "/ws?since=soon")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid since, got %d", resp.StatusCode)
+	}
+}
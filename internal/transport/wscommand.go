@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+)
+
+// maxCommandBytes caps a frame sent by a client
+const maxCommandBytes = 1 << 20
+
+// WSCommand is a request a client sends over /ws. Update and delete name
+// the todo by todo.id; a todo.version on update acts like If-Match. Query
+// takes the parameters of GET /todos. Filter is the Subscription of
+// subscribe, with the fields status, tags and ids.
+type WSCommand struct {
+	ID      string            `json:"id"`      // echoed as reply_to
+	Command string            `json:"command"` // "create", "update", "delete", "list", "subscribe", "unsubscribe"
+	Todo    *model.Todo       `json:"todo,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+	Filter  json.RawMessage   `json:"filter,omitempty"`
+}
+
+// handleCommand runs one frame read from the client and answers it on the
+// client's own connection. Changes are broadcast to every client, the
+// sender included, as if they were made over REST.
+func (c *Client) handleCommand(ctx context.Context, data []byte) {
+	var cmd WSCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		c.reply(WSMessage{Type: "error", Status: http.StatusBadRequest, Error: "invalid json"})
+		return
+	}
+	// listening needs no service
+	switch cmd.Command {
+	case "subscribe":
+		sub, err := parseSubscription(cmd.Filter)
+		if err != nil {
+			c.reply(commandError(cmd, http.StatusBadRequest, fmt.Errorf("invalid filter: %v", err)))
+			return
+		}
+		c.subscribe(sub)
+		c.reply(WSMessage{Type: "result", ReplyTo: cmd.ID})
+		return
+	case "unsubscribe":
+		c.subscribe(nil)
+		c.reply(WSMessage{Type: "result", ReplyTo: cmd.ID})
+		return
+	}
+	if c.svc == nil {
+		c.reply(commandError(cmd, http.StatusNotImplemented, fmt.Errorf("this connection takes no commands")))
+		return
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	svc := c.svc.As(api.Caller{Actor: c.actor, RequestID: newRequestID()})
+
+	switch cmd.Command {
+	case "create":
+		if cmd.Todo == nil {
+			c.reply(commandError(cmd, http.StatusBadRequest, fmt.Errorf("create needs a todo")))
+			return
+		}
+		t := *cmd.Todo
+		if _, err := svc.Create(ctx, &t); err != nil {
+			c.reply(commandError(cmd, updateStatus(err), err))
+			return
+		}
+		c.hub.BroadcastCreate(&t)
+		c.reply(WSMessage{Type: "result", ReplyTo: cmd.ID, Payload: t})
+
+	case "update":
+		if cmd.Todo == nil || cmd.Todo.ID == 0 {
+			c.reply(commandError(cmd, http.StatusBadRequest, fmt.Errorf("update needs a todo with an id")))
+			return
+		}
+		t := *cmd.Todo
+		if err := svc.Update(ctx, &t); err != nil {
+			c.reply(commandError(cmd, updateStatus(err), err))
+			return
+		}
+		updated, err := svc.Get(ctx, t.ID)
+		if err != nil {
+			updated = &t
+		}
+		c.hub.BroadcastUpdate(updated)
+		c.reply(WSMessage{Type: "result", ReplyTo: cmd.ID, Payload: *updated})
+
+	case "delete":
+		if cmd.Todo == nil || cmd.Todo.ID == 0 {
+			c.reply(commandError(cmd, http.StatusBadRequest, fmt.Errorf("delete needs a todo with an id")))
+			return
+		}
+		if err := svc.Delete(ctx, cmd.Todo.ID); err != nil {
+			c.reply(commandError(cmd, errorStatus(err), err))
+			return
+		}
+		c.hub.BroadcastDelete(cmd.Todo.ID)
+		c.reply(WSMessage{Type: "result", ReplyTo: cmd.ID, Payload: model.Todo{ID: cmd.Todo.ID}})
+
+	case "list":
+		q := make(url.Values, len(cmd.Query))
+		for k, v := range cmd.Query {
+			q.Set(k, v)
+		}
+		opts, err := parseListOptions(q)
+		if err != nil {
+			c.reply(commandError(cmd, http.StatusBadRequest, err))
+			return
+		}
+		page, err := listPage(ctx, svc, q, opts)
+		if err != nil {
+			c.reply(commandError(cmd, errorStatus(err), err))
+			return
+		}
+		c.remember(page.Items)
+		c.reply(WSMessage{Type: "result", ReplyTo: cmd.ID, Todos: page.Items, NextCursor: page.NextCursor})
+
+	default:
+		c.reply(commandError(cmd, http.StatusBadRequest, fmt.Errorf("unknown command %q, use create, update, delete, list, subscribe or unsubscribe", cmd.Command)))
+	}
+}
+
+// commandError is the error frame answering cmd, with the status the same
+// request would have got over REST
+func commandError(cmd WSCommand, status int, err error) WSMessage {
+	return WSMessage{Type: "error", ReplyTo: cmd.ID, Status: status, Error: err.Error()}
+}
@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/conbanwa/todo/internal/dao/cache"
+	"github.com/conbanwa/todo/internal/dao/cache/api"
+	"github.com/conbanwa/todo/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketCommands(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	svc := api.NewService(cache.NewInMemoryStore())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", func(c *gin.Context) { HandleWebSocketWithService(c, hub, svc, time.Minute) })
+	r.GET("/listen", func(c *gin.Context) { HandleWebSocket(c, hub) })
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	dial := func(path string, header http.Header) *websocket.Conn {
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+path, header)
+		if err != nil {
+			t.Fatalf("failed to connect WebSocket: %v", err)
+		}
+		return ws
+	}
+	ws := dial("/ws", http.Header{actorHeader: {"alice"}})
+	defer ws.Close()
+	other := dial("/listen", nil)
+	defer other.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	read := func(ws *websocket.Conn) WSMessage {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var msg WSMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read WebSocket message: %v", err)
+		}
+		return msg
+	}
+	// send returns the answer to cmd, skipping the broadcasts before it
+	send := func(cmd interface{}) WSMessage {
+		if err := ws.WriteJSON(cmd); err != nil {
+			t.Fatalf("failed to send command: %v", err)
+		}
+		for {
+			if msg := read(ws); msg.Type == "result" || msg.Type == "error" {
+				return msg
+			}
+		}
+	}
+
+	msg := send(WSCommand{ID: "c1", Command: "create", Todo: &model.Todo{Name: "Buy milk", Priority: 2}})
+	if msg.Type != "result" || msg.ReplyTo != "c1" || msg.Payload.ID != 1 || msg.Payload.Version != 1 {
+		t.Fatalf("expected the created todo, got %+v", msg)
+	}
+	if b := read(other); b.Type != "create" || b.Payload.Name != "Buy milk" {
+		t.Errorf("expected the create broadcast, got %+v", b)
+	}
+
+	msg = send(WSCommand{ID: "c2", Command: "update", Todo: &model.Todo{ID: 1, Name: "Buy milk", Status: model.Completed, Version: 1}})
+	if msg.Type != "result" || msg.ReplyTo != "c2" || msg.Payload.Status != model.Completed || msg.Payload.Version != 2 {
+		t.Fatalf("expected the updated todo, got %+v", msg)
+	}
+	if b := read(other); b.Type != "update" || b.Payload.Version != 2 {
+		t.Errorf("expected the update broadcast, got %+v", b)
+	}
+	msg = send(WSCommand{ID: "c3", Command: "update", Todo: &model.Todo{ID: 1, Name: "Buy oat milk", Version: 1}})
+	if msg.Type != "error" || msg.ReplyTo != "c3" || msg.Status != http.StatusPreconditionFailed || msg.Error == "" {
+		t.Errorf("expected a 412 error frame for a stale version, got %+v", msg)
+	}
+
+	send(WSCommand{ID: "c4", Command: "create", Todo: &model.Todo{Name: "Pay rent"}})
+	read(other)
+	msg = send(WSCommand{ID: "c5", Command: "list", Query: map[string]string{"status": "not_started", "limit": "10"}})
+	if msg.Type != "result" || len(msg.Todos) != 1 || msg.Todos[0].Name != "Pay rent" {
+		t.Errorf("expected the open todo listed, got %+v", msg)
+	}
+	if msg = send(WSCommand{ID: "c6", Command: "list", Query: map[string]string{"limit": "x"}}); msg.Status != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad query, got %+v", msg)
+	}
+
+	msg = send(WSCommand{ID: "c7", Command: "delete", Todo: &model.Todo{ID: 1}})
+	if msg.Type != "result" || msg.Payload.ID != 1 {
+		t.Fatalf("expected the delete confirmed, got %+v", msg)
+	}
+	if b := read(other); b.Type != "delete" || b.Payload.ID != 1 {
+		t.Errorf("expected the delete broadcast, got %+v", b)
+	}
+	if msg = send(WSCommand{ID: "c8", Command: "delete", Todo: &model.Todo{ID: 1}}); msg.Status != http.StatusNotFound {
+		t.Errorf("expected 404 deleting twice, got %+v", msg)
+	}
+	if entries, _ := svc.History(t.Context(), 1, cache.AuditOptions{}); len(entries) == 0 || entries[0].Actor != "alice" {
+		t.Errorf("expected the changes attributed to alice, got %+v", entries)
+	}
+
+	if msg = send(WSCommand{ID: "c9", Command: "archive"}); msg.Status != http.StatusBadRequest || msg.ReplyTo != "c9" {
+		t.Errorf("expected 400 for an unknown command, got %+v", msg)
+	}
+	if msg = send("not a command"); msg.Type != "error" || msg.Status != http.StatusBadRequest {
+		t.Errorf("expected an error frame for invalid json, got %+v", msg)
+	}
+
+	// a listening client cannot change anything
+	other.WriteJSON(WSCommand{ID: "x", Command: "create", Todo: &model.Todo{Name: "nope"}})
+	if msg = read(other); msg.Type != "error" || msg.Status != http.StatusNotImplemented || msg.ReplyTo != "x" {
+		t.Errorf("expected 501 on a listen-only connection, got %+v", msg)
+	}
+}
+
+func TestWebSocketCommands_Timeout(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+	go hub.Run()
+
+	svc := api.NewService(cache.NewInMemoryStore())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// the configured timeout has run out by the time the command starts
+	r.GET("/ws", func(c *gin.Context) { HandleWebSocketWithService(c, hub, svc, time.Nanosecond) })
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+"/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to connect WebSocket: %v", err)
+	}
+	defer ws.Close()
+	if err := ws.WriteJSON(WSCommand{ID: "c1", Command: "create", Todo: &model.Todo{Name: "Buy milk"}}); err != nil {
+		t.Fatalf("failed to send command: %v", err)
+	}
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var msg WSMessage
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read WebSocket message: %v", err)
+	}
+	if msg.Type != "error" || msg.ReplyTo != "c1" || msg.Status != http.StatusGatewayTimeout {
+		t.Fatalf("expected a 504 error frame, got %+v", msg)
+	}
+	if list, _ := svc.List(context.Background(), cache.ListOptions{}); len(list) != 0 {
+		t.Errorf("expected nothing created, got %+v", list)
+	}
+}
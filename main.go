@@ -12,14 +12,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/conbanwa/todo/docs"
 	"github.com/conbanwa/todo/internal/dao/cache/api"
 	"github.com/conbanwa/todo/internal/dao/db"
+	"github.com/conbanwa/todo/internal/dao/eventlog"
 	"github.com/conbanwa/todo/internal/transport"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -38,10 +42,28 @@ func main() {
 		dbPath = "todos.db"
 	}
 
-	// Initialize SQLite store
-	store, err := db.NewSQLiteStore(dbPath)
+	// `todo migrate status|up|down` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(dbPath, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	// EVENT_LOG_SYNC=false skips flushing each event to disk (default true)
+	var logOpts []eventlog.Option
+	if v := os.Getenv("EVENT_LOG_SYNC"); v != "" {
+		sync, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid EVENT_LOG_SYNC: %v", err)
+		}
+		logOpts = append(logOpts, eventlog.WithSync(sync))
+	}
+
+	// Initialize the store: SQLite, or an event log when EVENT_LOG_DIR is set
+	store, err := openStore(dbPath, os.Getenv("EVENT_LOG_DIR"), logOpts...)
 	if err != nil {
-		log.Fatalf("failed to initialize SQLite store: %v", err)
+		log.Fatalf("failed to initialize store: %v", err)
 	}
 	defer func() {
 		if err := store.Close(); err != nil {
@@ -49,12 +71,52 @@ func main() {
 		}
 	}()
 
-	svc := api.NewService(store)
-
 	// Initialize WebSocket hub
 	hub := transport.NewHub()
 	go hub.Run()
 
+	// DELETE_POLICY=cascade deletes subtasks with their parent; the default
+	// (block) refuses to delete a todo that still has subtasks
+	deletePolicy, err := api.ParseDeletePolicy(os.Getenv("DELETE_POLICY"))
+	if err != nil {
+		log.Fatalf("invalid DELETE_POLICY: %v", err)
+	}
+
+	opts := []api.Option{api.WithDeletePolicy(deletePolicy), api.WithBroadcaster(hub)}
+
+	// WORKFLOW_FILE points at a JSON workflow replacing the built-in statuses
+	if path := os.Getenv("WORKFLOW_FILE"); path != "" {
+		w, err := loadWorkflow(path)
+		if err != nil {
+			log.Fatalf("invalid WORKFLOW_FILE: %v", err)
+		}
+		opts = append(opts, api.WithWorkflow(w))
+	}
+
+	svc := api.NewService(store, opts...)
+
+	// TRASH_RETENTION is how long deleted todos stay restorable (default
+	// 720h); 0 keeps them forever
+	retention := 30 * 24 * time.Hour
+	if v := os.Getenv("TRASH_RETENTION"); v != "" {
+		if retention, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("invalid TRASH_RETENTION: %v", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if retention > 0 {
+		go svc.RunPurge(ctx, retention, time.Hour)
+	}
+
+	// REQUEST_TIMEOUT bounds each API request (default 30s); 0 disables it
+	requestTimeout := 30 * time.Second
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		if requestTimeout, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("invalid REQUEST_TIMEOUT: %v", err)
+		}
+	}
+
 	r := gin.Default()
 
 	// update swagger host to match runtime
@@ -74,13 +136,14 @@ func main() {
 		c.File("./static/index.html")
 	})
 
-	// register WebSocket route
+	// register WebSocket route; clients may also send commands over it
 	r.GET("/ws", func(c *gin.Context) {
-		transport.HandleWebSocket(c, hub)
+		transport.HandleWebSocketWithService(c, hub, svc, requestTimeout)
 	})
 
-	// register API routes with WebSocket broadcasting
-	transport.RegisterRoutesWithHub(r, svc, hub)
+	// register API routes with WebSocket broadcasting; the timeout leaves
+	// the long-lived /ws connections alone
+	transport.RegisterRoutesWithHub(r.Group("", transport.Timeout(requestTimeout)), svc, hub)
 
 	// Graceful shutdown handling
 	sigChan := make(chan os.Signal, 1)
@@ -106,6 +169,32 @@ func main() {
 	<-sigChan
 	log.Println("shutting down server...")
 
-	// Close WebSocket hub gracefully
+	// Stop the purge job and close WebSocket hub gracefully
+	cancel()
 	hub.Close()
 }
+
+// closableStore is a Store holding resources to release at shutdown
+type closableStore interface {
+	api.Store
+	Close() error
+}
+
+// openStore opens the event-sourced store in eventLogDir when it is set and
+// the SQLite database at dbPath otherwise
+func openStore(dbPath, eventLogDir string, logOpts ...eventlog.Option) (closableStore, error) {
+	if eventLogDir != "" {
+		return eventlog.NewEventStore(eventLogDir, logOpts...)
+	}
+	return db.NewSQLiteStore(dbPath)
+}
+
+// loadWorkflow reads the workflow definition at path
+func loadWorkflow(path string) (*api.Workflow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return api.LoadWorkflow(f)
+}
@@ -4,22 +4,52 @@ const WS_URL = `ws://localhost:8080/ws`;
 let ws = null;
 let todos = [];
 let editingTodoId = null;
+let parentTodoId = null;
 let wsReconnectAttempts = 0;
+// Sequence number of the last broadcast received; reconnects ask the server
+// for what came after it
+let lastSeq = 0;
+let wsConnectedBefore = false;
 const MAX_RECONNECT_ATTEMPTS = 5;
+const PAGE_SIZE = 100;
+let nextCursor = null;
+// Commands sent over the WebSocket and waiting for their answer, by id
+const pendingCommands = new Map();
+let nextCommandId = 1;
 
 // Initialize WebSocket connection
 function connectWebSocket() {
     try {
-        ws = new WebSocket(WS_URL);
+        ws = new WebSocket(lastSeq > 0 ? `${WS_URL}?since=${lastSeq}` : WS_URL);
         
         ws.onopen = () => {
             console.log('WebSocket connected');
             wsReconnectAttempts = 0;
             updateWSStatus(true);
+            if (wsConnectedBefore && lastSeq === 0) {
+                // nothing to resume from, changes while away are unknown
+                loadTodos();
+            }
+            wsConnectedBefore = true;
+            subscribeToFilter().catch(error => console.error('WebSocket subscribe failed:', error));
         };
         
         ws.onmessage = (event) => {
             const message = JSON.parse(event.data);
+            if (message.type === 'resync') {
+                // the server no longer has the changes we missed, or was
+                // restarted and numbers them anew
+                lastSeq = message.seq || 0;
+                loadTodos();
+                return;
+            }
+            if (message.seq) {
+                lastSeq = Math.max(lastSeq, message.seq);
+            }
+            if (message.type === 'result' || message.type === 'error') {
+                settleCommand(message);
+                return;
+            }
             handleWebSocketMessage(message);
         };
         
@@ -31,6 +61,8 @@ function connectWebSocket() {
         ws.onclose = () => {
             console.log('WebSocket disconnected');
             updateWSStatus(false);
+            pendingCommands.forEach(({ reject }) => reject(new Error('connection lost')));
+            pendingCommands.clear();
             
             // Attempt to reconnect
             if (wsReconnectAttempts < MAX_RECONNECT_ATTEMPTS) {
@@ -47,6 +79,51 @@ function connectWebSocket() {
     }
 }
 
+function socketOpen() {
+    return ws && ws.readyState === WebSocket.OPEN;
+}
+
+// Send a command over the WebSocket; resolves with the result frame and
+// rejects with an Error carrying the HTTP status of an error frame
+function sendCommand(command, fields) {
+    return new Promise((resolve, reject) => {
+        const id = String(nextCommandId++);
+        pendingCommands.set(id, { resolve, reject });
+        ws.send(JSON.stringify({ id, command, ...fields }));
+    });
+}
+
+function settleCommand(message) {
+    const pending = pendingCommands.get(message.reply_to);
+    if (!pending) {
+        console.error('WebSocket command failed:', message.error);
+        return;
+    }
+    pendingCommands.delete(message.reply_to);
+    if (message.type === 'result') {
+        pending.resolve(message);
+    } else {
+        pending.reject(httpError(message.status, message.error));
+    }
+}
+
+function httpError(status, message) {
+    const error = new Error(message);
+    error.status = status;
+    return error;
+}
+
+// Turn a failed REST response into the Error an error frame would give
+async function responseError(response, fallback) {
+    let message = fallback;
+    try {
+        message = (await response.json()).error || fallback;
+    } catch (error) {
+        // not JSON
+    }
+    return httpError(response.status, message);
+}
+
 function updateWSStatus(connected) {
     const indicator = document.getElementById('wsStatus');
     const text = document.getElementById('wsStatusText');
@@ -63,26 +140,62 @@ function updateWSStatus(connected) {
 function handleWebSocketMessage(message) {
     console.log('WebSocket message received:', message);
     
+    if (message.type === 'batch') {
+        // apply every change of the batch, then re-render once
+        const changed = message.changes.filter(applyChange).length;
+        if (changed > 0) {
+            showRealtimeIndicator(`${changed} todos changed`);
+            renderTodos();
+        }
+        return;
+    }
+    if (applyChange(message)) {
+        renderTodos();
+    }
+}
+
+// Apply one create/update/delete/restore message to the local list; returns
+// whether anything changed
+function applyChange(message) {
     switch (message.type) {
         case 'create':
+            // replayed changes may already be loaded
+            todos = todos.filter(t => t.id !== message.payload.id);
             todos.push(message.payload);
             showRealtimeIndicator('New todo created: ' + message.payload.name);
-            renderTodos();
-            break;
+            return true;
         case 'update':
             const updateIndex = todos.findIndex(t => t.id === message.payload.id);
+            const status = document.getElementById('filterStatus').value;
+            if (status && message.payload.status !== status) {
+                // it left the subscription
+                todos = todos.filter(t => t.id !== message.payload.id);
+                return updateIndex !== -1;
+            }
+            if (updateIndex !== -1 && message.payload.version && (todos[updateIndex].version || 0) >= message.payload.version) {
+                // Already have this version (our own update echoed back)
+                return false;
+            }
+            if (editingTodoId === message.payload.id) {
+                showError('This todo was changed by someone else while you were editing it.');
+            }
             if (updateIndex !== -1) {
                 todos[updateIndex] = message.payload;
                 showRealtimeIndicator('Todo updated: ' + message.payload.name);
-                renderTodos();
+                return true;
             }
-            break;
+            return false;
         case 'delete':
             todos = todos.filter(t => t.id !== message.payload.id);
             showRealtimeIndicator('Todo deleted');
-            renderTodos();
-            break;
+            return true;
+        case 'restore':
+            todos = todos.filter(t => t.id !== message.payload.id);
+            todos.push(message.payload);
+            showRealtimeIndicator('Todo restored: ' + message.payload.name);
+            return true;
     }
+    return false;
 }
 
 function showRealtimeIndicator(text) {
@@ -94,25 +207,54 @@ function showRealtimeIndicator(text) {
     }, 3000);
 }
 
-// Load todos from API
+// Only receive changes to todos the status filter shows
+function subscribeToFilter() {
+    const status = document.getElementById('filterStatus').value;
+    return sendCommand('subscribe', { filter: status ? { status: [status] } : {} });
+}
+
+// Build the list query from the current filter controls
+function listParams() {
+    const status = document.getElementById('filterStatus').value;
+    const sortBy = document.getElementById('sortBy').value;
+    const sortOrder = document.getElementById('sortOrder').value;
+
+    const params = new URLSearchParams();
+    if (status) params.append('status', status);
+    if (sortBy) params.append('sort_by', sortBy);
+    if (sortOrder) params.append('order', sortOrder);
+    params.append('limit', PAGE_SIZE);
+    return params;
+}
+
+// Fetch one page of todos, over the WebSocket when it is open; the next
+// cursor comes with the result or in a header
+async function fetchTodoPage(cursor) {
+    const params = listParams();
+    if (cursor) params.append('cursor', cursor);
+
+    let page;
+    if (socketOpen()) {
+        const result = await sendCommand('list', { query: Object.fromEntries(params) });
+        page = result.todos || [];
+        nextCursor = result.next_cursor || null;
+    } else {
+        const response = await fetch(`${API_BASE}/todos?${params.toString()}`);
+        if (!response.ok) throw new Error('Failed to load todos');
+        page = await response.json();
+        nextCursor = response.headers.get('X-Next-Cursor');
+    }
+    updateLoadMore();
+    return page;
+}
+
+// Load the first page of todos from API
 async function loadTodos() {
     try {
-        const status = document.getElementById('filterStatus').value;
-        const sortBy = document.getElementById('sortBy').value;
-        const sortOrder = document.getElementById('sortOrder').value;
-        
-        let url = `${API_BASE}/todos?`;
-        const params = new URLSearchParams();
-        if (status) params.append('status', status);
-        if (sortBy) params.append('sort_by', sortBy);
-        if (sortOrder) params.append('order', sortOrder);
-        
-        url += params.toString();
-        
-        const response = await fetch(url);
-        if (!response.ok) throw new Error('Failed to load todos');
-        
-        todos = await response.json();
+        if (socketOpen()) {
+            await subscribeToFilter();
+        }
+        todos = await fetchTodoPage(null);
         renderTodos();
     } catch (error) {
         showError('Failed to load todos: ' + error.message);
@@ -120,6 +262,29 @@ async function loadTodos() {
     }
 }
 
+// Append the next page of todos
+async function loadMoreTodos() {
+    if (!nextCursor) return;
+    try {
+        const page = await fetchTodoPage(nextCursor);
+        page.forEach(todo => {
+            if (!todos.find(t => t.id === todo.id)) {
+                todos.push(todo);
+            }
+        });
+        renderTodos();
+    } catch (error) {
+        showError('Failed to load more todos: ' + error.message);
+    }
+}
+
+function updateLoadMore() {
+    const button = document.getElementById('loadMore');
+    if (button) {
+        button.style.display = nextCursor ? 'inline-block' : 'none';
+    }
+}
+
 // Render todos to the DOM
 function renderTodos() {
     const container = document.getElementById('todoList');
@@ -140,7 +305,30 @@ function renderTodos() {
         return;
     }
     
-    container.innerHTML = filteredTodos.map(todo => `
+    // Nest subtasks under their parent; todos whose parent isn't loaded
+    // (or was filtered out) are shown at the top level
+    const visible = new Set(filteredTodos.map(t => t.id));
+    const childrenOf = new Map();
+    filteredTodos.forEach(todo => {
+        const parent = todo.parent_id && visible.has(todo.parent_id) ? todo.parent_id : 0;
+        if (!childrenOf.has(parent)) childrenOf.set(parent, []);
+        childrenOf.get(parent).push(todo);
+    });
+
+    container.innerHTML = renderTodoTree(childrenOf, 0, new Set());
+}
+
+function renderTodoTree(childrenOf, parentId, seen) {
+    return (childrenOf.get(parentId) || []).filter(todo => !seen.has(todo.id)).map(todo => {
+        seen.add(todo.id);
+        const children = childrenOf.get(todo.id) || [];
+        return renderTodoCard(todo, children.length > 0) +
+            (children.length > 0 ? `<div class="subtasks">${renderTodoTree(childrenOf, todo.id, seen)}</div>` : '');
+    }).join('');
+}
+
+function renderTodoCard(todo, hasChildren) {
+    return `
         <div class="todo-card ${todo.status === 'completed' ? 'completed' : ''}" data-id="${todo.id}">
             <div class="todo-header">
                 <div>
@@ -148,14 +336,22 @@ function renderTodos() {
                     <span class="status-badge status-${todo.status.replace('_', '-')}">${todo.status.replace('_', ' ')}</span>
                 </div>
                 <div class="todo-actions">
+                    <button class="btn btn-secondary btn-small" onclick="addSubtask(${todo.id})">+ Subtask</button>
                     <button class="btn btn-secondary btn-small" onclick="editTodo(${todo.id})">Edit</button>
                     <button class="btn btn-danger btn-small" onclick="deleteTodo(${todo.id})">Delete</button>
                 </div>
             </div>
             ${todo.description ? `<p style="margin: 10px 0; color: #4b5563;">${escapeHtml(todo.description)}</p>` : ''}
+            ${hasChildren ? `
+                <div class="progress" title="${todo.progress || 0}% of subtasks done">
+                    <div class="progress-bar" style="width: ${todo.progress || 0}%"></div>
+                </div>
+            ` : ''}
             <div class="todo-meta">
                 ${todo.due_date ? `<span>📅 Due: ${formatDate(todo.due_date)}</span>` : ''}
                 ${todo.priority ? `<span>⭐ Priority: ${todo.priority}</span>` : ''}
+                ${todo.recurrence ? `<span title="${escapeHtml(todo.recurrence)}">🔁 Repeats</span>` : ''}
+                ${hasChildren ? `<span>✅ ${todo.progress || 0}%</span>` : ''}
             </div>
             ${todo.tags && todo.tags.length > 0 ? `
                 <div class="todo-tags">
@@ -163,7 +359,7 @@ function renderTodos() {
                 </div>
             ` : ''}
         </div>
-    `).join('');
+    `;
 }
 
 function escapeHtml(text) {
@@ -178,23 +374,80 @@ function formatDate(dateString) {
     return date.toLocaleDateString() + ' ' + date.toLocaleTimeString([], {hour: '2-digit', minute:'2-digit'});
 }
 
+// Load the workflow and offer its states in the status selects
+async function loadWorkflow() {
+    try {
+        const response = await fetch(`${API_BASE}/workflow`);
+        if (!response.ok) return;
+        const workflow = await response.json();
+        const options = workflow.states.map(state =>
+            `<option value="${escapeHtml(state.name)}">${escapeHtml(state.label || state.name.replace(/_/g, ' '))}</option>`
+        ).join('');
+        document.getElementById('todoStatus').innerHTML = options;
+        document.getElementById('todoStatus').value = workflow.initial;
+        document.getElementById('filterStatus').innerHTML = '<option value="">All Statuses</option>' + options;
+    } catch (error) {
+        // keep the built-in statuses
+    }
+}
+
+// Create, update and delete go over the WebSocket when it is open and
+// fall back to REST otherwise; both answer the same statuses
+async function sendCreate(todoData) {
+    if (socketOpen()) {
+        return (await sendCommand('create', { todo: todoData })).payload;
+    }
+    const response = await fetch(`${API_BASE}/todos`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(todoData)
+    });
+    if (!response.ok) {
+        throw await responseError(response, 'Failed to create todo');
+    }
+    return response.json();
+}
+
+async function sendUpdate(id, todoData, version) {
+    if (socketOpen()) {
+        return (await sendCommand('update', { todo: { ...todoData, id, version } })).payload;
+    }
+    const headers = {
+        'Content-Type': 'application/json',
+    };
+    if (version) {
+        headers['If-Match'] = `"${version}"`;
+    }
+    const response = await fetch(`${API_BASE}/todos/${id}`, {
+        method: 'PUT',
+        headers: headers,
+        body: JSON.stringify(todoData)
+    });
+    if (!response.ok) {
+        throw await responseError(response, 'Failed to update todo');
+    }
+    return response.json();
+}
+
+async function sendDelete(id) {
+    if (socketOpen()) {
+        await sendCommand('delete', { todo: { id } });
+        return;
+    }
+    const response = await fetch(`${API_BASE}/todos/${id}`, {
+        method: 'DELETE'
+    });
+    if (!response.ok) {
+        throw await responseError(response, 'Failed to delete todo');
+    }
+}
+
 // Create todo
 async function createTodo(todoData) {
     try {
-        const response = await fetch(`${API_BASE}/todos`, {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/json',
-            },
-            body: JSON.stringify(todoData)
-        });
-        
-        if (!response.ok) {
-            const error = await response.json();
-            throw new Error(error.error || 'Failed to create todo');
-        }
-        
-        const created = await response.json();
+        const created = await sendCreate(todoData);
         
         // WebSocket will handle the broadcast, but we can add locally for immediate feedback
         if (!todos.find(t => t.id === created.id)) {
@@ -214,20 +467,22 @@ async function createTodo(todoData) {
 // Update todo
 async function updateTodo(id, todoData) {
     try {
-        const response = await fetch(`${API_BASE}/todos/${id}`, {
-            method: 'PUT',
-            headers: {
-                'Content-Type': 'application/json',
-            },
-            body: JSON.stringify(todoData)
-        });
-        
-        if (!response.ok) {
-            const error = await response.json();
-            throw new Error(error.error || 'Failed to update todo');
+        const current = todos.find(t => t.id === id);
+        // an update replaces the whole todo; keep it under its parent
+        if (current && current.parent_id) {
+            todoData.parent_id = current.parent_id;
+        }
+
+        let updated;
+        try {
+            updated = await sendUpdate(id, todoData, current ? current.version : 0);
+        } catch (error) {
+            if (error.status === 412) {
+                await loadTodos();
+                throw new Error('it was changed by someone else, please review and try again');
+            }
+            throw error;
         }
-        
-        const updated = await response.json();
         const index = todos.findIndex(t => t.id === id);
         if (index !== -1) {
             todos[index] = updated;
@@ -247,37 +502,84 @@ async function updateTodo(id, todoData) {
 
 // Delete todo
 async function deleteTodo(id) {
-    if (!confirm('Are you sure you want to delete this todo?')) {
+    if (!confirm('Move this todo to the trash?')) {
         return;
     }
     
     try {
-        const response = await fetch(`${API_BASE}/todos/${id}`, {
-            method: 'DELETE'
-        });
-        
-        if (!response.ok) {
-            throw new Error('Failed to delete todo');
+        try {
+            await sendDelete(id);
+        } catch (error) {
+            if (error.status === 409) {
+                throw new Error('it still has subtasks, delete those first');
+            }
+            throw error;
         }
         
-        todos = todos.filter(t => t.id !== id);
-        showSuccess('Todo deleted successfully!');
+        todos = todos.filter(t => t.id !== id && !isDescendantOf(t, id));
+        showSuccess('Todo moved to the trash.', { label: 'Undo', run: () => restoreTodo(id) });
         renderTodos();
     } catch (error) {
         showError('Failed to delete todo: ' + error.message);
     }
 }
 
+// Restore todo from the trash, together with its deleted subtasks
+async function restoreTodo(id) {
+    try {
+        const response = await fetch(`${API_BASE}/todos/${id}/restore`, {
+            method: 'POST'
+        });
+
+        if (!response.ok) {
+            throw new Error('it is no longer in the trash');
+        }
+
+        showSuccess('Todo restored successfully!');
+        await loadTodos();
+    } catch (error) {
+        showError('Failed to restore todo: ' + error.message);
+    }
+}
+
+// isDescendantOf reports whether todo sits anywhere below ancestorId
+function isDescendantOf(todo, ancestorId) {
+    const seen = new Set();
+    let parentId = todo.parent_id;
+    while (parentId && !seen.has(parentId)) {
+        if (parentId === ancestorId) return true;
+        seen.add(parentId);
+        const parent = todos.find(t => t.id === parentId);
+        parentId = parent ? parent.parent_id : 0;
+    }
+    return false;
+}
+
+// Start creating a subtask of the given todo
+function addSubtask(id) {
+    const parent = todos.find(t => t.id === id);
+    if (!parent) return;
+
+    cancelEdit();
+    parentTodoId = id;
+    document.querySelector('button[type="submit"]').textContent = `Create Subtask of "${parent.name}"`;
+    document.getElementById('cancelEdit').style.display = 'inline-block';
+    document.getElementById('todoForm').scrollIntoView({ behavior: 'smooth' });
+    document.getElementById('todoName').focus();
+}
+
 // Edit todo
 function editTodo(id) {
     const todo = todos.find(t => t.id === id);
     if (!todo) return;
     
     editingTodoId = id;
+    parentTodoId = null;
     document.getElementById('todoName').value = todo.name;
     document.getElementById('todoDescription').value = todo.description || '';
     document.getElementById('todoStatus').value = todo.status;
     document.getElementById('todoPriority').value = todo.priority || 0;
+    document.getElementById('todoRecurrence').value = todo.recurrence || '';
     
     if (todo.due_date) {
         const date = new Date(todo.due_date);
@@ -294,6 +596,7 @@ function editTodo(id) {
 
 function cancelEdit() {
     editingTodoId = null;
+    parentTodoId = null;
     document.getElementById('todoForm').reset();
     document.getElementById('cancelEdit').style.display = 'none';
     document.querySelector('button[type="submit"]').textContent = 'Create Todo';
@@ -308,9 +611,16 @@ function showError(message) {
     }, 5000);
 }
 
-function showSuccess(message) {
+function showSuccess(message, action) {
     const successDiv = document.getElementById('successMessage');
     successDiv.textContent = message;
+    if (action) {
+        const button = document.createElement('button');
+        button.className = 'btn-link';
+        button.textContent = action.label;
+        button.onclick = action.run;
+        successDiv.append(' ', button);
+    }
     successDiv.style.display = 'block';
     setTimeout(() => {
         successDiv.style.display = 'none';
@@ -326,6 +636,7 @@ document.getElementById('todoForm').addEventListener('submit', async (e) => {
         description: document.getElementById('todoDescription').value.trim(),
         status: document.getElementById('todoStatus').value,
         priority: parseInt(document.getElementById('todoPriority').value) || 0,
+        recurrence: document.getElementById('todoRecurrence').value.trim(),
     };
     
     const dueDate = document.getElementById('todoDueDate').value;
@@ -341,7 +652,11 @@ document.getElementById('todoForm').addEventListener('submit', async (e) => {
     if (editingTodoId) {
         await updateTodo(editingTodoId, formData);
     } else {
+        if (parentTodoId) {
+            formData.parent_id = parentTodoId;
+        }
         await createTodo(formData);
+        cancelEdit();
     }
 });
 
@@ -349,8 +664,10 @@ document.getElementById('filterStatus').addEventListener('change', loadTodos);
 document.getElementById('sortBy').addEventListener('change', loadTodos);
 document.getElementById('sortOrder').addEventListener('change', loadTodos);
 document.getElementById('searchInput').addEventListener('input', renderTodos);
+document.getElementById('loadMore').addEventListener('click', loadMoreTodos);
 
 // Initialize
+loadWorkflow();
 connectWebSocket();
 loadTodos();
 